@@ -3,8 +3,10 @@ package main
 import (
 	"errors"
 	"fmt"
+	"strconv"
 	"strings"
 
+	"github.com/dustin/go-humanize"
 	"github.com/pborzenkov/tg-bot-transmission/pkg/bot"
 )
 
@@ -52,3 +54,141 @@ func (ss *stringSliceValue) Set(s string) error {
 func (ss *stringSliceValue) String() string {
 	return strings.Join(*ss, ",")
 }
+
+type intSliceValue []int
+
+func newIntSliceValue(s *[]int) *intSliceValue {
+	return (*intSliceValue)(s)
+}
+
+func (is *intSliceValue) Set(s string) error {
+	i, err := strconv.Atoi(s)
+	if err != nil {
+		return fmt.Errorf("invalid integer value %q", s)
+	}
+	*is = append(*is, i)
+
+	return nil
+}
+
+func (is *intSliceValue) String() string {
+	ints := make([]string, 0, len(*is))
+	for _, i := range *is {
+		ints = append(ints, strconv.Itoa(i))
+	}
+
+	return strings.Join(ints, ",")
+}
+
+type usersValue []bot.User
+
+func newUsersValue(p *[]bot.User) *usersValue {
+	return (*usersValue)(p)
+}
+
+func (u *usersValue) Set(s string) error {
+	parts := strings.Split(s, ":")
+	if len(parts) != 2 || parts[1] == "" {
+		return errors.New("invalid user value")
+	}
+	role, err := bot.ParseRole(parts[0])
+	if err != nil {
+		return err
+	}
+
+	// Telegram usernames can't start with a digit, so it's safe to assume
+	// that numeric value is a user ID.
+	user := bot.User{Role: role}
+	if id, err := strconv.Atoi(parts[1]); err == nil {
+		user.ID = id
+	} else {
+		user.Name = parts[1]
+	}
+	*u = append(*u, user)
+
+	return nil
+}
+
+func (u *usersValue) String() string {
+	users := make([]string, 0, len(*u))
+	for _, uu := range *u {
+		name := uu.Name
+		if name == "" {
+			name = strconv.Itoa(uu.ID)
+		}
+		users = append(users, fmt.Sprintf("%s:%s", uu.Role, name))
+	}
+
+	return strings.Join(users, ",")
+}
+
+type int64SliceValue []int64
+
+func newInt64SliceValue(s *[]int64) *int64SliceValue {
+	return (*int64SliceValue)(s)
+}
+
+func (is *int64SliceValue) Set(s string) error {
+	i, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid integer value %q", s)
+	}
+	*is = append(*is, i)
+
+	return nil
+}
+
+func (is *int64SliceValue) String() string {
+	ints := make([]string, 0, len(*is))
+	for _, i := range *is {
+		ints = append(ints, strconv.FormatInt(i, 10))
+	}
+
+	return strings.Join(ints, ",")
+}
+
+type rulesValue []bot.Rule
+
+func newRulesValue(p *[]bot.Rule) *rulesValue {
+	return (*rulesValue)(p)
+}
+
+func (r *rulesValue) Set(s string) error {
+	rule, err := bot.ParseRule(s)
+	if err != nil {
+		return err
+	}
+	*r = append(*r, rule)
+
+	return nil
+}
+
+func (r *rulesValue) String() string {
+	rules := make([]string, 0, len(*r))
+	for _, rr := range *r {
+		rules = append(rules, rr.String())
+	}
+
+	return strings.Join(rules, ",")
+}
+
+type bytesValue int64
+
+func newBytesValue(p *int64, def int64) *bytesValue {
+	*p = def
+	return (*bytesValue)(p)
+}
+
+func (b *bytesValue) Set(s string) error {
+	n, err := humanize.ParseBytes(s)
+	if err != nil {
+		return fmt.Errorf("invalid size value %q", s)
+	}
+	*b = bytesValue(n)
+
+	return nil
+}
+
+func (b *bytesValue) String() string {
+	return humanize.IBytes(uint64(*b))
+}
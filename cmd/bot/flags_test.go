@@ -29,3 +29,115 @@ func TestLocations(t *testing.T) {
 		t.Errorf("unexpected string representation, want = %q, got = %q", want, got)
 	}
 }
+
+func TestIntSlice(t *testing.T) {
+	var ints []int
+
+	fl := newIntSliceValue(&ints)
+	for _, s := range []string{"123", "456"} {
+		if err := fl.Set(s); err != nil {
+			t.Fatalf("unexpected error setting %q: %v", s, err)
+		}
+	}
+	if err := fl.Set("abc"); err == nil {
+		t.Errorf("expected an error setting non-integer value")
+	}
+
+	if diff := cmp.Diff([]int{123, 456}, ints); diff != "" {
+		t.Errorf("unexpected result (-want +got):\n%s", diff)
+	}
+	if want, got := "123,456", fl.String(); want != got {
+		t.Errorf("unexpected string representation, want = %q, got = %q", want, got)
+	}
+}
+
+func TestUsers(t *testing.T) {
+	var users []bot.User
+
+	fl := newUsersValue(&users)
+	for _, s := range []string{"viewer:user1", "adder:123"} {
+		if err := fl.Set(s); err != nil {
+			t.Fatalf("unexpected error setting %q: %v", s, err)
+		}
+	}
+	for _, s := range []string{"user1", "superuser:user1", "admin:"} {
+		if err := fl.Set(s); err == nil {
+			t.Errorf("expected an error setting %q", s)
+		}
+	}
+
+	want := []bot.User{
+		{Name: "user1", Role: bot.RoleViewer},
+		{ID: 123, Role: bot.RoleAdder},
+	}
+	if diff := cmp.Diff(want, users); diff != "" {
+		t.Errorf("unexpected result (-want +got):\n%s", diff)
+	}
+	if want, got := "viewer:user1,adder:123", fl.String(); want != got {
+		t.Errorf("unexpected string representation, want = %q, got = %q", want, got)
+	}
+}
+
+func TestInt64Slice(t *testing.T) {
+	var ints []int64
+
+	fl := newInt64SliceValue(&ints)
+	for _, s := range []string{"-1001234567890", "456"} {
+		if err := fl.Set(s); err != nil {
+			t.Fatalf("unexpected error setting %q: %v", s, err)
+		}
+	}
+	if err := fl.Set("abc"); err == nil {
+		t.Errorf("expected an error setting non-integer value")
+	}
+
+	if diff := cmp.Diff([]int64{-1001234567890, 456}, ints); diff != "" {
+		t.Errorf("unexpected result (-want +got):\n%s", diff)
+	}
+	if want, got := "-1001234567890,456", fl.String(); want != got {
+		t.Errorf("unexpected string representation, want = %q, got = %q", want, got)
+	}
+}
+
+func TestBytes(t *testing.T) {
+	var size int64
+
+	fl := newBytesValue(&size, 1024)
+	if want, got := "1.0 KiB", fl.String(); want != got {
+		t.Errorf("unexpected string representation, want = %q, got = %q", want, got)
+	}
+
+	if err := fl.Set("10MiB"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := fl.Set("abc"); err == nil {
+		t.Errorf("expected an error setting non-size value")
+	}
+	if want, got := int64(10<<20), size; want != got {
+		t.Errorf("unexpected result, want = %d, got = %d", want, got)
+	}
+}
+
+func TestRules(t *testing.T) {
+	var rules []bot.Rule
+
+	fl := newRulesValue(&rules)
+	if err := fl.Set("shows:tv:name~S\\d+E\\d+"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := fl.Set("movies:films:ext=mkv|avi;size>1GiB"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := fl.Set("broken:films:seeders>10"); err == nil {
+		t.Errorf("expected an error setting invalid rule")
+	}
+	if diff := cmp.Diff([]bot.Rule{
+		{Name: "shows", Location: "tv", Pattern: `S\d+E\d+`},
+		{Name: "movies", Location: "films", Extensions: []string{"mkv", "avi"}, MinSize: 1 << 30},
+	}, rules); diff != "" {
+		t.Errorf("unexpected result (-want +got):\n%s", diff)
+	}
+	if want, got := "shows:tv:name~S\\d+E\\d+,movies:films:ext=mkv|avi;size>1.0 GiB", fl.String(); want != got {
+		t.Errorf("unexpected string representation, want = %q, got = %q", want, got)
+	}
+}
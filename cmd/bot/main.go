@@ -6,7 +6,9 @@ import (
 	"fmt"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"syscall"
+	"time"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
 	"github.com/pborzenkov/go-transmission/transmission"
@@ -22,11 +24,25 @@ var (
 type config struct {
 	APIToken         string
 	AllowUsers       []string
+	AllowUserIDs     []int
+	Users            []bot.User
+	AllowChats       []int64
 	TransmissionURL  string
 	TransmissionUser string
 	TransmissionPass string
+	PollInterval     time.Duration
+	WebhookURL       string
+	WebhookListen    string
+	WebhookSecret    string
+	Concurrency      int
+	UpdateTimeout    time.Duration
+	MaxTorrentSize   int64
+	DownloadTimeout  time.Duration
 	Verbose          bool
 	Locations        []bot.Location
+	Rules            []bot.Rule
+	DataDir          string
+	ConfigFile       string
 }
 
 func (c *config) command() *ffcli.Command {
@@ -34,13 +50,39 @@ func (c *config) command() *ffcli.Command {
 	fs.StringVar(&c.APIToken, "telegram.api-token", "", "Telegram Bot API token")
 	fs.Var(newStringSliceValue(&c.AllowUsers), "telegram.allow-user",
 		"Telegram username that's allowed to control the bot")
+	fs.Var(newIntSliceValue(&c.AllowUserIDs), "telegram.allow-user-id",
+		"Telegram user ID that's allowed to control the bot")
+	fs.Var(newUsersValue(&c.Users), "telegram.user",
+		"Telegram username or user ID that's allowed to control the bot with the given role (ROLE:USER)")
+	fs.Var(newInt64SliceValue(&c.AllowChats), "telegram.allow-chat",
+		"Telegram group chat ID the bot is allowed to work in")
+	fs.StringVar(&c.WebhookURL, "telegram.webhook-url", "",
+		"Public URL to receive updates from Telegram at (long polling is used if empty)")
+	fs.StringVar(&c.WebhookListen, "telegram.listen", ":8080", "Address to listen for webhook requests on")
+	fs.StringVar(&c.WebhookSecret, "telegram.webhook-secret", "",
+		"Secret token Telegram sends with every webhook request")
+	fs.IntVar(&c.Concurrency, "telegram.concurrency", 4, "Maximum number of updates processed concurrently")
+	fs.DurationVar(&c.UpdateTimeout, "telegram.update-timeout", time.Minute,
+		"Maximum time allowed to process a single update")
+	fs.Var(newBytesValue(&c.MaxTorrentSize, 10<<20), "telegram.max-torrent-size",
+		"Maximum size of a .torrent file sent to the bot")
+	fs.DurationVar(&c.DownloadTimeout, "telegram.download-timeout", 30*time.Second,
+		"Maximum time allowed to download a .torrent file sent to the bot")
 	fs.StringVar(&c.TransmissionURL, "transmission.url", "http://localhost:9091",
 		"Transmission RPC server URL")
 	fs.StringVar(&c.TransmissionUser, "transmission.username", "", "Transmission RPC username")
 	fs.StringVar(&c.TransmissionPass, "transmission.password", "", "Transmission RPC password")
+	fs.DurationVar(&c.PollInterval, "transmission.poll-interval", time.Minute,
+		"How often to check if the added torrents are done downloading")
 	fs.Var(newLocationsValue(&c.Locations), "data.location",
 		"Data locations for specific data types (NAME:PATH)")
+	fs.Var(newRulesValue(&c.Rules), "data.rule",
+		"Rule picking a data location for new torrents (NAME:LOCATION:COND[;COND...], "+
+			"COND is one of name~REGEXP, tracker=HOST, ext=EXT[|EXT...], size>SIZE, size<SIZE)")
+	fs.StringVar(&c.DataDir, "data.dir", "",
+		"Directory to keep the bot state in (the state is lost on restart if empty)")
 	fs.BoolVar(&c.Verbose, "verbose", false, "Enable verbose logging")
+	fs.StringVar(&c.ConfigFile, "config", "", "Config file with one flag per line (FLAG VALUE)")
 
 	root := &ffcli.Command{
 		Name:       "bot",
@@ -49,6 +91,8 @@ func (c *config) command() *ffcli.Command {
 		Options: []ff.Option{
 			ff.WithEnvVarPrefix("BOT"),
 			ff.WithEnvVarSplit(","),
+			ff.WithConfigFileFlag("config"),
+			ff.WithConfigFileParser(ff.PlainParser),
 		},
 		Exec: c.exec,
 	}
@@ -91,12 +135,59 @@ func (c *config) exec(ctx context.Context, args []string) error {
 	if err != nil {
 		return fmt.Errorf("transmission.New: %v", err)
 	}
-	bot.New(tg, trans,
+	store, err := c.store()
+	if err != nil {
+		return err
+	}
+	b := bot.New(tg, trans,
+		bot.WithStore(store),
 		bot.WithLogger(log),
 		bot.WithAllowedUsers(c.AllowUsers...),
+		bot.WithAllowedUserIDs(c.AllowUserIDs...),
+		bot.WithUsers(c.Users...),
+		bot.WithAllowedChats(c.AllowChats...),
+		bot.WithUsername(tg.Self.UserName),
+		bot.WithToken(c.APIToken),
 		bot.WithSetCommands(),
 		bot.WithLocations(c.Locations...),
-	).Run(ctx)
+		bot.WithRules(c.Rules...),
+		bot.WithNotifyInterval(c.PollInterval),
+		bot.WithConcurrency(c.Concurrency),
+		bot.WithUpdateTimeout(c.UpdateTimeout),
+		bot.WithMaxTorrentSize(c.MaxTorrentSize),
+		bot.WithDownloadTimeout(c.DownloadTimeout),
+	)
+	if c.WebhookURL == "" {
+		b.Run(ctx)
+		return nil
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	updates := make(chan tgbotapi.Update)
+	srv := newWebhookServer(log, tg, c.WebhookListen, c.WebhookURL, c.WebhookSecret, updates)
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- srv.Run(ctx)
+		cancel()
+	}()
+	b.Serve(ctx, updates)
 
-	return nil
+	return <-errCh
+}
+
+func (c *config) store() (bot.Store, error) {
+	if c.DataDir == "" {
+		return nil, nil
+	}
+
+	if err := os.MkdirAll(c.DataDir, 0o700); err != nil {
+		return nil, fmt.Errorf("can't create data directory: %v", err)
+	}
+	store, err := bot.NewFileStore(filepath.Join(c.DataDir, "state.json"))
+	if err != nil {
+		return nil, fmt.Errorf("bot.NewFileStore: %v", err)
+	}
+	return store, nil
 }
@@ -2,7 +2,9 @@ package main
 
 import (
 	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/pborzenkov/tg-bot-transmission/pkg/bot"
@@ -22,19 +24,54 @@ func TestConfig(t *testing.T) {
 				"-telegram.api-token", "abcde",
 				"-telegram.allow-user", "user1",
 				"-telegram.allow-user", "user2",
+				"-telegram.allow-user-id", "123",
+				"-telegram.allow-user-id", "456",
+				"-telegram.user", "viewer:user3",
+				"-telegram.user", "adder:789",
+				"-telegram.allow-chat", "-100",
+				"-telegram.webhook-url", "https://example.com/bot",
+				"-telegram.listen", ":8443",
+				"-telegram.webhook-secret", "secret",
+				"-telegram.concurrency", "8",
+				"-telegram.update-timeout", "30s",
+				"-telegram.max-torrent-size", "1MiB",
+				"-telegram.download-timeout", "10s",
 				"-transmission.url", "http://example.com:1234",
+				"-transmission.poll-interval", "5m",
 				"-data.location", "loc1:/path/to/loc1",
 				"-data.location", "loc2:/path/to/loc2",
+				"-data.rule", "shows:loc2:name~S\\d+E\\d+",
+				"-data.rule", "movies:loc1:ext=mkv|avi;size>1GiB",
+				"-data.dir", "/var/lib/bot",
 			},
 			want: &config{
-				Verbose:         true,
-				APIToken:        "abcde",
-				AllowUsers:      []string{"user1", "user2"},
+				Verbose:      true,
+				APIToken:     "abcde",
+				AllowUsers:   []string{"user1", "user2"},
+				AllowUserIDs: []int{123, 456},
+				Users: []bot.User{
+					{Name: "user3", Role: bot.RoleViewer},
+					{ID: 789, Role: bot.RoleAdder},
+				},
+				AllowChats:      []int64{-100},
+				WebhookURL:      "https://example.com/bot",
+				WebhookListen:   ":8443",
+				WebhookSecret:   "secret",
+				Concurrency:     8,
+				UpdateTimeout:   30 * time.Second,
+				MaxTorrentSize:  1 << 20,
+				DownloadTimeout: 10 * time.Second,
 				TransmissionURL: "http://example.com:1234",
+				PollInterval:    5 * time.Minute,
 				Locations: []bot.Location{
 					{Name: "loc1", Path: "/path/to/loc1"},
 					{Name: "loc2", Path: "/path/to/loc2"},
 				},
+				Rules: []bot.Rule{
+					{Name: "shows", Location: "loc2", Pattern: `S\d+E\d+`},
+					{Name: "movies", Location: "loc1", Extensions: []string{"mkv", "avi"}, MinSize: 1 << 30},
+				},
+				DataDir: "/var/lib/bot",
 			},
 		},
 		{
@@ -43,18 +80,50 @@ func TestConfig(t *testing.T) {
 				"BOT_VERBOSE", "true",
 				"BOT_TELEGRAM_API_TOKEN", "abcde",
 				"BOT_TELEGRAM_ALLOW_USER", "user1,user2",
+				"BOT_TELEGRAM_ALLOW_USER_ID", "123,456",
+				"BOT_TELEGRAM_USER", "viewer:user3,adder:789",
+				"BOT_TELEGRAM_ALLOW_CHAT", "-100",
+				"BOT_TELEGRAM_WEBHOOK_URL", "https://example.com/bot",
+				"BOT_TELEGRAM_LISTEN", ":8443",
+				"BOT_TELEGRAM_WEBHOOK_SECRET", "secret",
+				"BOT_TELEGRAM_CONCURRENCY", "8",
+				"BOT_TELEGRAM_UPDATE_TIMEOUT", "30s",
+				"BOT_TELEGRAM_MAX_TORRENT_SIZE", "1MiB",
+				"BOT_TELEGRAM_DOWNLOAD_TIMEOUT", "10s",
 				"BOT_TRANSMISSION_URL", "http://example.com:1234",
+				"BOT_TRANSMISSION_POLL_INTERVAL", "5m",
 				"BOT_DATA_LOCATION", "loc1:/path/to/loc1,loc2:/path/to/loc2",
+				"BOT_DATA_RULE", "shows:loc2:name~S\\d+E\\d+,movies:loc1:ext=mkv|avi;size>1GiB",
+				"BOT_DATA_DIR", "/var/lib/bot",
 			},
 			want: &config{
-				Verbose:         true,
-				APIToken:        "abcde",
-				AllowUsers:      []string{"user1", "user2"},
+				Verbose:      true,
+				APIToken:     "abcde",
+				AllowUsers:   []string{"user1", "user2"},
+				AllowUserIDs: []int{123, 456},
+				Users: []bot.User{
+					{Name: "user3", Role: bot.RoleViewer},
+					{ID: 789, Role: bot.RoleAdder},
+				},
+				AllowChats:      []int64{-100},
+				WebhookURL:      "https://example.com/bot",
+				WebhookListen:   ":8443",
+				WebhookSecret:   "secret",
+				Concurrency:     8,
+				UpdateTimeout:   30 * time.Second,
+				MaxTorrentSize:  1 << 20,
+				DownloadTimeout: 10 * time.Second,
 				TransmissionURL: "http://example.com:1234",
+				PollInterval:    5 * time.Minute,
 				Locations: []bot.Location{
 					{Name: "loc1", Path: "/path/to/loc1"},
 					{Name: "loc2", Path: "/path/to/loc2"},
 				},
+				Rules: []bot.Rule{
+					{Name: "shows", Location: "loc2", Pattern: `S\d+E\d+`},
+					{Name: "movies", Location: "loc1", Extensions: []string{"mkv", "avi"}, MinSize: 1 << 30},
+				},
+				DataDir: "/var/lib/bot",
 			},
 		},
 	}
@@ -83,3 +152,37 @@ func TestConfig(t *testing.T) {
 		})
 	}
 }
+
+func TestConfig_file(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bot.conf")
+	data := `# comments are ignored
+telegram.api-token abcde
+data.location loc1:/path/to/loc1
+data.location loc2:/path/to/loc2
+data.rule shows:loc2:name~(?i)s\d\de\d\d
+data.rule big:loc1:size>10GiB
+`
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	cfg := new(config)
+	if err := cfg.command().Parse([]string{"-config", path, "-telegram.api-token", "fghij"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := []bot.Rule{
+		{Name: "shows", Location: "loc2", Pattern: `(?i)s\d\de\d\d`},
+		{Name: "big", Location: "loc1", MinSize: 10 << 30},
+	}
+	if !cmp.Equal(want, cfg.Rules) {
+		t.Errorf("unexpected rules, diff = \n%s", cmp.Diff(want, cfg.Rules))
+	}
+	if want, got := 2, len(cfg.Locations); want != got {
+		t.Errorf("unexpected number of locations, want = %d, got = %d", want, got)
+	}
+	// Command line flags take precedence over the config file
+	if want, got := "fghij", cfg.APIToken; want != got {
+		t.Errorf("unexpected API token, want = %q, got = %q", want, got)
+	}
+}
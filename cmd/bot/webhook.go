@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+const (
+	secretTokenHeader = "X-Telegram-Bot-Api-Secret-Token" //nolint:gosec
+
+	webhookShutdownTimeout = 5 * time.Second
+)
+
+type webhookHandler struct {
+	secret  string
+	updates chan<- tgbotapi.Update
+}
+
+func newWebhookHandler(secret string, updates chan<- tgbotapi.Update) *webhookHandler {
+	return &webhookHandler{
+		secret:  secret,
+		updates: updates,
+	}
+}
+
+func (h *webhookHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if h.secret != "" &&
+		subtle.ConstantTimeCompare([]byte(r.Header.Get(secretTokenHeader)), []byte(h.secret)) != 1 {
+		http.Error(w, "invalid secret token", http.StatusUnauthorized)
+		return
+	}
+
+	var u tgbotapi.Update
+	if err := json.NewDecoder(r.Body).Decode(&u); err != nil {
+		http.Error(w, "invalid update", http.StatusBadRequest)
+		return
+	}
+
+	select {
+	case h.updates <- u:
+	case <-r.Context().Done():
+		http.Error(w, "bot is not ready", http.StatusServiceUnavailable)
+	}
+}
+
+type webhookTelegram interface {
+	MakeRequest(string, url.Values) (tgbotapi.APIResponse, error)
+}
+
+type webhookServer struct {
+	log    *logger
+	tg     webhookTelegram
+	url    string
+	secret string
+	srv    *http.Server
+}
+
+func newWebhookServer(log *logger, tg webhookTelegram, listen, webhookURL, secret string,
+	updates chan<- tgbotapi.Update) *webhookServer {
+	return &webhookServer{
+		log:    log,
+		tg:     tg,
+		url:    webhookURL,
+		secret: secret,
+		srv: &http.Server{
+			Addr:              listen,
+			Handler:           newWebhookHandler(secret, updates),
+			ReadHeaderTimeout: 10 * time.Second,
+		},
+	}
+}
+
+// Run starts the webhook HTTP server and registers the webhook with Telegram.
+// The webhook is removed as soon as ctx is cancelled.
+func (s *webhookServer) Run(ctx context.Context) error {
+	errCh := make(chan error, 1)
+	go func() {
+		if err := s.srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			errCh <- err
+		}
+		close(errCh)
+	}()
+
+	v := url.Values{}
+	v.Add("url", s.url)
+	if s.secret != "" {
+		v.Add("secret_token", s.secret)
+	}
+	if _, err := s.tg.MakeRequest("setWebhook", v); err != nil {
+		s.shutdown()
+		return fmt.Errorf("setWebhook: %v", err)
+	}
+	s.log.Infof("listening for updates on %s, webhook is set to %q", s.srv.Addr, s.url)
+
+	var err error
+	select {
+	case <-ctx.Done():
+	case err = <-errCh:
+		if err != nil {
+			err = fmt.Errorf("webhook server: %v", err)
+		}
+	}
+
+	if _, err := s.tg.MakeRequest("deleteWebhook", url.Values{}); err != nil {
+		s.log.Infof("failed to delete webhook: %v", err)
+	}
+	s.shutdown()
+
+	return err
+}
+
+func (s *webhookServer) shutdown() {
+	ctx, cancel := context.WithTimeout(context.Background(), webhookShutdownTimeout)
+	defer cancel()
+
+	if err := s.srv.Shutdown(ctx); err != nil {
+		s.log.Infof("failed to shutdown webhook server: %v", err)
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+func TestWebhookHandler(t *testing.T) {
+	var tests = []struct {
+		name       string
+		method     string
+		secret     string
+		body       string
+		wantStatus int
+		wantUpdate bool
+	}{
+		{
+			name:       "ok",
+			method:     http.MethodPost,
+			secret:     "secret",
+			body:       `{"update_id": 10, "message": {"message_id": 1, "text": "hello"}}`,
+			wantStatus: http.StatusOK,
+			wantUpdate: true,
+		},
+		{
+			name:       "invalid_method",
+			method:     http.MethodGet,
+			secret:     "secret",
+			wantStatus: http.StatusMethodNotAllowed,
+		},
+		{
+			name:       "invalid_secret",
+			method:     http.MethodPost,
+			secret:     "not a secret",
+			body:       `{"update_id": 10}`,
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "invalid_update",
+			method:     http.MethodPost,
+			secret:     "secret",
+			body:       `not a json`,
+			wantStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			updates := make(chan tgbotapi.Update, 1)
+			h := newWebhookHandler("secret", updates)
+
+			req := httptest.NewRequest(tc.method, "/bot", strings.NewReader(tc.body))
+			req.Header.Set(secretTokenHeader, tc.secret)
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+
+			if want, got := tc.wantStatus, rec.Code; want != got {
+				t.Errorf("unexpected status code, want = %d, got = %d", want, got)
+			}
+			select {
+			case u := <-updates:
+				if !tc.wantUpdate {
+					t.Fatalf("unexpected update %d", u.UpdateID)
+				}
+				if u.UpdateID != 10 || u.Message == nil || u.Message.Text != "hello" {
+					t.Errorf("unexpected update %+v", u)
+				}
+			default:
+				if tc.wantUpdate {
+					t.Errorf("expected an update, got none")
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,38 @@
+package bot
+
+import (
+	"math/rand"
+	"time"
+)
+
+// backoff implements capped exponential backoff with jitter.
+type backoff struct {
+	min time.Duration
+	max time.Duration
+
+	attempt int
+}
+
+func newBackoff(min, max time.Duration) *backoff {
+	return &backoff{min: min, max: max}
+}
+
+// next returns a delay before the next attempt. The delay is chosen randomly
+// from [d/2, d], where d doubles with every attempt until it reaches max.
+func (b *backoff) next() time.Duration {
+	d := b.max
+	if b.attempt < 63 {
+		if exp := b.min << b.attempt; exp > 0 && exp < b.max {
+			d = exp
+		}
+	}
+	b.attempt++
+
+	half := int64(d / 2)
+	return time.Duration(half + rand.Int63n(int64(d)-half+1)) //nolint:gosec
+}
+
+// reset resets the backoff to its initial state.
+func (b *backoff) reset() {
+	b.attempt = 0
+}
@@ -0,0 +1,36 @@
+package bot
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBackoff(t *testing.T) {
+	bo := newBackoff(100*time.Millisecond, time.Second)
+
+	for i, max := range []time.Duration{
+		100 * time.Millisecond,
+		200 * time.Millisecond,
+		400 * time.Millisecond,
+		800 * time.Millisecond,
+		time.Second,
+		time.Second,
+	} {
+		d := bo.next()
+		if d < max/2 || d > max {
+			t.Errorf("attempt %d: unexpected delay %v, want within [%v, %v]", i, d, max/2, max)
+		}
+	}
+
+	bo.reset()
+	if d := bo.next(); d < 50*time.Millisecond || d > 100*time.Millisecond {
+		t.Errorf("unexpected delay after reset %v", d)
+	}
+
+	for i := 0; i < 100; i++ {
+		bo.next()
+	}
+	if d := bo.next(); d < 500*time.Millisecond || d > time.Second {
+		t.Errorf("expected the delay to be capped, got %v", d)
+	}
+}
@@ -1,28 +1,36 @@
 package bot
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
+	"io/ioutil"
 	"net/http"
 	"net/url"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
+	"github.com/dustin/go-humanize"
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
 	"github.com/pborzenkov/go-transmission/transmission"
 )
 
 const (
 	callbackIDLen = 36
+	callbackTTL   = time.Hour
+
+	forbiddenText = "Sorry, you are not allowed to do that 🙅"
 )
 
 // Telegram defines an interface that telegram client must implement in order
 // to be usable by this bot.
 type Telegram interface {
 	MakeRequest(string, url.Values) (tgbotapi.APIResponse, error)
-	GetUpdates(tgbotapi.UpdateConfig) ([]tgbotapi.Update, error)
 	Send(tgbotapi.Chattable) (tgbotapi.Message, error)
 	GetFileDirectURL(string) (string, error)
 	AnswerCallbackQuery(tgbotapi.CallbackConfig) (tgbotapi.APIResponse, error)
@@ -38,8 +46,15 @@ type Transmission interface {
 	SetSession(context.Context, *transmission.SetSessionReq) error
 	StartTorrents(context.Context, transmission.Identifier) error
 	StopTorrents(context.Context, transmission.Identifier) error
+	VerifyTorrents(context.Context, transmission.Identifier) error
+	ReannounceTorrents(context.Context, transmission.Identifier) error
 	GetTorrents(context.Context, transmission.Identifier, ...transmission.TorrentField) ([]*transmission.Torrent, error)
 	RemoveTorrents(context.Context, transmission.Identifier, bool) error
+	SetTorrents(context.Context, transmission.Identifier, *transmission.SetTorrentReq) error
+	SetTorrentsLocation(context.Context, transmission.Identifier, string, bool) error
+	QueueMoveToTop(context.Context, transmission.Identifier) error
+	QueueMoveToBottom(context.Context, transmission.Identifier) error
+	GetFreeSpace(context.Context, string) (int64, error)
 }
 
 // Bot implement transmission telegram bot.
@@ -50,35 +65,78 @@ type Bot struct {
 	trans Transmission
 	http  *http.Client
 
-	admins map[string]struct{}
+	token       string
+	apiEndpoint string
+
+	maxTorrentSize  int64
+	downloadTimeout time.Duration
+
+	username string
+	users    map[string]Role
+	userIDs  map[int]Role
+	chats    map[int64]struct{}
 
 	commands          map[string]*botCommand
 	shouldSetCommands bool
 
 	locations      map[string]string
 	locationsOrder []string
+	rules          []*rule
+
+	notifyInterval time.Duration
+
+	backoffMin time.Duration
+	backoffMax time.Duration
+
+	dispatcher *dispatcher
+
+	store            Store
+	newID            func() string
+	now              func() time.Time
+	callbackHandlers map[string]callbackHandlerFn
+	callbackGuards   map[string]callbackGuardFn
 
-	newID     func() string
-	mu        sync.Mutex
-	callbacks map[string]callbackHandler
+	mu sync.Mutex
+	// chats that have already got a personal list of commands
+	commandsSet map[int64]struct{}
 }
 
 type botCommand struct {
 	description string
+	role        Role
 	handler     func(context.Context, *tgbotapi.Message, string) (tgbotapi.Chattable, error)
 	dontSet     bool
 }
 
-type callbackHandler struct {
-	tmr *time.Timer
-	fn  callbackHandlerFn
-}
+// callbackHandlerFn handles a callback query. The state is the one the
+// callback was registered with.
+type callbackHandlerFn func(ctx context.Context, q *tgbotapi.CallbackQuery,
+	state json.RawMessage) (tgbotapi.Chattable, error)
+
+// callbackGuardFn tells whether the user having the given role may press the
+// button of the callback query. Unlike the role of the callback, it can tell
+// the buttons apart.
+type callbackGuardFn func(q *tgbotapi.CallbackQuery, state json.RawMessage, role Role) bool
 
-type callbackHandlerFn func(ctx context.Context, q *tgbotapi.CallbackQuery) (tgbotapi.Chattable, error)
+// Kinds of the callback handlers. They are saved to the store, so don't ever
+// change them.
+const (
+	callbackAddTorrent     = "add_torrent"
+	callbackRemoveTorrents = "remove_torrents"
+	callbackListPage       = "list_page"
+	callbackTorrentInfo    = "torrent_info"
+	callbackFiles          = "files"
+	callbackMoveTorrents   = "move_torrents"
+	callbackDuplicate      = "duplicate"
+	callbackRuleOverride   = "rule_override"
+	callbackTurtle         = "turtle"
+	callbackSpeed          = "speed"
+	callbackQueue          = "queue"
+)
 
 // New returns new instance of the Bot with the given token that talks to
-// Transmission client using transmission.
-func New(tg Telegram, transmission Transmission, opts ...Option) *Bot {
+// Transmission client using trans.
+func New(tg Telegram, trans Transmission, opts ...Option) *Bot {
 	conf := defaultConfig()
 	for _, opt := range opts {
 		opt.apply(conf)
@@ -88,120 +146,373 @@ func New(tg Telegram, transmission Transmission, opts ...Option) *Bot {
 		log: conf.Log,
 
 		tg:                tg,
-		trans:             transmission,
+		trans:             trans,
 		http:              conf.HTTPClient,
-		admins:            make(map[string]struct{}),
+		token:             conf.Token,
+		apiEndpoint:       conf.APIEndpoint,
+		maxTorrentSize:    conf.MaxTorrentSize,
+		downloadTimeout:   conf.DownloadTimeout,
+		username:          conf.Username,
+		users:             make(map[string]Role),
+		userIDs:           make(map[int]Role),
+		chats:             make(map[int64]struct{}),
 		shouldSetCommands: conf.SetCommands,
 
 		locations:      make(map[string]string, len(conf.Locations)),
 		locationsOrder: make([]string, 0, len(conf.Locations)),
 
-		newID:     conf.NewCallbackID,
-		callbacks: make(map[string]callbackHandler),
+		notifyInterval: conf.NotifyInterval,
+
+		backoffMin: conf.BackoffMin,
+		backoffMax: conf.BackoffMax,
+
+		store: conf.Store,
+		newID: conf.NewCallbackID,
+		now:   conf.Now,
+
+		commandsSet: make(map[int64]struct{}),
+	}
+	if b.store == nil {
+		b.store = newMemoryStore()
 	}
+	b.dispatcher = newDispatcher(conf.Concurrency, conf.UpdateTimeout, b.handleUpdate)
 	for _, u := range conf.AllowedUsers {
-		b.admins[u] = struct{}{}
+		b.addUser(User{Name: u, Role: RoleAdmin})
+	}
+	for _, id := range conf.AllowedUserIDs {
+		b.addUser(User{ID: id, Role: RoleAdmin})
+	}
+	for _, u := range conf.Users {
+		b.addUser(u)
+	}
+	for _, c := range conf.AllowedChats {
+		b.chats[c] = struct{}{}
 	}
 	for _, l := range conf.Locations {
 		b.locations[l.Name] = l.Path
 		b.locationsOrder = append(b.locationsOrder, l.Name)
 	}
+	for _, r := range conf.Rules {
+		if _, ok := b.locations[r.Location]; !ok {
+			b.log.Infof("ignoring rule %q: unknown location %q", r.Name, r.Location)
+			continue
+		}
+		rr, err := newRule(r)
+		if err != nil {
+			b.log.Infof("ignoring rule %q: %v", r.Name, err)
+			continue
+		}
+		b.rules = append(b.rules, rr)
+	}
 
 	b.commands = map[string]*botCommand{
 		"start": {
 			dontSet: true,
+			role:    RoleViewer,
 			handler: func(_ context.Context, m *tgbotapi.Message, _ string) (tgbotapi.Chattable, error) {
 				return reply(m, withText("Drop me a magnet link/torrent URL or a torrent file.")), nil
 			},
 		},
 		"checkport": {
 			description: "Check if the incoming port is open",
+			role:        RoleViewer,
 			handler: func(ctx context.Context, m *tgbotapi.Message, _ string) (tgbotapi.Chattable, error) {
 				return b.checkPort(ctx, m)
 			},
 		},
 		"stats": {
 			description: "Show session statistics",
+			role:        RoleViewer,
 			handler: func(ctx context.Context, m *tgbotapi.Message, _ string) (tgbotapi.Chattable, error) {
 				return b.stats(ctx, m)
 			},
 		},
+		"space": {
+			description: "Show free space in the download locations",
+			role:        RoleViewer,
+			handler: func(ctx context.Context, m *tgbotapi.Message, _ string) (tgbotapi.Chattable, error) {
+				return b.space(ctx, m)
+			},
+		},
 		"turtleon": {
 			description: "Enable turtle mode",
+			role:        RoleAdmin,
 			handler: func(ctx context.Context, m *tgbotapi.Message, _ string) (tgbotapi.Chattable, error) {
 				return b.setTurtle(ctx, m, true)
 			},
 		},
 		"turtleoff": {
 			description: "Disable turtle mode",
+			role:        RoleAdmin,
 			handler: func(ctx context.Context, m *tgbotapi.Message, _ string) (tgbotapi.Chattable, error) {
 				return b.setTurtle(ctx, m, false)
 			},
 		},
+		"turtle": {
+			description: "Show and edit turtle mode speeds and schedule (e.g. /turtle down=3M up=500K)",
+			role:        RoleAdmin,
+			handler:     b.turtle,
+		},
 		"resume": {
 			description: "Resume specified torrents",
+			role:        RoleAdmin,
 			handler:     b.resumeTorrents,
 		},
 		"stop": {
 			description: "Stop specified torrents",
+			role:        RoleAdmin,
 			handler:     b.stopTorrents,
 		},
 		"list": {
-			description: "List torrents",
+			description: "List torrents (e.g. /list status:downloading sort:ratio desc)",
+			role:        RoleViewer,
 			handler:     b.listTorrents,
 		},
+		"info": {
+			description: "Show torrent details",
+			role:        RoleViewer,
+			handler:     b.torrentInfo,
+		},
+		"files": {
+			description: "Show torrent files",
+			role:        RoleViewer,
+			handler:     b.listFiles,
+		},
+		"move": {
+			description: "Move torrents data to another location",
+			role:        RoleAdmin,
+			handler:     b.moveTorrents,
+		},
 		"remove": {
 			description: "Remove torrents",
+			role:        RoleAdmin,
 			handler:     b.removeTorrents,
 		},
+		"speed": {
+			description: "Show or change global speed limits (e.g. /speed down=8M up=1M)",
+			role:        RoleAdmin,
+			handler:     b.speed,
+		},
+		"limit": {
+			description: "Limit torrents speed (e.g. /limit 1 2 down=2M up=500K, /limit 1 off)",
+			role:        RoleAdmin,
+			handler:     b.limitTorrents,
+		},
+		"queue": {
+			description: "Show or reorder the download queue, or change its size (e.g. /queue size=3)",
+			role:        RoleAdmin,
+			handler:     b.queue,
+		},
+		"priority": {
+			description: "Set torrents bandwidth priority (e.g. /priority 1 2 high)",
+			role:        RoleAdmin,
+			handler:     b.prioritizeTorrents,
+		},
+		"seedpolicy": {
+			description: "Show or change when torrents stop seeding (e.g. /seedpolicy ratio=2 idle=60m)",
+			role:        RoleAdmin,
+			handler:     b.seedPolicy,
+		},
+	}
+	b.callbackHandlers = map[string]callbackHandlerFn{
+		callbackAddTorrent:     b.addTorrentCallback,
+		callbackRemoveTorrents: b.removeTorrentsCallback,
+		callbackListPage:       b.listPageCallback,
+		callbackTorrentInfo:    b.torrentInfoCallback,
+		callbackFiles:          b.filesCallback,
+		callbackMoveTorrents:   b.moveTorrentsCallback,
+		callbackDuplicate:      b.duplicateCallback,
+		callbackRuleOverride:   b.ruleOverrideCallback,
+		callbackTurtle:         b.turtleCallback,
+		callbackSpeed:          b.speedCallback,
+		callbackQueue:          b.queueCallback,
+	}
+	b.callbackGuards = map[string]callbackGuardFn{
+		callbackTorrentInfo:  torrentInfoGuard,
+		callbackFiles:        filesGuard,
+		callbackDuplicate:    b.duplicateGuard,
+		callbackRuleOverride: ruleOverrideGuard,
+		callbackMoveTorrents: moveTorrentsGuard,
 	}
 
 	return b
 }
 
-// Run runs the bot until ctx is cancelled.
+// Run runs the bot until ctx is cancelled. Updates are received from Telegram
+// using long polling.
 func (b *Bot) Run(ctx context.Context) {
-	if b.shouldSetCommands {
-		b.setCommands(ctx)
-	}
+	wg := b.start(ctx)
+	defer wg.Wait()
+	defer b.dispatcher.wait()
 
 	offset := 0
+	bo := newBackoff(b.backoffMin, b.backoffMax)
+	failures := 0
 
 	for {
-		select {
-		case <-ctx.Done():
-			return
-		default:
-		}
-
-		// TODO: can't be interrupted without context support
-		updates, err := b.tg.GetUpdates(tgbotapi.UpdateConfig{
+		updates, err := b.getUpdates(ctx, tgbotapi.UpdateConfig{
 			Offset:  offset,
 			Timeout: 10,
 		})
+		if ctx.Err() != nil {
+			return
+		}
 		if err != nil {
-			b.log.Infof("can't receive updates from Telegram API: %v", err)
-			// TODO: handle context
-			time.Sleep(100 * time.Millisecond)
+			if failures == 0 {
+				b.log.Infof("can't receive updates from Telegram API, switching to degraded mode: %v", err)
+			}
+			failures++
+
+			delay := bo.next()
+			b.log.Debugf("failed to receive updates from Telegram API (attempt %d), retrying in %v: %v",
+				failures, delay, err)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(delay):
+			}
 			continue
 		}
+		if failures > 0 {
+			b.log.Infof("receiving updates from Telegram API again after %d failed attempts, "+
+				"switching to healthy mode", failures)
+			failures = 0
+			bo.reset()
+		}
 
 		for _, u := range updates {
 			if u.UpdateID >= offset {
 				offset = u.UpdateID + 1
 			}
-			reply := b.processUpdate(ctx, u)
-			if reply != nil {
-				_, err := b.tg.Send(reply)
-				if err != nil {
-					b.log.Infof("failed to send reply to %d: %v", u.UpdateID, err)
-				}
-			}
+			b.dispatcher.dispatch(ctx, u)
 		}
 	}
 }
 
+// getUpdates receives new updates from Telegram. Telegram client doesn't
+// support contexts, so the long-poll request is sent directly, which lets
+// cancelling ctx abort it. It's safe to drop updates received by the aborted
+// request, as updates are confirmed only by the subsequent request with the
+// greater offset. Thus Telegram will deliver them again.
+func (b *Bot) getUpdates(ctx context.Context, cfg tgbotapi.UpdateConfig) ([]tgbotapi.Update, error) {
+	v := url.Values{}
+	if cfg.Offset != 0 {
+		v.Add("offset", strconv.Itoa(cfg.Offset))
+	}
+	if cfg.Limit > 0 {
+		v.Add("limit", strconv.Itoa(cfg.Limit))
+	}
+	if cfg.Timeout > 0 {
+		v.Add("timeout", strconv.Itoa(cfg.Timeout))
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", fmt.Sprintf(b.apiEndpoint, b.token, "getUpdates"),
+		strings.NewReader(v.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := b.http.Do(req)
+	var uerr *url.Error
+	switch {
+	case errors.As(err, &uerr):
+		// The URL contains the bot token, so don't let it leak to the logs
+		return nil, uerr.Err
+	case err != nil:
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var apiResp tgbotapi.APIResponse
+	if err := json.NewDecoder(resp.Body).Decode(&apiResp); err != nil {
+		return nil, err
+	}
+	if !apiResp.Ok {
+		return nil, errors.New(apiResp.Description)
+	}
+	var updates []tgbotapi.Update
+	if err := json.Unmarshal(apiResp.Result, &updates); err != nil {
+		return nil, err
+	}
+
+	return updates, nil
+}
+
+// Serve runs the bot until ctx is cancelled. Unlike Run, it doesn't poll
+// Telegram for updates, but processes updates received from the provided
+// channel instead (e.g. the ones pushed to a webhook).
+func (b *Bot) Serve(ctx context.Context, updates <-chan tgbotapi.Update) {
+	wg := b.start(ctx)
+	defer wg.Wait()
+	defer b.dispatcher.wait()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case u := <-updates:
+			b.dispatcher.dispatch(ctx, u)
+		}
+	}
+}
+
+func (b *Bot) start(ctx context.Context) *sync.WaitGroup {
+	if b.shouldSetCommands {
+		b.setCommands(ctx)
+	}
+
+	wg := new(sync.WaitGroup)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		b.watchTorrents(ctx)
+	}()
+
+	return wg
+}
+
+func (b *Bot) handleUpdate(ctx context.Context, u tgbotapi.Update) {
+	reply := b.processUpdate(ctx, u)
+	if reply == nil {
+		return
+	}
+	if _, err := b.tg.Send(reply); err != nil {
+		b.log.Infof("failed to send reply to %d: %v", u.UpdateID, err)
+	}
+}
+
+type botCommandScope struct {
+	Type   string `json:"type"`
+	ChatID int64  `json:"chat_id,omitempty"`
+}
+
+// setCommands uploads a list of commands available to viewers as the default
+// one, while users with more permissions get personal lists of commands as
+// soon as their chat is known.
 func (b *Bot) setCommands(_ context.Context) {
+	b.uploadCommands(botCommandScope{Type: "default"}, RoleViewer)
+	for id, role := range b.userIDs {
+		b.setUserCommands(int64(id), role)
+	}
+}
+
+func (b *Bot) setUserCommands(chatID int64, role Role) {
+	if !b.shouldSetCommands || role <= RoleViewer {
+		return
+	}
+
+	b.mu.Lock()
+	_, ok := b.commandsSet[chatID]
+	b.commandsSet[chatID] = struct{}{}
+	b.mu.Unlock()
+	if ok {
+		return
+	}
+
+	b.uploadCommands(botCommandScope{Type: "chat", ChatID: chatID}, role)
+}
+
+func (b *Bot) uploadCommands(scope botCommandScope, role Role) {
 	type tgBotCommand struct {
 		Command     string `json:"command"`
 		Description string `json:"description"`
@@ -209,7 +520,7 @@ func (b *Bot) setCommands(_ context.Context) {
 	var commands []tgBotCommand
 
 	for name, c := range b.commands {
-		if c.dontSet {
+		if c.dontSet || c.role > role {
 			continue
 		}
 		commands = append(commands, tgBotCommand{
@@ -217,21 +528,45 @@ func (b *Bot) setCommands(_ context.Context) {
 			Description: c.description,
 		})
 	}
+	sort.Slice(commands, func(i, j int) bool {
+		return commands[i].Command < commands[j].Command
+	})
 	data, err := json.Marshal(commands)
 	if err != nil {
 		b.log.Infof("failed to marshal a list of the bot commands: %v", err)
 		return
 	}
+	scopeData, err := json.Marshal(scope)
+	if err != nil {
+		b.log.Infof("failed to marshal the bot commands scope: %v", err)
+		return
+	}
 
-	b.log.Debugf("uploading a list of %d commands", len(commands))
+	b.log.Debugf("uploading a list of %d commands for %s scope", len(commands), scopeData)
 
 	v := url.Values{}
 	v.Add("commands", string(data))
+	v.Add("scope", string(scopeData))
 	if _, err := b.tg.MakeRequest("setMyCommands", v); err != nil {
 		b.log.Infof("failed to upload a list of the bot commands: %v", err)
 	}
 }
 
+func getChat(u tgbotapi.Update) *tgbotapi.Chat {
+	if u.Message != nil {
+		return u.Message.Chat
+	}
+	if u.CallbackQuery != nil && u.CallbackQuery.Message != nil {
+		return u.CallbackQuery.Message.Chat
+	}
+
+	return nil
+}
+
+func isGroup(c *tgbotapi.Chat) bool {
+	return c != nil && (c.IsGroup() || c.IsSuperGroup())
+}
+
 func getUser(u tgbotapi.Update) *tgbotapi.User {
 	if u.Message != nil && u.Message.From != nil {
 		return u.Message.From
@@ -243,37 +578,118 @@ func getUser(u tgbotapi.Update) *tgbotapi.User {
 	return nil
 }
 
+func (b *Bot) addUser(u User) {
+	if u.ID != 0 && u.Role > b.userIDs[u.ID] {
+		b.userIDs[u.ID] = u.Role
+	}
+	if u.Name != "" && u.Role > b.users[u.Name] {
+		b.users[u.Name] = u.Role
+	}
+}
+
+// userRole returns a role of the user, or 0 if the user is unknown.
+func (b *Bot) userRole(u *tgbotapi.User) Role {
+	role := b.userIDs[u.ID]
+	if u.UserName != "" && b.users[u.UserName] > role {
+		role = b.users[u.UserName]
+	}
+	return role
+}
+
+// isOwnerOrAdmin tells whether the user is either an admin or the one with the
+// owner ID, e.g. the user who has added a torrent.
+func isOwnerOrAdmin(u *tgbotapi.User, role Role, owner int) bool {
+	return role >= RoleAdmin || (owner != 0 && u != nil && u.ID == owner)
+}
+
 func (b *Bot) processUpdate(ctx context.Context, u tgbotapi.Update) tgbotapi.Chattable {
 	user := getUser(u)
 	if user == nil {
 		return nil
 	}
 
-	if _, ok := b.admins[user.UserName]; !ok {
+	chat := getChat(u)
+	inGroup := isGroup(chat)
+	if inGroup {
+		if _, ok := b.chats[chat.ID]; !ok {
+			b.log.Debugf("ignoring update from unknown chat %q (ID %d)", chat.Title, chat.ID)
+			return nil
+		}
+		if u.Message != nil && !b.isAddressedToMe(u.Message) {
+			return nil
+		}
+	}
+
+	role := b.userRole(user)
+	if role == 0 {
+		b.log.Infof("rejecting update from unknown user %q (ID %d)", user.UserName, user.ID)
+		if u.Message == nil || inGroup {
+			return nil
+		}
 		return reply(u.Message, withText("Sorry, I don't know you..."))
 	}
+	if u.Message != nil && u.Message.Chat != nil && u.Message.Chat.IsPrivate() {
+		b.setUserCommands(u.Message.Chat.ID, role)
+	}
 
 	switch {
 	case u.Message != nil && u.Message.IsCommand():
-		return b.handleCommand(ctx, u.Message)
+		return b.handleCommand(ctx, u.Message, role)
+	case u.Message != nil && (u.Message.Text != "" || u.Message.Caption != "" || u.Message.Document != nil) &&
+		role < RoleAdder:
+		return reply(u.Message, withText(forbiddenText))
 	case u.Message != nil && u.Message.Text != "":
 		return b.handleText(ctx, u.Message)
 	case u.Message != nil && u.Message.Document != nil:
 		return b.handleDocument(ctx, u.Message)
+	case u.Message != nil && u.Message.Caption != "":
+		return b.handleText(ctx, u.Message)
 	case u.CallbackQuery != nil:
-		return b.handleCallback(ctx, u.CallbackQuery)
+		return b.handleCallback(ctx, u.CallbackQuery, role)
 	default:
 		return nil
 	}
 }
 
-func (b *Bot) handleCommand(ctx context.Context, m *tgbotapi.Message) tgbotapi.Chattable {
-	cmd, ok := b.commands[m.Command()]
+// isAddressedToMe checks whether a message posted to a group is meant for the
+// bot. Commands must either be addressed to the bot explicitly or not be
+// addressed to anyone, while text and documents must contain torrents or be
+// replies to the bot's messages.
+func (b *Bot) isAddressedToMe(m *tgbotapi.Message) bool {
+	if m.IsCommand() {
+		cmd := m.CommandWithAt()
+		i := strings.Index(cmd, "@")
+		return i == -1 || b.username == "" || strings.EqualFold(cmd[i+1:], b.username)
+	}
+	if r := m.ReplyToMessage; r != nil && r.From != nil && b.username != "" &&
+		strings.EqualFold(r.From.UserName, b.username) {
+		return true
+	}
+	if m.Document != nil {
+		return isTorrentDocument(m.Document)
+	}
+
+	return len(extractLinks(m)) > 0
+}
+
+func (b *Bot) handleCommand(ctx context.Context, m *tgbotapi.Message, role Role) tgbotapi.Chattable {
+	name, args := m.Command(), m.CommandArguments()
+	cmd, ok := b.commands[name]
+	if !ok {
+		// Commands like /info_12 are clickable in messages, unlike /info 12
+		if i := strings.Index(name, "_"); i > 0 && strings.TrimSpace(args) == "" {
+			name, args = name[:i], name[i+1:]
+			cmd, ok = b.commands[name]
+		}
+	}
 	if !ok {
 		return reply(m, withText("Unknown command"))
 	}
+	if cmd.role > role {
+		return reply(m, withText(forbiddenText))
+	}
 
-	r, err := cmd.handler(ctx, m, m.CommandArguments())
+	r, err := cmd.handler(ctx, m, args)
 	if err != nil {
 		return reply(m, withError(err))
 	}
@@ -281,9 +697,19 @@ func (b *Bot) handleCommand(ctx context.Context, m *tgbotapi.Message) tgbotapi.C
 }
 
 func (b *Bot) handleText(ctx context.Context, m *tgbotapi.Message) tgbotapi.Chattable {
-	r, err := b.addTorrent(ctx, m, &transmission.AddTorrentReq{
-		URL: transmission.OptString(m.Text),
-	})
+	links := extractLinks(m)
+	var (
+		r   tgbotapi.Chattable
+		err error
+	)
+	switch len(links) {
+	case 0:
+		return reply(m, withText("I don't see any magnet links or links to .torrent files here"))
+	case 1:
+		r, err = b.addTorrent(ctx, m, &torrentSource{URL: links[0]})
+	default:
+		r, err = b.addTorrents(ctx, m, links)
+	}
 	if err != nil {
 		return reply(m, withError(err))
 	}
@@ -291,49 +717,110 @@ func (b *Bot) handleText(ctx context.Context, m *tgbotapi.Message) tgbotapi.Chat
 }
 
 func (b *Bot) handleDocument(ctx context.Context, m *tgbotapi.Message) tgbotapi.Chattable {
-	furl, err := b.tg.GetFileDirectURL(m.Document.FileID)
+	if !isTorrentDocument(m.Document) {
+		return reply(m, withText("That's not a torrent file"))
+	}
+	if int64(m.Document.FileSize) > b.maxTorrentSize {
+		return reply(m, b.tooBigText())
+	}
+
+	data, err := b.downloadDocument(ctx, m.Document)
+	switch {
+	case errors.Is(err, errTooBig):
+		return reply(m, b.tooBigText())
+	case err != nil:
+		return reply(m, withError(err))
+	}
+
+	r, err := b.addTorrent(ctx, m, &torrentSource{Meta: data})
 	if err != nil {
 		return reply(m, withError(err))
 	}
+	return r
+}
+
+var errTooBig = errors.New("file is too big")
+
+// downloadDocument downloads the document from Telegram. Documents larger than
+// the configured limit are not downloaded.
+func (b *Bot) downloadDocument(ctx context.Context, d *tgbotapi.Document) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, b.downloadTimeout)
+	defer cancel()
+
+	furl, err := b.tg.GetFileDirectURL(d.FileID)
+	if err != nil {
+		return nil, err
+	}
 	req, err := http.NewRequestWithContext(ctx, "GET", furl, nil)
 	if err != nil {
-		return reply(m, withError(err))
+		return nil, err
 	}
 	resp, err := b.http.Do(req)
-	if err != nil {
-		return reply(m, withError(err))
+	var uerr *url.Error
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return nil, errors.New("timed out downloading the file from Telegram")
+	case errors.As(err, &uerr):
+		// The URL contains the bot token, so don't let it leak to the chat
+		return nil, uerr.Err
+	case err != nil:
+		return nil, err
 	}
 	defer resp.Body.Close()
 
-	data := new(bytes.Buffer)
-	if _, err := io.Copy(data, resp.Body); err != nil {
-		return reply(m, withError(err))
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Telegram responded with %q", resp.Status) //nolint:stylecheck
 	}
-
-	r, err := b.addTorrent(ctx, m, &transmission.AddTorrentReq{
-		Meta: data,
-	})
+	if resp.ContentLength > b.maxTorrentSize {
+		return nil, errTooBig
+	}
+	data, err := ioutil.ReadAll(io.LimitReader(resp.Body, b.maxTorrentSize+1))
 	if err != nil {
-		return reply(m, withError(err))
+		return nil, err
 	}
-	return r
+	if int64(len(data)) > b.maxTorrentSize {
+		return nil, errTooBig
+	}
+
+	return data, nil
 }
 
-func (b *Bot) addCallbackHandler(fn callbackHandlerFn) string {
-	b.mu.Lock()
-	defer b.mu.Unlock()
+func (b *Bot) tooBigText() replyOption {
+	return withText(fmt.Sprintf("That's too big for a torrent file, I only accept files up to %s",
+		humanize.IBytes(uint64(b.maxTorrentSize))))
+}
+
+// isTorrentDocument checks whether the document looks like a torrent file.
+func isTorrentDocument(d *tgbotapi.Document) bool {
+	return d.MimeType == "application/x-bittorrent" || strings.HasSuffix(strings.ToLower(d.FileName), ".torrent")
+}
+
+// addCallback registers a callback of the given kind that can be invoked by
+// users having at least the given role. The state is passed to the callback
+// handler as is, thus it must be serializable to JSON.
+func (b *Bot) addCallback(kind string, role Role, state interface{}) (string, error) {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return "", err
+	}
 
 	id := b.newID()
-	b.callbacks[id] = callbackHandler{
-		tmr: time.AfterFunc(time.Hour, func() {
-			b.mu.Lock()
-			delete(b.callbacks, id)
-			b.mu.Unlock()
-		}),
-		fn: fn,
+	if err := b.store.PutCallback(id, &Callback{
+		Kind:      kind,
+		Role:      role,
+		State:     data,
+		ExpiresAt: time.Now().Add(callbackTTL),
+	}); err != nil {
+		return "", err
 	}
 
-	return id
+	return id, nil
+}
+
+// allowCallback checks the guard of the callback, if there is one.
+func (b *Bot) allowCallback(cb *tgbotapi.CallbackQuery, stored *Callback, role Role) bool {
+	guard, ok := b.callbackGuards[stored.Kind]
+	return !ok || guard(cb, stored.State, role)
 }
 
 func getCallbackID(cb *tgbotapi.CallbackQuery) string {
@@ -345,21 +832,41 @@ func getCallbackID(cb *tgbotapi.CallbackQuery) string {
 	return id
 }
 
-func (b *Bot) handleCallback(ctx context.Context, cb *tgbotapi.CallbackQuery) tgbotapi.Chattable {
+// handleCallback invokes a handler of the callback query. Callback queries
+// from the same chat are processed sequentially, so there is no need to
+// protect the callback from being invoked concurrently.
+func (b *Bot) handleCallback(ctx context.Context, cb *tgbotapi.CallbackQuery, role Role) tgbotapi.Chattable {
 	id := getCallbackID(cb)
-	b.mu.Lock()
-	handler, ok := b.callbacks[id]
-	delete(b.callbacks, id)
-	b.mu.Unlock()
+	stored, loadErr := b.store.GetCallback(id)
+	if stored != nil && stored.ExpiresAt.Before(time.Now()) {
+		stored = nil
+	}
+	if stored != nil && (stored.Role > role || !b.allowCallback(cb, stored, role)) {
+		// Leave the buttons alone, so that someone else can use them
+		if _, err := b.tg.AnswerCallbackQuery(tgbotapi.NewCallback(cb.ID, forbiddenText)); err != nil {
+			b.log.Infof("failed to answer callback query: %v", err)
+		}
+		return nil
+	}
 	if _, err := b.tg.AnswerCallbackQuery(tgbotapi.NewCallback(cb.ID, "")); err != nil {
 		return edit(cb.Message, withError(err))
 	}
-	if !ok {
+	if loadErr != nil {
+		return edit(cb.Message, withError(loadErr))
+	}
+	if stored == nil {
 		return edit(cb.Message, withText("Looks like these buttons no longer work ¯\\_(ツ)_/¯"))
 	}
-	handler.tmr.Stop()
+	if err := b.store.DeleteCallback(id); err != nil {
+		b.log.Infof("failed to delete callback %q: %v", id, err)
+	}
 
-	r, err := handler.fn(ctx, cb)
+	handler, ok := b.callbackHandlers[stored.Kind]
+	if !ok {
+		b.log.Infof("unknown kind of callback %q: %q", id, stored.Kind)
+		return edit(cb.Message, withText("Looks like these buttons no longer work ¯\\_(ツ)_/¯"))
+	}
+	r, err := handler(ctx, cb, stored.State)
 	if err != nil {
 		return edit(cb.Message, withError(err))
 	}
@@ -66,21 +66,6 @@ func (mr *MockTelegramMockRecorder) GetFileDirectURL(arg0 interface{}) *gomock.C
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetFileDirectURL", reflect.TypeOf((*MockTelegram)(nil).GetFileDirectURL), arg0)
 }
 
-// GetUpdates mocks base method
-func (m *MockTelegram) GetUpdates(arg0 tgbotapi.UpdateConfig) ([]tgbotapi.Update, error) {
-	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetUpdates", arg0)
-	ret0, _ := ret[0].([]tgbotapi.Update)
-	ret1, _ := ret[1].(error)
-	return ret0, ret1
-}
-
-// GetUpdates indicates an expected call of GetUpdates
-func (mr *MockTelegramMockRecorder) GetUpdates(arg0 interface{}) *gomock.Call {
-	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUpdates", reflect.TypeOf((*MockTelegram)(nil).GetUpdates), arg0)
-}
-
 // MakeRequest mocks base method
 func (m *MockTelegram) MakeRequest(arg0 string, arg1 url.Values) (tgbotapi.APIResponse, error) {
 	m.ctrl.T.Helper()
@@ -149,6 +134,21 @@ func (mr *MockTransmissionMockRecorder) AddTorrent(arg0, arg1 interface{}) *gomo
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddTorrent", reflect.TypeOf((*MockTransmission)(nil).AddTorrent), arg0, arg1)
 }
 
+// GetFreeSpace mocks base method
+func (m *MockTransmission) GetFreeSpace(arg0 context.Context, arg1 string) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetFreeSpace", arg0, arg1)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetFreeSpace indicates an expected call of GetFreeSpace
+func (mr *MockTransmissionMockRecorder) GetFreeSpace(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetFreeSpace", reflect.TypeOf((*MockTransmission)(nil).GetFreeSpace), arg0, arg1)
+}
+
 // GetSession mocks base method
 func (m *MockTransmission) GetSession(arg0 context.Context, arg1 ...transmission.SessionField) (*transmission.Session, error) {
 	m.ctrl.T.Helper()
@@ -219,6 +219,48 @@ func (mr *MockTransmissionMockRecorder) IsPortOpen(arg0 interface{}) *gomock.Cal
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "IsPortOpen", reflect.TypeOf((*MockTransmission)(nil).IsPortOpen), arg0)
 }
 
+// QueueMoveToBottom mocks base method
+func (m *MockTransmission) QueueMoveToBottom(arg0 context.Context, arg1 transmission.Identifier) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "QueueMoveToBottom", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// QueueMoveToBottom indicates an expected call of QueueMoveToBottom
+func (mr *MockTransmissionMockRecorder) QueueMoveToBottom(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "QueueMoveToBottom", reflect.TypeOf((*MockTransmission)(nil).QueueMoveToBottom), arg0, arg1)
+}
+
+// QueueMoveToTop mocks base method
+func (m *MockTransmission) QueueMoveToTop(arg0 context.Context, arg1 transmission.Identifier) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "QueueMoveToTop", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// QueueMoveToTop indicates an expected call of QueueMoveToTop
+func (mr *MockTransmissionMockRecorder) QueueMoveToTop(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "QueueMoveToTop", reflect.TypeOf((*MockTransmission)(nil).QueueMoveToTop), arg0, arg1)
+}
+
+// ReannounceTorrents mocks base method
+func (m *MockTransmission) ReannounceTorrents(arg0 context.Context, arg1 transmission.Identifier) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ReannounceTorrents", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ReannounceTorrents indicates an expected call of ReannounceTorrents
+func (mr *MockTransmissionMockRecorder) ReannounceTorrents(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReannounceTorrents", reflect.TypeOf((*MockTransmission)(nil).ReannounceTorrents), arg0, arg1)
+}
+
 // RemoveTorrents mocks base method
 func (m *MockTransmission) RemoveTorrents(arg0 context.Context, arg1 transmission.Identifier, arg2 bool) error {
 	m.ctrl.T.Helper()
@@ -247,6 +289,34 @@ func (mr *MockTransmissionMockRecorder) SetSession(arg0, arg1 interface{}) *gomo
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetSession", reflect.TypeOf((*MockTransmission)(nil).SetSession), arg0, arg1)
 }
 
+// SetTorrents mocks base method
+func (m *MockTransmission) SetTorrents(arg0 context.Context, arg1 transmission.Identifier, arg2 *transmission.SetTorrentReq) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetTorrents", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetTorrents indicates an expected call of SetTorrents
+func (mr *MockTransmissionMockRecorder) SetTorrents(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetTorrents", reflect.TypeOf((*MockTransmission)(nil).SetTorrents), arg0, arg1, arg2)
+}
+
+// SetTorrentsLocation mocks base method
+func (m *MockTransmission) SetTorrentsLocation(arg0 context.Context, arg1 transmission.Identifier, arg2 string, arg3 bool) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetTorrentsLocation", arg0, arg1, arg2, arg3)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetTorrentsLocation indicates an expected call of SetTorrentsLocation
+func (mr *MockTransmissionMockRecorder) SetTorrentsLocation(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetTorrentsLocation", reflect.TypeOf((*MockTransmission)(nil).SetTorrentsLocation), arg0, arg1, arg2, arg3)
+}
+
 // StartTorrents mocks base method
 func (m *MockTransmission) StartTorrents(arg0 context.Context, arg1 transmission.Identifier) error {
 	m.ctrl.T.Helper()
@@ -274,3 +344,17 @@ func (mr *MockTransmissionMockRecorder) StopTorrents(arg0, arg1 interface{}) *go
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "StopTorrents", reflect.TypeOf((*MockTransmission)(nil).StopTorrents), arg0, arg1)
 }
+
+// VerifyTorrents mocks base method
+func (m *MockTransmission) VerifyTorrents(arg0 context.Context, arg1 transmission.Identifier) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "VerifyTorrents", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// VerifyTorrents indicates an expected call of VerifyTorrents
+func (mr *MockTransmissionMockRecorder) VerifyTorrents(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "VerifyTorrents", reflect.TypeOf((*MockTransmission)(nil).VerifyTorrents), arg0, arg1)
+}
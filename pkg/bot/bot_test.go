@@ -4,15 +4,20 @@ package bot
 import (
 	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"math/rand"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"path/filepath"
 	"reflect"
 	"regexp"
 	"strconv"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -28,34 +33,131 @@ var (
 func newTestBot(t *testing.T, opts ...Option) (func(...update), *MockTelegram, *MockTransmission) {
 	ctrl := gomock.NewController(t)
 
+	srv := newUpdatesServer(t)
 	tg := NewMockTelegram(ctrl)
 	tr := NewMockTransmission(ctrl)
-	bot := New(tg, tr, append(opts, WithAllowedUsers("admin"))...)
+	bot := New(tg, tr, append(opts, WithAllowedUsers("admin"), WithToken("token"), withAPIEndpoint(srv.endpoint()))...)
 
 	ctx, cancel := context.WithCancel(context.Background())
 	return func(updates ...update) {
-		calls := make([]*gomock.Call, 0, len(updates)+1)
+		handlers := make([]http.HandlerFunc, 0, len(updates)+1)
 		offset := 0
 		for _, u := range updates {
-			calls = append(calls, tg.EXPECT().GetUpdates(tgbotapi.UpdateConfig{
-				Offset:  offset,
-				Timeout: 10,
-			}).Return([]tgbotapi.Update{u.Update}, nil))
+			handlers = append(handlers, respondUpdates(t, offset, u.Update))
 			offset = u.UpdateID + 1
 		}
-		calls = append(calls, tg.EXPECT().GetUpdates(tgbotapi.UpdateConfig{
-			Offset:  offset,
-			Timeout: 10,
-		}).DoAndReturn(func(_ tgbotapi.UpdateConfig) ([]tgbotapi.Update, error) {
+		last := respondUpdates(t, offset)
+		handlers = append(handlers, func(w http.ResponseWriter, r *http.Request) {
+			// Let the bot finish processing of all the updates
+			bot.dispatcher.wait()
 			cancel()
-			return []tgbotapi.Update{}, nil
-		}))
-		gomock.InOrder(calls...)
+			last(w, r)
+		})
+		srv.expect(handlers...)
 
 		bot.Run(ctx)
 	}, tg, tr
 }
 
+// updatesServer mimics Telegram getUpdates method. It handles the requests
+// with the expected handlers in order.
+type updatesServer struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	handlers []http.HandlerFunc
+}
+
+func newUpdatesServer(t *testing.T) *updatesServer {
+	s := new(updatesServer)
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		if len(s.handlers) == 0 {
+			s.mu.Unlock()
+			t.Errorf("unexpected request to %s", r.URL.Path)
+			http.Error(w, "unexpected request", http.StatusInternalServerError)
+			return
+		}
+		h := s.handlers[0]
+		s.handlers = s.handlers[1:]
+		s.mu.Unlock()
+
+		h(w, r)
+	}))
+	t.Cleanup(s.Close)
+
+	return s
+}
+
+func (s *updatesServer) expect(handlers ...http.HandlerFunc) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.handlers = append(s.handlers, handlers...)
+}
+
+// endpoint returns Telegram API endpoint served by s.
+func (s *updatesServer) endpoint() string {
+	return s.URL + "/bot%s/%s"
+}
+
+// respondUpdates returns a handler that expects getUpdates request with the
+// given offset and responds with the updates.
+func respondUpdates(t *testing.T, offset int, updates ...tgbotapi.Update) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Errorf("unexpected error parsing the request: %v", err)
+		}
+		wantOffset := ""
+		if offset != 0 {
+			wantOffset = strconv.Itoa(offset)
+		}
+		if r.URL.Path != "/bottoken/getUpdates" || r.PostForm.Get("offset") != wantOffset ||
+			r.PostForm.Get("timeout") != "10" {
+			t.Errorf("unexpected request to %s with %v, want offset = %d", r.URL.Path, r.PostForm, offset)
+		}
+		respondTelegram(t, w, tgbotapi.APIResponse{Ok: true}, updates)
+	}
+}
+
+// respondTelegram responds with resp, its result is set to the JSON-encoded
+// result.
+func respondTelegram(t *testing.T, w http.ResponseWriter, resp tgbotapi.APIResponse, result interface{}) {
+	var err error
+	if resp.Result, err = json.Marshal(result); err != nil {
+		t.Errorf("unexpected error encoding the result: %v", err)
+	}
+	if err := json.NewEncoder(w).Encode(&resp); err != nil {
+		t.Errorf("unexpected error sending the response: %v", err)
+	}
+}
+
+// newFileServer returns a server that responds with the content to any
+// request.
+func newFileServer(t *testing.T, content string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, err := w.Write([]byte(content)); err != nil {
+			t.Errorf("unexpected error sending the file: %v", err)
+		}
+	}))
+}
+
+// expectNoDuplicates makes the bot believe that Transmission doesn't have
+// any of the torrents being added yet.
+func expectNoDuplicates(tr *MockTransmission) {
+	tr.EXPECT().GetTorrents(gomock.AssignableToTypeOf(ctxType), transmission.All(), transmission.TorrentFieldHash).
+		Return(nil, nil).AnyTimes()
+	tr.EXPECT().GetTorrents(gomock.AssignableToTypeOf(ctxType), gomock.Any(), duplicateFields).
+		Return(nil, nil).AnyTimes()
+}
+
+// expectFreeSpace makes every location, including the default one, look like
+// it has the given amount of free space.
+func expectFreeSpace(tr *MockTransmission, free int64) {
+	tr.EXPECT().GetSession(gomock.AssignableToTypeOf(ctxType), transmission.SessionFieldDownloadDirectory).
+		Return(&transmission.Session{DownloadDirectory: "/downloads"}, nil).AnyTimes()
+	tr.EXPECT().GetFreeSpace(gomock.AssignableToTypeOf(ctxType), gomock.Any()).Return(free, nil).AnyTimes()
+}
+
 type customMatcher struct {
 	name    string
 	matches func(x interface{}) bool
@@ -256,6 +358,33 @@ func withUser(user string) func(u *tgbotapi.Update) {
 	}
 }
 
+func withUserID(id int) func(u *tgbotapi.Update) {
+	return func(u *tgbotapi.Update) {
+		switch {
+		case u.Message != nil:
+			u.Message.From.ID = id
+		case u.CallbackQuery != nil:
+			u.CallbackQuery.From.ID = id
+		}
+	}
+}
+
+func withGroupChat(id int64) func(u *tgbotapi.Update) {
+	return func(u *tgbotapi.Update) {
+		u.Message.Chat.ID = id
+		u.Message.Chat.Type = "supergroup"
+	}
+}
+
+func withReplyTo(from string) func(u *tgbotapi.Update) {
+	return func(u *tgbotapi.Update) {
+		u.Message.ReplyToMessage = &tgbotapi.Message{
+			MessageID: rand.Int(), //nolint:gosec
+			From:      &tgbotapi.User{UserName: from},
+		}
+	}
+}
+
 func withMsgText(text string) func(u *tgbotapi.Update) {
 	return func(u *tgbotapi.Update) {
 		u.Message.Text = text
@@ -278,7 +407,8 @@ func withCommand(cmd string, args ...string) func(u *tgbotapi.Update) {
 func withDocument(id string) func(u *tgbotapi.Update) {
 	return func(u *tgbotapi.Update) {
 		u.Message.Document = &tgbotapi.Document{
-			FileID: id,
+			FileID:   id,
+			FileName: id + ".torrent",
 		}
 	}
 }
@@ -290,6 +420,159 @@ func TestSetCommands(t *testing.T) {
 	run()
 }
 
+func TestRun_backoff(t *testing.T) {
+	ctrl := gomock.NewController(t)
+
+	srv := newUpdatesServer(t)
+	tg := NewMockTelegram(ctrl)
+	tr := NewMockTransmission(ctrl)
+	bot := New(tg, tr, WithToken("token"), withAPIEndpoint(srv.endpoint()),
+		withBackoff(time.Millisecond, 2*time.Millisecond))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	fail := func(w http.ResponseWriter, r *http.Request) {
+		respondTelegram(t, w, tgbotapi.APIResponse{Ok: false, Description: "Bad Gateway"}, nil)
+	}
+	srv.expect(fail, fail, func(w http.ResponseWriter, r *http.Request) {
+		cancel()
+		respondTelegram(t, w, tgbotapi.APIResponse{Ok: true}, []tgbotapi.Update{})
+	})
+
+	bot.Run(ctx)
+}
+
+func TestRun_cancel(t *testing.T) {
+	ctrl := gomock.NewController(t)
+
+	srv := newUpdatesServer(t)
+	tg := NewMockTelegram(ctrl)
+	tr := NewMockTransmission(ctrl)
+	bot := New(tg, tr, WithToken("token"), withAPIEndpoint(srv.endpoint()))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	aborted := make(chan struct{})
+	srv.expect(func(w http.ResponseWriter, r *http.Request) {
+		// The server notices the client has gone only after the body is read
+		if _, err := ioutil.ReadAll(r.Body); err != nil {
+			t.Errorf("unexpected error reading the request: %v", err)
+		}
+		cancel()
+		// The long-poll request is aborted as soon as the context is cancelled
+		<-r.Context().Done()
+		close(aborted)
+	})
+
+	done := make(chan struct{})
+	go func() {
+		bot.Run(ctx)
+		close(done)
+	}()
+
+	for _, ch := range []chan struct{}{done, aborted} {
+		select {
+		case <-ch:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Run didn't abort the request after the context was cancelled")
+		}
+	}
+}
+
+func setCommandsMatcher(scope string, commands ...string) *customMatcher {
+	return &customMatcher{
+		name: fmt.Sprintf("Commands %v for scope %s", commands, scope),
+		matches: func(x interface{}) bool {
+			v, ok := x.(url.Values)
+			if !ok || v.Get("scope") != scope {
+				return false
+			}
+			var got []struct {
+				Command string `json:"command"`
+			}
+			if err := json.Unmarshal([]byte(v.Get("commands")), &got); err != nil {
+				return false
+			}
+			if len(got) != len(commands) {
+				return false
+			}
+			for i := range got {
+				if got[i].Command != commands[i] {
+					return false
+				}
+			}
+			return true
+		},
+	}
+}
+
+func TestSetCommands_roles(t *testing.T) {
+	run, tg, _ := newTestBot(t, WithSetCommands(), WithUsers(
+		User{Name: "viewer", Role: RoleViewer},
+		User{Name: "adder", Role: RoleAdder},
+		User{ID: 42, Role: RoleAdmin},
+	))
+	gen := new(updateGenerator)
+
+	viewerCommands := []string{"checkport", "files", "info", "list", "space", "stats"}
+	adminCommands := []string{
+		"checkport", "files", "info", "limit", "list", "move", "priority", "queue", "remove", "resume", "seedpolicy", "space",
+		"speed", "stats", "stop", "turtle", "turtleoff", "turtleon",
+	}
+
+	update := gen.newMessage(withUser("admin"), withCommand("start"), func(u *tgbotapi.Update) {
+		u.Message.Chat.Type = "private"
+	})
+
+	defCall := tg.EXPECT().MakeRequest("setMyCommands", setCommandsMatcher(`{"type":"default"}`, viewerCommands...))
+	tg.EXPECT().MakeRequest("setMyCommands", setCommandsMatcher(`{"type":"chat","chat_id":42}`, adminCommands...)).
+		After(defCall)
+	tg.EXPECT().MakeRequest("setMyCommands",
+		setCommandsMatcher(fmt.Sprintf(`{"type":"chat","chat_id":%d}`, update.chatID()), adminCommands...)).
+		After(defCall)
+	tg.EXPECT().Send(messageMatcher(update.chatID(), "Drop me"))
+	run(update)
+}
+
+func TestRoles(t *testing.T) {
+	run, tg, _ := newTestBot(t, WithUsers(User{Name: "viewer", Role: RoleViewer}))
+	gen := new(updateGenerator)
+
+	start := gen.newMessage(withUser("viewer"), withCommand("start"))
+	remove := gen.newMessage(withUser("viewer"), withCommand("remove", "1"))
+	add := gen.newMessage(withUser("viewer"), withMsgText("magnet:/"))
+
+	gomock.InOrder(
+		tg.EXPECT().Send(messageMatcher(start.chatID(), "Drop me")),
+		tg.EXPECT().Send(messageMatcher(remove.chatID(), "not allowed")),
+		tg.EXPECT().Send(messageMatcher(add.chatID(), "not allowed")),
+	)
+	run(start, remove, add)
+}
+
+func TestRoles_callback(t *testing.T) {
+	cbID := strings.Repeat("0", callbackIDLen)
+	run, tg, tr := newTestBot(t,
+		WithUsers(User{Name: "viewer", Role: RoleViewer}),
+		withCallbackIDGenerator(func() string { return cbID }),
+	)
+	gen := new(updateGenerator)
+
+	msg := gen.newMessage(withCommand("remove", "1"))
+	forbidden := gen.newCallback(msg.Message, cbID+"yes", withUser("viewer"))
+	allowed := gen.newCallback(msg.Message, cbID+"yes")
+
+	tr.EXPECT().GetTorrents(gomock.AssignableToTypeOf(ctxType), gomock.Any(), gomock.Any()).
+		Return([]*transmission.Torrent{{ID: 1, Hash: "123", Name: "first torrent"}}, nil)
+	askCall := tg.EXPECT().Send(messageMatcher(msg.chatID(), "I'm going to remove"))
+	forbiddenCall := tg.EXPECT().AnswerCallbackQuery(tgbotapi.NewCallback(forbidden.callbackID(), forbiddenText)).
+		After(askCall)
+	tg.EXPECT().AnswerCallbackQuery(tgbotapi.NewCallback(allowed.callbackID(), "")).After(forbiddenCall)
+	removeCall := tr.EXPECT().RemoveTorrents(gomock.AssignableToTypeOf(ctxType),
+		transmission.IDs(transmission.Hash("123")), true).After(forbiddenCall)
+	tg.EXPECT().Send(editMatcher(msg.chatID(), msg.messageID(), "Done")).After(removeCall)
+
+	run(msg, forbidden, allowed)
+}
+
 func TestAuth(t *testing.T) {
 	run, tg, _ := newTestBot(t)
 	gen := new(updateGenerator)
@@ -299,6 +582,61 @@ func TestAuth(t *testing.T) {
 	run(update)
 }
 
+func TestAuth_userID(t *testing.T) {
+	run, tg, _ := newTestBot(t, WithAllowedUserIDs(42))
+	gen := new(updateGenerator)
+
+	allowed := gen.newMessage(withUser(""), withUserID(42), withCommand("start"))
+	rejected := gen.newMessage(withUser(""), withUserID(43), withCommand("start"))
+	tg.EXPECT().Send(messageMatcher(allowed.chatID(), "Drop me"))
+	tg.EXPECT().Send(messageMatcher(rejected.chatID(), "I don't know you"))
+	run(allowed, rejected)
+}
+
+func TestAuth_callback(t *testing.T) {
+	run, _, _ := newTestBot(t)
+	gen := new(updateGenerator)
+
+	msg := gen.newMessage()
+	run(gen.newCallback(msg.Message, "data", withUser("testuser")))
+}
+
+func TestGroup(t *testing.T) {
+	run, tg, tr := newTestBot(t, WithAllowedChats(-100), WithUsername("testbot"))
+	gen := new(updateGenerator)
+	expectNoDuplicates(tr)
+
+	updates := []update{
+		// Unknown group
+		gen.newMessage(withGroupChat(-200), withCommand("start")),
+		// Unknown user
+		gen.newMessage(withGroupChat(-100), withUser("testuser"), withCommand("start")),
+		// Command for another bot
+		gen.newMessage(withGroupChat(-100), withCommand("start@otherbot")),
+		// Just a chat message
+		gen.newMessage(withGroupChat(-100), withMsgText("what should we watch tonight?")),
+		// Reply to someone else
+		gen.newMessage(withGroupChat(-100), withMsgText("let's do it"), withReplyTo("friend")),
+	}
+	command := gen.newMessage(withGroupChat(-100), withCommand("start@TestBot"))
+	magnet := gen.newMessage(withGroupChat(-100), withMsgText("magnet:?xt=urn:btih:abc"))
+	addressed := gen.newMessage(withGroupChat(-100), withMsgText("magnet:/"), withReplyTo("testbot"))
+	updates = append(updates, command, magnet, addressed)
+
+	gomock.InOrder(
+		tg.EXPECT().Send(messageMatcher(command.chatID(), "Drop me", hasReplyMsgID(command.messageID()))),
+		tr.EXPECT().AddTorrent(gomock.AssignableToTypeOf(ctxType), &transmission.AddTorrentReq{
+			URL: transmission.OptString("magnet:?xt=urn:btih:abc"),
+		}).Return(&transmission.NewTorrent{ID: 1, Hash: "abc", Name: "first"}, nil),
+		tg.EXPECT().Send(messageMatcher(magnet.chatID(), "first", hasReplyMsgID(magnet.messageID()))),
+		tr.EXPECT().AddTorrent(gomock.AssignableToTypeOf(ctxType), &transmission.AddTorrentReq{
+			URL: transmission.OptString("magnet:/"),
+		}).Return(&transmission.NewTorrent{ID: 2, Hash: "def", Name: "second"}, nil),
+		tg.EXPECT().Send(messageMatcher(addressed.chatID(), "second", hasReplyMsgID(addressed.messageID()))),
+	)
+	run(updates...)
+}
+
 func TestCommand_unknown(t *testing.T) {
 	run, tg, _ := newTestBot(t)
 	gen := new(updateGenerator)
@@ -348,6 +686,7 @@ func TestCommand_checkPort(t *testing.T) {
 func TestAddTorrent_text(t *testing.T) {
 	run, tg, tr := newTestBot(t)
 	gen := new(updateGenerator)
+	expectNoDuplicates(tr)
 
 	update := gen.newMessage(withMsgText("magnet:/"))
 
@@ -367,6 +706,208 @@ func TestAddTorrent_text(t *testing.T) {
 	run(update)
 }
 
+func TestAddTorrent_noLinks(t *testing.T) {
+	run, tg, _ := newTestBot(t)
+	gen := new(updateGenerator)
+
+	update := gen.newMessage(withMsgText("what should we watch tonight?"))
+
+	tg.EXPECT().Send(messageMatcher(update.chatID(), `^I don't see any magnet links`))
+
+	run(update)
+}
+
+func TestAddTorrent_links(t *testing.T) {
+	run, tg, tr := newTestBot(t)
+	gen := new(updateGenerator)
+	expectNoDuplicates(tr)
+
+	update := gen.newMessage(withMsgText("Here you go: magnet:?xt=urn:btih:abc, magnet:?xt=urn:btih:def&dn=Bad+One\n" +
+		"and https://tracker.org/third.torrent"))
+
+	first := tr.EXPECT().AddTorrent(gomock.AssignableToTypeOf(ctxType), &transmission.AddTorrentReq{
+		URL: transmission.OptString("magnet:?xt=urn:btih:abc"),
+	}).Return(&transmission.NewTorrent{ID: 1, Hash: "abc", Name: "first"}, nil)
+	second := tr.EXPECT().AddTorrent(gomock.AssignableToTypeOf(ctxType), &transmission.AddTorrentReq{
+		URL: transmission.OptString("magnet:?xt=urn:btih:def&dn=Bad+One"),
+	}).Return(nil, errors.New("invalid or corrupt torrent file")).After(first)
+	third := tr.EXPECT().AddTorrent(gomock.AssignableToTypeOf(ctxType), &transmission.AddTorrentReq{
+		URL: transmission.OptString("https://tracker.org/third.torrent"),
+	}).Return(&transmission.NewTorrent{ID: 3, Hash: "ghi", Name: "third.one"}, nil).After(second)
+	tg.EXPECT().Send(messageMatcher(update.chatID(), `^👌 \\<\*1\*\\> first\n👌 \\<\*3\*\\> third\\\.one\n`+
+		`❌ Bad One: invalid or corrupt torrent file\n$`)).After(third)
+
+	run(update)
+}
+
+func TestAddTorrent_linksLocations(t *testing.T) {
+	cbID := strings.Repeat("0", callbackIDLen)
+	run, tg, tr := newTestBot(t,
+		WithLocations(Location{Name: "loc1", Path: "/path/to/loc1"}),
+		WithRules(Rule{Name: "all", Location: "loc1", Pattern: ".*"}),
+		withCallbackIDGenerator(func() string { return cbID }),
+	)
+	gen := new(updateGenerator)
+	expectNoDuplicates(tr)
+
+	msg := gen.newMessage(withMsgText("magnet:?xt=urn:btih:abc magnet:?xt=urn:btih:def"))
+	cb := gen.newCallback(msg.Message, cbID+"loc1")
+
+	expectFreeSpace(tr, 1<<30)
+	askCall := tg.EXPECT().Send(gomock.All(
+		messageMatcher(msg.chatID(), `^Ok, gonna queue 2 torrents for download.*\n\n`+
+			`Download rules only apply to torrents sent one at a time\.$`),
+		inlineKeyboardMatcher(
+			tgbotapi.NewInlineKeyboardRow(
+				tgbotapi.NewInlineKeyboardButtonData("loc1 (1.0 GiB)", cbID+"loc1"),
+				tgbotapi.NewInlineKeyboardButtonData("Other (1.0 GiB)", cbID+"other"),
+			),
+			tgbotapi.NewInlineKeyboardRow(
+				tgbotapi.NewInlineKeyboardButtonData("Cancel", cbID+"cancel"),
+			),
+		),
+	))
+	answerCall := tg.EXPECT().AnswerCallbackQuery(tgbotapi.NewCallback(cb.callbackID(), "")).After(askCall)
+	first := tr.EXPECT().AddTorrent(gomock.AssignableToTypeOf(ctxType), &transmission.AddTorrentReq{
+		URL:               transmission.OptString("magnet:?xt=urn:btih:abc"),
+		DownloadDirectory: transmission.OptString("/path/to/loc1"),
+	}).Return(&transmission.NewTorrent{ID: 1, Hash: "abc", Name: "first"}, nil).After(answerCall)
+	second := tr.EXPECT().AddTorrent(gomock.AssignableToTypeOf(ctxType), &transmission.AddTorrentReq{
+		URL:               transmission.OptString("magnet:?xt=urn:btih:def"),
+		DownloadDirectory: transmission.OptString("/path/to/loc1"),
+	}).Return(&transmission.NewTorrent{ID: 2, Hash: "def", Name: "second"}, nil).After(first)
+	tg.EXPECT().Send(editMatcher(msg.chatID(), msg.messageID(), `^👌 \\<\*1\*\\> first\n`+
+		`👌 \\<\*2\*\\> second\n\nWill be downloaded to \*/path/to/loc1\*$`)).After(second)
+
+	run(msg, cb)
+}
+
+func TestAddTorrent_duplicate(t *testing.T) {
+	cbID := strings.Repeat("0", callbackIDLen)
+	run, tg, tr := newTestBot(t, withCallbackIDGenerator(func() string { return cbID }))
+	gen := new(updateGenerator)
+
+	hash := transmission.Hash("c12fe1c06bba254a9dc9f519b335aa7c1367a88a")
+	torrent := &transmission.Torrent{
+		ID:                5,
+		Hash:              hash,
+		Name:              "Some Movie",
+		Status:            transmission.StatusStopped,
+		DownloadDirectory: "/movies",
+		ValidSize:         73,
+		WantedSize:        100,
+	}
+	msg := gen.newMessage(withMsgText("magnet:?xt=urn:btih:" + string(hash)))
+	resume := gen.newCallback(msg.Message, cbID+"resume")
+
+	getCall := tr.EXPECT().GetTorrents(gomock.AssignableToTypeOf(ctxType), transmission.IDs(hash), duplicateFields).
+		Return([]*transmission.Torrent{torrent}, nil)
+	sendCall := tg.EXPECT().Send(gomock.All(
+		messageMatcher(msg.chatID(),
+			`^♻️ Already have it: \\<\*5\*\\> Some Movie, \*73%\* done, paused, in \*/movies\*$`),
+		inlineKeyboardMatcher(tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("View", cbID+"view"),
+			tgbotapi.NewInlineKeyboardButtonData("Resume", cbID+"resume"),
+		)),
+	)).After(getCall)
+	answerCall := tg.EXPECT().AnswerCallbackQuery(tgbotapi.NewCallback(resume.callbackID(), "")).After(sendCall)
+	startCall := tr.EXPECT().StartTorrents(gomock.AssignableToTypeOf(ctxType), transmission.IDs(hash)).
+		After(answerCall)
+	getCall = tr.EXPECT().GetTorrents(gomock.AssignableToTypeOf(ctxType), transmission.IDs(hash), gomock.Any()).
+		Return([]*transmission.Torrent{torrent}, nil).After(startCall)
+	tg.EXPECT().Send(editMatcher(msg.chatID(), msg.messageID(), `^(?s)\\<\*5\*\\> \*Some Movie\*`)).
+		After(getCall)
+
+	run(msg, resume)
+}
+
+func TestAddTorrent_duplicateResume(t *testing.T) {
+	cbID := strings.Repeat("0", callbackIDLen)
+	store, err := NewFileStore(filepath.Join(t.TempDir(), "state.json"))
+	if err != nil {
+		t.Fatalf("NewFileStore: unexpected error: %v", err)
+	}
+	hash := transmission.Hash("c12fe1c06bba254a9dc9f519b335aa7c1367a88a")
+	if err := store.PutOwner(hash, &Owner{ChatID: 123, UserID: 1}); err != nil {
+		t.Fatalf("PutOwner: unexpected error: %v", err)
+	}
+	run, tg, tr := newTestBot(t,
+		WithUsers(
+			User{Name: "owner", ID: 1, Role: RoleAdder},
+			User{Name: "other", ID: 2, Role: RoleAdder},
+		),
+		WithStore(store),
+		withCallbackIDGenerator(func() string { return cbID }),
+	)
+	gen := new(updateGenerator)
+
+	torrent := &transmission.Torrent{ID: 5, Hash: hash, Name: "Some Movie", Status: transmission.StatusStopped}
+	other := gen.newMessage(withMsgText("magnet:?xt=urn:btih:"+string(hash)), withUser("other"), withUserID(2))
+	otherResume := gen.newCallback(other.Message, cbID+"resume", withUser("other"), withUserID(2))
+	owner := gen.newMessage(withMsgText("magnet:?xt=urn:btih:"+string(hash)), withUser("owner"), withUserID(1))
+	ownerResume := gen.newCallback(owner.Message, cbID+"resume", withUser("owner"), withUserID(1))
+
+	tr.EXPECT().GetTorrents(gomock.AssignableToTypeOf(ctxType), transmission.IDs(hash), gomock.Any()).
+		Return([]*transmission.Torrent{torrent}, nil).AnyTimes()
+
+	// Resuming the torrent is up to admins and the user who has added it
+	sendCall := tg.EXPECT().Send(gomock.All(
+		messageMatcher(other.chatID(), `^♻️ Already have it`),
+		inlineKeyboardMatcher(tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("View", cbID+"view"),
+		)),
+	))
+	answerCall := tg.EXPECT().AnswerCallbackQuery(tgbotapi.NewCallback(otherResume.callbackID(), forbiddenText)).
+		After(sendCall)
+	sendCall = tg.EXPECT().Send(gomock.All(
+		messageMatcher(owner.chatID(), `^♻️ Already have it`),
+		inlineKeyboardMatcher(tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("View", cbID+"view"),
+			tgbotapi.NewInlineKeyboardButtonData("Resume", cbID+"resume"),
+		)),
+	)).After(answerCall)
+	answerCall = tg.EXPECT().AnswerCallbackQuery(tgbotapi.NewCallback(ownerResume.callbackID(), "")).After(sendCall)
+	startCall := tr.EXPECT().StartTorrents(gomock.AssignableToTypeOf(ctxType), transmission.IDs(hash)).
+		After(answerCall)
+	tg.EXPECT().Send(editMatcher(owner.chatID(), owner.messageID(), `^(?s)\\<\*5\*\\> \*Some Movie\*`)).
+		After(startCall)
+
+	run(other, otherResume, owner, ownerResume)
+}
+
+func TestAddTorrent_duplicateLink(t *testing.T) {
+	cbID := strings.Repeat("0", callbackIDLen)
+	run, tg, tr := newTestBot(t, withCallbackIDGenerator(func() string { return cbID }))
+	gen := new(updateGenerator)
+
+	msg := gen.newMessage(withMsgText("https://tracker.org/download.php?id=1"))
+
+	snapshotCall := tr.EXPECT().GetTorrents(gomock.AssignableToTypeOf(ctxType), transmission.All(),
+		transmission.TorrentFieldHash).Return([]*transmission.Torrent{{Hash: "abc"}}, nil)
+	addCall := tr.EXPECT().AddTorrent(gomock.AssignableToTypeOf(ctxType), &transmission.AddTorrentReq{
+		URL: transmission.OptString("https://tracker.org/download.php?id=1"),
+	}).Return(&transmission.NewTorrent{ID: 1, Hash: "abc", Name: "Some Movie"}, nil).After(snapshotCall)
+	getCall := tr.EXPECT().GetTorrents(gomock.AssignableToTypeOf(ctxType), transmission.IDs(transmission.Hash("abc")),
+		duplicateFields).Return([]*transmission.Torrent{{
+		ID:                1,
+		Hash:              "abc",
+		Name:              "Some Movie",
+		Status:            transmission.StatusSeed,
+		DownloadDirectory: "/movies",
+		ValidSize:         100,
+		WantedSize:        100,
+	}}, nil).After(addCall)
+	tg.EXPECT().Send(gomock.All(
+		messageMatcher(msg.chatID(),
+			`^♻️ Already have it: \\<\*1\*\\> Some Movie, \*100%\* done, in \*/movies\*$`),
+		inlineKeyboardMatcher(tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("View", cbID+"view"),
+		)),
+	)).After(getCall)
+
+	run(msg)
+}
+
 func TestAddTorrent_locations(t *testing.T) {
 	cbID := strings.Repeat("0", callbackIDLen)
 	run, tg, tr := newTestBot(t,
@@ -378,20 +919,27 @@ func TestAddTorrent_locations(t *testing.T) {
 	)
 
 	gen := new(updateGenerator)
+	expectNoDuplicates(tr)
 
 	msg := gen.newMessage(withMsgText("magnet:/"))
 	cb := gen.newCallback(msg.Message, cbID+"loc1")
 	updates := []update{msg, cb}
 
+	tr.EXPECT().GetSession(gomock.AssignableToTypeOf(ctxType), transmission.SessionFieldDownloadDirectory).
+		Return(&transmission.Session{DownloadDirectory: "/downloads"}, nil)
+	tr.EXPECT().GetFreeSpace(gomock.AssignableToTypeOf(ctxType), "/path/to/loc1").Return(int64(1<<30), nil)
+	tr.EXPECT().GetFreeSpace(gomock.AssignableToTypeOf(ctxType), "/path/to/loc2").Return(int64(0), errors.New("no"))
+	tr.EXPECT().GetFreeSpace(gomock.AssignableToTypeOf(ctxType), "/downloads").Return(int64(2<<30), nil)
 	askCall := tg.EXPECT().Send(gomock.All(
 		messageMatcher(msg.chatID(), `^(?s)Ok, gonna queue it for download`),
 		inlineKeyboardMatcher(
 			tgbotapi.NewInlineKeyboardRow(
-				tgbotapi.NewInlineKeyboardButtonData("loc1", cbID+"loc1"),
+				tgbotapi.NewInlineKeyboardButtonData("loc1 (1.0 GiB)", cbID+"loc1"),
 				tgbotapi.NewInlineKeyboardButtonData("loc2", cbID+"loc2"),
-				tgbotapi.NewInlineKeyboardButtonData("Other", cbID+"other"),
+				tgbotapi.NewInlineKeyboardButtonData("Other (2.0 GiB)", cbID+"other"),
 			),
 			tgbotapi.NewInlineKeyboardRow(
+				tgbotapi.NewInlineKeyboardButtonData("Pick files", cbID+"pick"),
 				tgbotapi.NewInlineKeyboardButtonData("Cancel", cbID+"cancel"),
 			),
 		),
@@ -411,45 +959,567 @@ func TestAddTorrent_locations(t *testing.T) {
 	run(updates...)
 }
 
-func TestAddTorrent_file(t *testing.T) {
-	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if want, got := "/files/file_id", r.URL.Path; want != got {
-			t.Errorf("unexpected file download path, want = %q, got = %q", want, got)
-		}
-		if want, got := "GET", r.Method; want != got {
-			t.Errorf("unexpected HTTP method, want = %q, got = %q", want, got)
-		}
-
-		if _, err := w.Write([]byte("torrent-file-contents")); err != nil {
-			t.Errorf("unexpected error sending the file: %v", err)
-		}
-	}))
-	defer srv.Close()
+func TestAddTorrent_rule(t *testing.T) {
+	cbID := strings.Repeat("0", callbackIDLen)
+	run, tg, tr := newTestBot(t,
+		WithLocations(
+			Location{Name: "loc1", Path: "/path/to/loc1"},
+			Location{Name: "loc2", Path: "/path/to/loc2"},
+		),
+		WithRules(
+			Rule{Name: "movies", Location: "loc1", Extensions: []string{"mkv"}},
+			Rule{Name: "shows", Location: "loc2", Pattern: `(?i)s\d\de\d\d`},
+		),
+		withCallbackIDGenerator(func() string { return cbID }),
+	)
 
-	run, tg, tr := newTestBot(t, WithHTTPClient(srv.Client()))
 	gen := new(updateGenerator)
+	expectNoDuplicates(tr)
 
-	update := gen.newMessage(withDocument("file_id"))
+	msg := gen.newMessage(withMsgText("magnet:?xt=urn:btih:abc&dn=Some.Show.S01E02"))
+	cb := gen.newCallback(msg.Message, cbID+"override")
+	updates := []update{msg, cb}
 
-	getFileCall := tg.EXPECT().GetFileDirectURL("file_id").Return(srv.URL+"/files/file_id", nil)
-	addTorrentCall := tr.EXPECT().AddTorrent(
-		gomock.AssignableToTypeOf(ctxType),
-		torrentMatcher([]byte("torrent-file-contents")),
-	).Return(&transmission.NewTorrent{
+	addCall := tr.EXPECT().AddTorrent(gomock.AssignableToTypeOf(ctxType), &transmission.AddTorrentReq{
+		URL:               transmission.OptString("magnet:?xt=urn:btih:abc&dn=Some.Show.S01E02"),
+		DownloadDirectory: transmission.OptString("/path/to/loc2"),
+	}).Return(&transmission.NewTorrent{
 		ID:   transmission.ID(1),
 		Hash: transmission.Hash("abc"),
-		Name: "new fancy torrent",
-	}, nil).After(getFileCall)
-	tg.EXPECT().Send(messageMatcher(
-		update.chatID(),
-		`\\<\*1\*\\> new fancy torrent`,
-		hasReplyMsgID(update.messageID()),
-	)).After(getFileCall).After(addTorrentCall)
+		Name: "Some.Show.S01E02",
+	}, nil)
+	replyCall := tg.EXPECT().Send(gomock.All(
+		messageMatcher(msg.chatID(),
+			`^(?s)👌 \\<\*1\*\\> Some\\\.Show\\\.S01E02.*/path/to/loc2\* as told by rule \*shows\*$`),
+		inlineKeyboardMatcher(tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("Pick files", cbID+"pick"),
+			tgbotapi.NewInlineKeyboardButtonData("Choose another location", cbID+"override"),
+		)),
+	)).After(addCall)
+	tg.EXPECT().AnswerCallbackQuery(tgbotapi.NewCallback(cb.callbackID(), "")).After(replyCall)
+	getCall := tr.EXPECT().GetTorrents(gomock.AssignableToTypeOf(ctxType), transmission.IDs(transmission.Hash("abc")),
+		transmission.TorrentFieldID, transmission.TorrentFieldHash, transmission.TorrentFieldName,
+	).Return([]*transmission.Torrent{{ID: 1, Hash: "abc", Name: "Some.Show.S01E02"}}, nil).After(replyCall)
+	tg.EXPECT().Send(gomock.All(
+		editMatcher(msg.chatID(), msg.messageID(), `^(?s)Where should I move.*Some\\\.Show\\\.S01E02`),
+		inlineKeyboardMatcher(
+			tgbotapi.NewInlineKeyboardRow(
+				tgbotapi.NewInlineKeyboardButtonData("loc1", cbID+"loc1"),
+				tgbotapi.NewInlineKeyboardButtonData("loc2", cbID+"loc2"),
+			),
+			tgbotapi.NewInlineKeyboardRow(
+				tgbotapi.NewInlineKeyboardButtonData("Cancel", cbID+"cancel"),
+			),
+		),
+	)).After(getCall)
 
-	run(update)
+	run(updates...)
 }
 
-func TestStats(t *testing.T) {
+func TestAddTorrent_rulePickFiles(t *testing.T) {
+	cbID := strings.Repeat("0", callbackIDLen)
+	run, tg, tr := newTestBot(t,
+		WithLocations(Location{Name: "loc1", Path: "/path/to/loc1"}),
+		WithRules(Rule{Name: "shows", Location: "loc1", Pattern: `(?i)s\d\de\d\d`}),
+		withCallbackIDGenerator(func() string { return cbID }),
+	)
+	gen := new(updateGenerator)
+	expectNoDuplicates(tr)
+
+	msg := gen.newMessage(withMsgText("magnet:?xt=urn:btih:abc&dn=Some.Show.S01E02"))
+	pick := gen.newCallback(msg.Message, cbID+"pick")
+	ids := transmission.IDs(transmission.Hash("abc"))
+
+	addCall := tr.EXPECT().AddTorrent(gomock.AssignableToTypeOf(ctxType), &transmission.AddTorrentReq{
+		URL:               transmission.OptString("magnet:?xt=urn:btih:abc&dn=Some.Show.S01E02"),
+		DownloadDirectory: transmission.OptString("/path/to/loc1"),
+	}).Return(&transmission.NewTorrent{ID: 1, Hash: "abc", Name: "Some.Show.S01E02"}, nil)
+	replyCall := tg.EXPECT().Send(messageMatcher(msg.chatID(), `as told by rule \*shows\*$`)).After(addCall)
+	answerCall := tg.EXPECT().AnswerCallbackQuery(tgbotapi.NewCallback(pick.callbackID(), "")).After(replyCall)
+	stopCall := tr.EXPECT().StopTorrents(gomock.AssignableToTypeOf(ctxType), ids).After(answerCall)
+	filesCall := tr.EXPECT().GetTorrents(gomock.AssignableToTypeOf(ctxType), ids, gomock.Any()).
+		Return([]*transmission.Torrent{{
+			ID:        1,
+			Hash:      "abc",
+			Name:      "Some.Show.S01E02",
+			Files:     []transmission.File{{Name: "episode.mkv", Size: 1024}},
+			FileStats: []transmission.FileStat{{Wanted: true}},
+		}}, nil).After(stopCall)
+	tg.EXPECT().Send(gomock.All(
+		editMatcher(msg.chatID(), msg.messageID(), `(?s)Pick the files to download.*episode\\\.mkv`),
+		inlineKeyboardMatcher(
+			tgbotapi.NewInlineKeyboardRow(
+				tgbotapi.NewInlineKeyboardButtonData("1 ✅", cbID+"want0"),
+				tgbotapi.NewInlineKeyboardButtonData("1 normal", cbID+"prio0"),
+			),
+			tgbotapi.NewInlineKeyboardRow(
+				tgbotapi.NewInlineKeyboardButtonData("Start", cbID+"start"),
+				tgbotapi.NewInlineKeyboardButtonData("Cancel", cbID+"cancel"),
+			),
+		),
+	)).After(filesCall)
+
+	run(msg, pick)
+}
+
+func TestAddTorrent_ruleOwner(t *testing.T) {
+	cbID := strings.Repeat("0", callbackIDLen)
+	run, tg, tr := newTestBot(t,
+		WithUsers(
+			User{Name: "owner", ID: 1, Role: RoleAdder},
+			User{Name: "other", ID: 2, Role: RoleAdder},
+		),
+		WithLocations(
+			Location{Name: "loc1", Path: "/path/to/loc1"},
+			Location{Name: "loc2", Path: "/path/to/loc2"},
+		),
+		WithRules(Rule{Name: "shows", Location: "loc1", Pattern: `(?i)s\d\de\d\d`}),
+		withCallbackIDGenerator(func() string { return cbID }),
+	)
+	gen := new(updateGenerator)
+	expectNoDuplicates(tr)
+
+	asOwner := []func(*tgbotapi.Update){withUser("owner"), withUserID(1)}
+	asOther := []func(*tgbotapi.Update){withUser("other"), withUserID(2)}
+	msg := gen.newMessage(append(asOwner, withMsgText("magnet:?xt=urn:btih:abc&dn=Some.Show.S01E02"))...)
+	otherPick := gen.newCallback(msg.Message, cbID+"pick", asOther...)
+	otherOverride := gen.newCallback(msg.Message, cbID+"override", asOther...)
+	override := gen.newCallback(msg.Message, cbID+"override", asOwner...)
+	otherMove := gen.newCallback(msg.Message, cbID+"loc2", asOther...)
+	move := gen.newCallback(msg.Message, cbID+"loc2", asOwner...)
+	ids := transmission.IDs(transmission.Hash("abc"))
+
+	tr.EXPECT().AddTorrent(gomock.AssignableToTypeOf(ctxType), gomock.Any()).
+		Return(&transmission.NewTorrent{ID: 1, Hash: "abc", Name: "Some.Show.S01E02"}, nil)
+	tr.EXPECT().GetTorrents(gomock.AssignableToTypeOf(ctxType), ids, gomock.Any()).
+		Return([]*transmission.Torrent{{ID: 1, Hash: "abc", Name: "Some.Show.S01E02"}}, nil).AnyTimes()
+	tg.EXPECT().Send(gomock.Any()).Times(3)
+
+	// Only the user who has added the torrent may touch it
+	call := tg.EXPECT().AnswerCallbackQuery(tgbotapi.NewCallback(otherPick.callbackID(), forbiddenText))
+	call = tg.EXPECT().AnswerCallbackQuery(tgbotapi.NewCallback(otherOverride.callbackID(), forbiddenText)).After(call)
+	call = tg.EXPECT().AnswerCallbackQuery(tgbotapi.NewCallback(override.callbackID(), "")).After(call)
+	call = tg.EXPECT().AnswerCallbackQuery(tgbotapi.NewCallback(otherMove.callbackID(), forbiddenText)).After(call)
+	call = tg.EXPECT().AnswerCallbackQuery(tgbotapi.NewCallback(move.callbackID(), "")).After(call)
+	tr.EXPECT().SetTorrentsLocation(gomock.AssignableToTypeOf(ctxType), ids, "/path/to/loc2", true).After(call)
+
+	run(msg, otherPick, otherOverride, override, otherMove, move)
+}
+
+func TestAddTorrent_ruleNoSpace(t *testing.T) {
+	srv := newFileServer(t, testTorrent)
+	defer srv.Close()
+
+	cbID := strings.Repeat("0", callbackIDLen)
+	run, tg, tr := newTestBot(t,
+		WithHTTPClient(srv.Client()),
+		WithLocations(Location{Name: "loc1", Path: "/path/to/loc1"}),
+		WithRules(Rule{Name: "fancy", Location: "loc1", Pattern: "fancy"}),
+		withCallbackIDGenerator(func() string { return cbID }),
+	)
+	gen := new(updateGenerator)
+	expectNoDuplicates(tr)
+
+	update := gen.newMessage(withDocument("file_id"))
+
+	// The rule is ignored, as the torrent doesn't fit, and the user is asked
+	// where to put it instead
+	tg.EXPECT().GetFileDirectURL("file_id").Return(srv.URL+"/files/file_id", nil)
+	tr.EXPECT().GetSession(gomock.AssignableToTypeOf(ctxType), transmission.SessionFieldDownloadDirectory).
+		Return(&transmission.Session{DownloadDirectory: "/downloads"}, nil)
+	tr.EXPECT().GetFreeSpace(gomock.AssignableToTypeOf(ctxType), "/path/to/loc1").Return(int64(1<<20), nil).Times(2)
+	tr.EXPECT().GetFreeSpace(gomock.AssignableToTypeOf(ctxType), "/downloads").Return(int64(2<<30), nil)
+	tg.EXPECT().Send(gomock.All(
+		messageMatcher(update.chatID(), `(?s)^Ok, gonna queue it for download.*`+
+			`⚠️ It needs 1\.0 GiB, which is more than there is free in loc1\.$`),
+		inlineKeyboardMatcher(
+			tgbotapi.NewInlineKeyboardRow(
+				tgbotapi.NewInlineKeyboardButtonData("⚠️ loc1 (1.0 MiB)", cbID+"loc1"),
+				tgbotapi.NewInlineKeyboardButtonData("Other (2.0 GiB)", cbID+"other"),
+			),
+			tgbotapi.NewInlineKeyboardRow(
+				tgbotapi.NewInlineKeyboardButtonData("Pick files", cbID+"pick"),
+				tgbotapi.NewInlineKeyboardButtonData("Cancel", cbID+"cancel"),
+			),
+		),
+	))
+
+	run(update)
+}
+
+func TestAddTorrent_restart(t *testing.T) {
+	cbID := strings.Repeat("0", callbackIDLen)
+	path := filepath.Join(t.TempDir(), "state.json")
+	newBot := func() (func(...update), *MockTelegram, *MockTransmission, Store) {
+		store, err := NewFileStore(path)
+		if err != nil {
+			t.Fatalf("NewFileStore: unexpected error: %v", err)
+		}
+		run, tg, tr := newTestBot(t,
+			WithLocations(Location{Name: "loc1", Path: "/path/to/loc1"}),
+			WithStore(store),
+			withCallbackIDGenerator(func() string { return cbID }),
+		)
+		return run, tg, tr, store
+	}
+
+	gen := new(updateGenerator)
+	msg := gen.newMessage(withMsgText("magnet:/"))
+	cb := gen.newCallback(msg.Message, cbID+"loc1")
+
+	run, tg, tr, _ := newBot()
+	expectFreeSpace(tr, 1<<30)
+	tg.EXPECT().Send(messageMatcher(msg.chatID(), `^(?s)Ok, gonna queue it for download`))
+	run(msg)
+
+	// The keyboard must keep working after restart
+	run, tg, tr, store := newBot()
+	expectNoDuplicates(tr)
+	answerCall := tg.EXPECT().AnswerCallbackQuery(tgbotapi.NewCallback(cb.callbackID(), ""))
+	addCall := tr.EXPECT().AddTorrent(gomock.AssignableToTypeOf(ctxType), &transmission.AddTorrentReq{
+		URL:               transmission.OptString("magnet:/"),
+		DownloadDirectory: transmission.OptString("/path/to/loc1"),
+	}).Return(&transmission.NewTorrent{
+		ID:   transmission.ID(1),
+		Hash: transmission.Hash("abc"),
+		Name: "new fancy torrent",
+	}, nil).After(answerCall)
+	tg.EXPECT().Send(editMatcher(msg.chatID(), msg.messageID(),
+		`(?s)\\<\*1\*\\> new fancy torrent.*/path/to/loc1`)).After(addCall)
+	run(cb)
+
+	owners, err := store.GetOwners()
+	if err != nil {
+		t.Fatalf("GetOwners: unexpected error: %v", err)
+	}
+	if o := owners["abc"]; o == nil || o.ChatID != msg.chatID() || o.MessageID != msg.messageID() {
+		t.Errorf("unexpected owner of the torrent: %+v", o)
+	}
+}
+
+func TestAddTorrent_pickFiles(t *testing.T) {
+	cbID := strings.Repeat("0", callbackIDLen)
+	run, tg, tr := newTestBot(t,
+		WithLocations(Location{Name: "loc1", Path: "/path/to/loc1"}),
+		withCallbackIDGenerator(func() string { return cbID }),
+	)
+	gen := new(updateGenerator)
+	expectNoDuplicates(tr)
+
+	msg := gen.newMessage(withMsgText("magnet:/"))
+	pick := gen.newCallback(msg.Message, cbID+"pick")
+	loc := gen.newCallback(msg.Message, cbID+"loc1")
+	start := gen.newCallback(msg.Message, cbID+"start")
+	ids := transmission.IDs(transmission.Hash("abc"))
+	torrent := &transmission.Torrent{
+		ID:                1,
+		Hash:              "abc",
+		Name:              "new fancy torrent",
+		Status:            transmission.StatusStopped,
+		DownloadDirectory: "/path/to/loc1",
+		Files:             []transmission.File{{Name: "file.mkv", Size: 1024}},
+		FileStats:         []transmission.FileStat{{Wanted: true}},
+	}
+
+	expectFreeSpace(tr, 1<<30)
+	askCall := tg.EXPECT().Send(messageMatcher(msg.chatID(), `^(?s)Ok, gonna queue it for download`))
+	answerCall := tg.EXPECT().AnswerCallbackQuery(tgbotapi.NewCallback(pick.callbackID(), "")).After(askCall)
+	pickCall := tg.EXPECT().Send(gomock.All(
+		editMatcher(msg.chatID(), msg.messageID(), `(?s)^Ok, gonna queue it for download.*pick the files`),
+		inlineKeyboardMatcher(
+			tgbotapi.NewInlineKeyboardRow(
+				tgbotapi.NewInlineKeyboardButtonData("loc1 (1.0 GiB)", cbID+"loc1"),
+				tgbotapi.NewInlineKeyboardButtonData("Other (1.0 GiB)", cbID+"other"),
+			),
+			tgbotapi.NewInlineKeyboardRow(
+				tgbotapi.NewInlineKeyboardButtonData("All files", cbID+"all"),
+				tgbotapi.NewInlineKeyboardButtonData("Cancel", cbID+"cancel"),
+			),
+		),
+	)).After(answerCall)
+
+	answerCall = tg.EXPECT().AnswerCallbackQuery(tgbotapi.NewCallback(loc.callbackID(), "")).After(pickCall)
+	addCall := tr.EXPECT().AddTorrent(gomock.AssignableToTypeOf(ctxType), &transmission.AddTorrentReq{
+		URL:               transmission.OptString("magnet:/"),
+		DownloadDirectory: transmission.OptString("/path/to/loc1"),
+		Paused:            transmission.OptBool(true),
+	}).Return(&transmission.NewTorrent{ID: 1, Hash: "abc", Name: "new fancy torrent"}, nil).After(answerCall)
+	filesCall := tr.EXPECT().GetTorrents(gomock.AssignableToTypeOf(ctxType), ids, gomock.Any()).
+		Return([]*transmission.Torrent{torrent}, nil).After(addCall)
+	pickerCall := tg.EXPECT().Send(gomock.All(
+		editMatcher(msg.chatID(), msg.messageID(), `(?s)Pick the files to download.*file\\\.mkv`),
+		inlineKeyboardMatcher(
+			tgbotapi.NewInlineKeyboardRow(
+				tgbotapi.NewInlineKeyboardButtonData("1 ✅", cbID+"want0"),
+				tgbotapi.NewInlineKeyboardButtonData("1 normal", cbID+"prio0"),
+			),
+			tgbotapi.NewInlineKeyboardRow(
+				tgbotapi.NewInlineKeyboardButtonData("Start", cbID+"start"),
+				tgbotapi.NewInlineKeyboardButtonData("Cancel", cbID+"cancel"),
+			),
+		),
+	)).After(filesCall)
+
+	answerCall = tg.EXPECT().AnswerCallbackQuery(tgbotapi.NewCallback(start.callbackID(), "")).After(pickerCall)
+	startCall := tr.EXPECT().StartTorrents(gomock.AssignableToTypeOf(ctxType), ids).After(answerCall)
+	getCall := tr.EXPECT().GetTorrents(gomock.AssignableToTypeOf(ctxType), ids, gomock.Any()).
+		Return([]*transmission.Torrent{torrent}, nil).After(startCall)
+	tg.EXPECT().Send(editMatcher(msg.chatID(), msg.messageID(),
+		`(?s)\\<\*1\*\\> new fancy torrent.*/path/to/loc1`)).After(getCall)
+
+	run(msg, pick, loc, start)
+}
+
+func TestAddTorrent_pickFilesCancel(t *testing.T) {
+	cbID := strings.Repeat("0", callbackIDLen)
+	run, tg, tr := newTestBot(t,
+		WithLocations(Location{Name: "loc1", Path: "/path/to/loc1"}),
+		withCallbackIDGenerator(func() string { return cbID }),
+	)
+	gen := new(updateGenerator)
+	expectNoDuplicates(tr)
+
+	msg := gen.newMessage(withMsgText("magnet:/"))
+	pick := gen.newCallback(msg.Message, cbID+"pick")
+	loc := gen.newCallback(msg.Message, cbID+"loc1")
+	cancel := gen.newCallback(msg.Message, cbID+"cancel")
+	ids := transmission.IDs(transmission.Hash("abc"))
+	torrent := &transmission.Torrent{ID: 1, Hash: "abc", Name: "new fancy torrent", Status: transmission.StatusStopped}
+
+	expectFreeSpace(tr, 1<<30)
+	tg.EXPECT().Send(gomock.Any()).Times(3)
+	tg.EXPECT().AnswerCallbackQuery(gomock.Any()).Times(3)
+	addCall := tr.EXPECT().AddTorrent(gomock.AssignableToTypeOf(ctxType), gomock.Any()).
+		Return(&transmission.NewTorrent{ID: 1, Hash: "abc", Name: "new fancy torrent"}, nil)
+	tr.EXPECT().GetTorrents(gomock.AssignableToTypeOf(ctxType), ids, gomock.Any()).
+		Return([]*transmission.Torrent{torrent}, nil).After(addCall)
+	removeCall := tr.EXPECT().RemoveTorrents(gomock.AssignableToTypeOf(ctxType), ids, true).After(addCall)
+	tg.EXPECT().Send(editMatcher(msg.chatID(), msg.messageID(), `^Ok, not gonna download it`)).After(removeCall)
+
+	run(msg, pick, loc, cancel)
+}
+
+func TestAddTorrent_pickFilesOwner(t *testing.T) {
+	cbID := strings.Repeat("0", callbackIDLen)
+	run, tg, tr := newTestBot(t,
+		WithUsers(
+			User{Name: "adder", ID: 1, Role: RoleAdder},
+			User{Name: "other", ID: 2, Role: RoleAdder},
+		),
+		WithLocations(Location{Name: "loc1", Path: "/path/to/loc1"}),
+		withCallbackIDGenerator(func() string { return cbID }),
+	)
+	gen := new(updateGenerator)
+	expectNoDuplicates(tr)
+
+	msg := gen.newMessage(withMsgText("magnet:/"), withUser("adder"), withUserID(1))
+	pick := gen.newCallback(msg.Message, cbID+"pick", withUser("adder"), withUserID(1))
+	loc := gen.newCallback(msg.Message, cbID+"loc1", withUser("adder"), withUserID(1))
+	otherCancel := gen.newCallback(msg.Message, cbID+"cancel", withUser("other"), withUserID(2))
+	cancel := gen.newCallback(msg.Message, cbID+"cancel", withUser("adder"), withUserID(1))
+	ids := transmission.IDs(transmission.Hash("abc"))
+	torrent := &transmission.Torrent{ID: 1, Hash: "abc", Name: "new fancy torrent", Status: transmission.StatusStopped}
+
+	expectFreeSpace(tr, 1<<30)
+	tg.EXPECT().Send(gomock.Any()).Times(3)
+	tg.EXPECT().AnswerCallbackQuery(tgbotapi.NewCallback(pick.callbackID(), ""))
+	pickerCall := tg.EXPECT().AnswerCallbackQuery(tgbotapi.NewCallback(loc.callbackID(), ""))
+	addCall := tr.EXPECT().AddTorrent(gomock.AssignableToTypeOf(ctxType), gomock.Any()).
+		Return(&transmission.NewTorrent{ID: 1, Hash: "abc", Name: "new fancy torrent"}, nil)
+	tr.EXPECT().GetTorrents(gomock.AssignableToTypeOf(ctxType), ids, gomock.Any()).
+		Return([]*transmission.Torrent{torrent}, nil).MinTimes(1).After(addCall)
+
+	// Only the user who has added the torrent may cancel it
+	forbiddenCall := tg.EXPECT().AnswerCallbackQuery(tgbotapi.NewCallback(otherCancel.callbackID(), forbiddenText)).
+		After(pickerCall)
+	tg.EXPECT().AnswerCallbackQuery(tgbotapi.NewCallback(cancel.callbackID(), "")).After(forbiddenCall)
+	removeCall := tr.EXPECT().RemoveTorrents(gomock.AssignableToTypeOf(ctxType), ids, true).After(forbiddenCall)
+	tg.EXPECT().Send(editMatcher(msg.chatID(), msg.messageID(), `^Ok, not gonna download it`)).After(removeCall)
+
+	run(msg, pick, loc, otherCancel, cancel)
+}
+
+func TestAddTorrent_file(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if want, got := "/files/file_id", r.URL.Path; want != got {
+			t.Errorf("unexpected file download path, want = %q, got = %q", want, got)
+		}
+		if want, got := "GET", r.Method; want != got {
+			t.Errorf("unexpected HTTP method, want = %q, got = %q", want, got)
+		}
+
+		if _, err := w.Write([]byte(testTorrent)); err != nil {
+			t.Errorf("unexpected error sending the file: %v", err)
+		}
+	}))
+	defer srv.Close()
+
+	run, tg, tr := newTestBot(t, WithHTTPClient(srv.Client()))
+	gen := new(updateGenerator)
+	expectNoDuplicates(tr)
+
+	update := gen.newMessage(withDocument("file_id"))
+
+	getFileCall := tg.EXPECT().GetFileDirectURL("file_id").Return(srv.URL+"/files/file_id", nil)
+	addTorrentCall := tr.EXPECT().AddTorrent(
+		gomock.AssignableToTypeOf(ctxType),
+		torrentMatcher([]byte(testTorrent)),
+	).Return(&transmission.NewTorrent{
+		ID:   transmission.ID(1),
+		Hash: transmission.Hash("abc"),
+		Name: "new fancy torrent",
+	}, nil).After(getFileCall)
+	tg.EXPECT().Send(messageMatcher(
+		update.chatID(),
+		`\\<\*1\*\\> new fancy torrent`,
+		hasReplyMsgID(update.messageID()),
+	)).After(getFileCall).After(addTorrentCall)
+
+	run(update)
+}
+
+func TestAddTorrent_fileInvalid(t *testing.T) {
+	srv := newFileServer(t, "<!DOCTYPE html><html></html>")
+	defer srv.Close()
+
+	run, tg, _ := newTestBot(t, WithHTTPClient(srv.Client()))
+	gen := new(updateGenerator)
+
+	update := gen.newMessage(withDocument("file_id"))
+
+	tg.EXPECT().GetFileDirectURL("file_id").Return(srv.URL+"/files/file_id", nil)
+	tg.EXPECT().Send(messageMatcher(
+		update.chatID(),
+		`^This doesn't look like a torrent file \(malformed data at offset 0`,
+		hasReplyMsgID(update.messageID()),
+	))
+
+	run(update)
+}
+
+func TestAddTorrent_fileErrors(t *testing.T) {
+	var tests = []struct {
+		name     string
+		document func(*tgbotapi.Document)
+		handler  http.HandlerFunc
+		reply    string
+	}{
+		{
+			name: "not_torrent",
+			document: func(d *tgbotapi.Document) {
+				d.FileName = "file.txt"
+				d.MimeType = "text/plain"
+			},
+			reply: `^That's not a torrent file$`,
+		},
+		{
+			name: "file_size",
+			document: func(d *tgbotapi.Document) {
+				d.FileSize = 2048
+			},
+			reply: `^That's too big for a torrent file, I only accept files up to 1\.0 KiB$`,
+		},
+		{
+			name: "content_length",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Length", "2048")
+				_, _ = w.Write(make([]byte, 2048))
+			},
+			reply: `^That's too big for a torrent file, I only accept files up to 1\.0 KiB$`,
+		},
+		{
+			name: "body",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.(http.Flusher).Flush()
+				_, _ = w.Write(make([]byte, 2048))
+			},
+			reply: `^That's too big for a torrent file, I only accept files up to 1\.0 KiB$`,
+		},
+		{
+			name: "not_found",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				http.NotFound(w, r)
+			},
+			reply: `^Oops, something went wrong: Telegram responded with "404 Not Found"$`,
+		},
+		{
+			name: "timeout",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				<-r.Context().Done()
+			},
+			reply: `^Oops, something went wrong: timed out downloading the file from Telegram$`,
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			srv := httptest.NewServer(tc.handler)
+			defer srv.Close()
+
+			run, tg, _ := newTestBot(t,
+				WithHTTPClient(srv.Client()),
+				WithMaxTorrentSize(1024),
+				WithDownloadTimeout(100*time.Millisecond),
+			)
+			gen := new(updateGenerator)
+
+			update := gen.newMessage(withDocument("file_id"), func(u *tgbotapi.Update) {
+				if tc.document != nil {
+					tc.document(u.Message.Document)
+				}
+			})
+
+			if tc.handler != nil {
+				tg.EXPECT().GetFileDirectURL("file_id").Return(srv.URL+"/files/file_id", nil)
+			}
+			tg.EXPECT().Send(messageMatcher(update.chatID(), tc.reply))
+
+			run(update)
+		})
+	}
+}
+
+func TestAddTorrent_fileSummary(t *testing.T) {
+	srv := newFileServer(t, testTorrent)
+	defer srv.Close()
+
+	cbID := strings.Repeat("0", callbackIDLen)
+	run, tg, tr := newTestBot(t,
+		WithHTTPClient(srv.Client()),
+		WithLocations(Location{Name: "loc1", Path: "/path/to/loc1"}),
+		withCallbackIDGenerator(func() string { return cbID }),
+	)
+	gen := new(updateGenerator)
+	expectNoDuplicates(tr)
+
+	update := gen.newMessage(withDocument("file_id"))
+
+	tg.EXPECT().GetFileDirectURL("file_id").Return(srv.URL+"/files/file_id", nil)
+	tr.EXPECT().GetSession(gomock.AssignableToTypeOf(ctxType), transmission.SessionFieldDownloadDirectory).
+		Return(&transmission.Session{DownloadDirectory: "/downloads"}, nil)
+	tr.EXPECT().GetFreeSpace(gomock.AssignableToTypeOf(ctxType), "/path/to/loc1").Return(int64(1<<20), nil)
+	tr.EXPECT().GetFreeSpace(gomock.AssignableToTypeOf(ctxType), "/downloads").Return(int64(2<<30), nil)
+	tg.EXPECT().Send(gomock.All(
+		messageMatcher(update.chatID(), `^Ok, gonna queue it for download. But first tell me what is it\?\n\n`+
+			`📦 new fancy torrent\n1\.0 GiB\nTrackers: tracker\n\n`+
+			`⚠️ It needs 1\.0 GiB, which is more than there is free in loc1\.$`),
+		inlineKeyboardMatcher(
+			tgbotapi.NewInlineKeyboardRow(
+				tgbotapi.NewInlineKeyboardButtonData("⚠️ loc1 (1.0 MiB)", cbID+"loc1"),
+				tgbotapi.NewInlineKeyboardButtonData("Other (2.0 GiB)", cbID+"other"),
+			),
+			tgbotapi.NewInlineKeyboardRow(
+				tgbotapi.NewInlineKeyboardButtonData("Pick files", cbID+"pick"),
+				tgbotapi.NewInlineKeyboardButtonData("Cancel", cbID+"cancel"),
+			),
+		),
+	))
+
+	run(update)
+}
+
+func TestStats(t *testing.T) {
 	run, tg, tr := newTestBot(t)
 	gen := new(updateGenerator)
 
@@ -465,10 +1535,15 @@ func TestStats(t *testing.T) {
 			Uploaded:   2415919104,
 		},
 	}, nil)
-	tr.EXPECT().GetSession(gomock.AssignableToTypeOf(ctxType), transmission.SessionFieldTurtleEnabled).
-		Return(&transmission.Session{
-			TurtleEnabled: false,
-		}, nil)
+	tr.EXPECT().GetSession(gomock.AssignableToTypeOf(ctxType),
+		transmission.SessionFieldTurtleEnabled,
+		transmission.SessionFieldTurtleScheduleEnabled,
+		transmission.SessionFieldTurtleScheduleOnDays,
+		transmission.SessionFieldTurtleScheduleStartsAt,
+		transmission.SessionFieldTurtleScheduleStopsAt,
+	).Return(&transmission.Session{
+		TurtleEnabled: false,
+	}, nil)
 	tg.EXPECT().Send(
 		messageMatcher(update.chatID(), `^↓\*2\\\.0 MiB/s\* ↑\*1\\\.0 MiB/s\* 🚀   `+
 			`↻\*3\* ⊗\*10\*   ↓\*1\\\.0 GiB\* ↑\*2\\\.3 GiB\* ☯\*2\\\.25\*$`,
@@ -477,82 +1552,930 @@ func TestStats(t *testing.T) {
 	run(update)
 }
 
-func TestTurtle(t *testing.T) {
+func TestStats_turtle(t *testing.T) {
 	var tests = []struct {
-		name    string
-		command string
-		set     bool
-		expect  string
+		name     string
+		schedule bool
+		expect   string
 	}{
-		{name: "on", command: "turtleon", set: true, expect: "enabled"},
-		{name: "off", command: "turtleoff", set: false, expect: "disabled"},
+		{name: "manual", expect: `^↓\*0 B/s\* ↑\*0 B/s\* 🐢   `},
+		{name: "scheduled", schedule: true, expect: `^↓\*0 B/s\* ↑\*0 B/s\* 🐢⏰   `},
 	}
 
+	// Wednesday
+	now := time.Date(2021, time.March, 3, 23, 30, 0, 0, time.Local)
 	for _, tc := range tests {
 		tc := tc
 		t.Run(tc.name, func(t *testing.T) {
-			run, tg, tr := newTestBot(t)
+			run, tg, tr := newTestBot(t, withClock(func() time.Time { return now }))
 			gen := new(updateGenerator)
 
-			update := gen.newMessage(withCommand(tc.command))
+			update := gen.newMessage(withCommand("stats"))
+
+			tr.EXPECT().GetSessionStats(gomock.AssignableToTypeOf(ctxType)).Return(&transmission.SessionStats{}, nil)
+			tr.EXPECT().GetSession(gomock.AssignableToTypeOf(ctxType), gomock.Any()).Return(&transmission.Session{
+				TurtleEnabled:          true,
+				TurtleScheduleEnabled:  tc.schedule,
+				TurtleScheduleOnDays:   transmission.Wednesday,
+				TurtleScheduleStartsAt: 22 * 60,
+				TurtleScheduleStopsAt:  7 * 60,
+			}, nil)
+			tg.EXPECT().Send(messageMatcher(update.chatID(), tc.expect))
 
-			turtleCall := tr.EXPECT().SetSession(gomock.AssignableToTypeOf(ctxType), &transmission.SetSessionReq{
-				TurtleEnabled: transmission.OptBool(tc.set),
-			}).Return(nil)
-			tg.EXPECT().Send(messageMatcher(update.chatID(), tc.expect)).After(turtleCall)
 			run(update)
 		})
 	}
 }
 
-func TestStartStopTorrents(t *testing.T) {
+func TestSpace(t *testing.T) {
+	run, tg, tr := newTestBot(t, WithLocations(
+		Location{Name: "loc1", Path: "/path/to/loc1"},
+		Location{Name: "loc2", Path: "/path/to/loc2"},
+	))
+	gen := new(updateGenerator)
+
+	update := gen.newMessage(withCommand("space"))
+
+	tr.EXPECT().GetSession(gomock.AssignableToTypeOf(ctxType), transmission.SessionFieldDownloadDirectory).
+		Return(&transmission.Session{DownloadDirectory: "/downloads"}, nil)
+	tr.EXPECT().GetFreeSpace(gomock.AssignableToTypeOf(ctxType), "/downloads").Return(int64(3<<30), nil)
+	tr.EXPECT().GetFreeSpace(gomock.AssignableToTypeOf(ctxType), "/path/to/loc1").Return(int64(1<<40), nil)
+	tr.EXPECT().GetFreeSpace(gomock.AssignableToTypeOf(ctxType), "/path/to/loc2").Return(int64(0), errors.New("no"))
+	tg.EXPECT().Send(messageMatcher(update.chatID(), `^\*Default\* /downloads   💾\*3\\\.0 GiB\* free\n`+
+		`\*loc1\* /path/to/loc1   💾\*1\\\.0 TiB\* free\n`+
+		`\*loc2\* /path/to/loc2   💾 unknown\n$`))
+
+	run(update)
+}
+
+func TestTurtle(t *testing.T) {
+	var tests = []struct {
+		name    string
+		command string
+		set     bool
+		expect  string
+	}{
+		{name: "on", command: "turtleon", set: true, expect: "enabled"},
+		{name: "off", command: "turtleoff", set: false, expect: "disabled"},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			run, tg, tr := newTestBot(t)
+			gen := new(updateGenerator)
+
+			update := gen.newMessage(withCommand(tc.command))
+
+			turtleCall := tr.EXPECT().SetSession(gomock.AssignableToTypeOf(ctxType), &transmission.SetSessionReq{
+				TurtleEnabled: transmission.OptBool(tc.set),
+			}).Return(nil)
+			tg.EXPECT().Send(messageMatcher(update.chatID(), tc.expect)).After(turtleCall)
+			run(update)
+		})
+	}
+}
+
+func TestTurtle_rates(t *testing.T) {
+	var tests = []struct {
+		name   string
+		args   string
+		req    *transmission.SetSessionReq
+		expect string
+	}{
+		{
+			name: "both",
+			args: "down=3M up=500 KiB",
+			req: &transmission.SetSessionReq{
+				TurtleDownloadRateLimit: transmission.OptInt64(3 << 20),
+				TurtleUploadRateLimit:   transmission.OptInt64(500 << 10),
+			},
+			expect: `^🚀 Turtle mode is \*off\*\nTurtle speeds: ↓\*3\\\.0 MiB/s\* ↑\*500 KiB/s\*`,
+		},
+		{
+			name:   "up",
+			args:   "up=1.5M",
+			req:    &transmission.SetSessionReq{TurtleUploadRateLimit: transmission.OptInt64(3 << 19)},
+			expect: `^🚀 Turtle mode is \*off\*`,
+		},
+		{
+			name:   "unlimited",
+			args:   "down=off",
+			expect: `^turtle mode speeds can't be unlimited\. Tell me the turtle mode speeds`,
+		},
+		{
+			name:   "too_slow",
+			args:   "down=500",
+			expect: `^speed must be at least 1 KiB\. Tell me the turtle mode speeds`,
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			cbID := strings.Repeat("0", callbackIDLen)
+			run, tg, tr := newTestBot(t, withCallbackIDGenerator(func() string { return cbID }))
+			gen := new(updateGenerator)
+
+			update := gen.newMessage(withCommand("turtle", tc.args))
+
+			if tc.req != nil {
+				setCall := tr.EXPECT().SetSession(gomock.AssignableToTypeOf(ctxType), tc.req).Return(nil)
+				tr.EXPECT().GetSession(gomock.AssignableToTypeOf(ctxType), turtleFields).
+					Return(&transmission.Session{
+						TurtleDownloadRateLimit: 3 << 20,
+						TurtleUploadRateLimit:   500 << 10,
+					}, nil).After(setCall)
+			}
+			tg.EXPECT().Send(messageMatcher(update.chatID(), tc.expect))
+			run(update)
+		})
+	}
+}
+
+func TestTurtleEditor(t *testing.T) {
+	cbID := strings.Repeat("0", callbackIDLen)
+	// Saturday
+	now := time.Date(2021, time.March, 6, 12, 0, 0, 0, time.Local)
+	run, tg, tr := newTestBot(t,
+		withCallbackIDGenerator(func() string { return cbID }),
+		withClock(func() time.Time { return now }),
+	)
+	gen := new(updateGenerator)
+
+	msg := gen.newMessage(withCommand("turtle"))
+	day := gen.newCallback(msg.Message, cbID+"day5")
+	start := gen.newCallback(msg.Message, cbID+"start-")
+	done := gen.newCallback(msg.Message, cbID+"done")
+
+	session := &transmission.Session{
+		TurtleDownloadRateLimit: 100 << 10,
+		TurtleUploadRateLimit:   50 << 10,
+		TurtleScheduleEnabled:   true,
+		TurtleScheduleOnDays:    transmission.Monday | transmission.Tuesday | transmission.Wednesday,
+		TurtleScheduleStartsAt:  10 * 60,
+		TurtleScheduleStopsAt:   18 * 60,
+	}
+	scheduled := *session
+	scheduled.TurtleEnabled = true
+	scheduled.TurtleScheduleOnDays |= transmission.Saturday
+	moved := scheduled
+	moved.TurtleScheduleStartsAt = 9*60 + 30
+
+	getSession := func(s *transmission.Session) *gomock.Call {
+		return tr.EXPECT().GetSession(gomock.AssignableToTypeOf(ctxType), turtleFields).Return(s, nil)
+	}
+	dayRow := func(days ...bool) []tgbotapi.InlineKeyboardButton {
+		var row []tgbotapi.InlineKeyboardButton
+		for i, d := range turtleDays {
+			mark := "⬜"
+			if days[i] {
+				mark = "✅"
+			}
+			row = append(row, tgbotapi.NewInlineKeyboardButtonData(mark+d.Name, fmt.Sprintf("%sday%d", cbID, i)))
+		}
+		return row
+	}
+	keyboard := func(toggle string, days ...bool) gomock.Matcher {
+		return inlineKeyboardMatcher(
+			tgbotapi.NewInlineKeyboardRow(
+				tgbotapi.NewInlineKeyboardButtonData(toggle, cbID+"toggle"),
+				tgbotapi.NewInlineKeyboardButtonData("Disable schedule", cbID+"schedule"),
+			),
+			tgbotapi.NewInlineKeyboardRow(
+				tgbotapi.NewInlineKeyboardButtonData("Start −30m", cbID+"start-"),
+				tgbotapi.NewInlineKeyboardButtonData("Start +30m", cbID+"start+"),
+				tgbotapi.NewInlineKeyboardButtonData("End −30m", cbID+"end-"),
+				tgbotapi.NewInlineKeyboardButtonData("End +30m", cbID+"end+"),
+			),
+			dayRow(days...),
+			tgbotapi.NewInlineKeyboardRow(
+				tgbotapi.NewInlineKeyboardButtonData("↓ ÷2", cbID+"down-"),
+				tgbotapi.NewInlineKeyboardButtonData("↓ ×2", cbID+"down+"),
+				tgbotapi.NewInlineKeyboardButtonData("↑ ÷2", cbID+"up-"),
+				tgbotapi.NewInlineKeyboardButtonData("↑ ×2", cbID+"up+"),
+			),
+			tgbotapi.NewInlineKeyboardRow(
+				tgbotapi.NewInlineKeyboardButtonData("Done", cbID+"done"),
+			),
+		)
+	}
+
+	call := getSession(session)
+	call = tg.EXPECT().Send(gomock.All(
+		messageMatcher(msg.chatID(), `^🚀 Turtle mode is \*off\*\n`+
+			`Turtle speeds: ↓\*100 KiB/s\* ↑\*50 KiB/s\*\n`+
+			`Schedule: \*10:00\*–\*18:00\* on \*Monday, Tuesday, Wednesday\*$`),
+		keyboard("Turn on", true, true, true, false, false, false, false),
+	)).After(call)
+
+	call = tg.EXPECT().AnswerCallbackQuery(tgbotapi.NewCallback(day.callbackID(), "")).After(call)
+	call = getSession(session).After(call)
+	call = tr.EXPECT().SetSession(gomock.AssignableToTypeOf(ctxType), &transmission.SetSessionReq{
+		TurtleScheduleOnDays: transmission.OptWeekday(scheduled.TurtleScheduleOnDays),
+	}).Return(nil).After(call)
+	call = getSession(&scheduled).After(call)
+	call = tg.EXPECT().Send(gomock.All(
+		editMatcher(msg.chatID(), msg.messageID(), `^🐢 Turtle mode is \*on\* by schedule\n`),
+		keyboard("Turn off", true, true, true, false, false, true, false),
+	)).After(call)
+
+	call = tg.EXPECT().AnswerCallbackQuery(tgbotapi.NewCallback(start.callbackID(), "")).After(call)
+	call = getSession(&scheduled).After(call)
+	call = tr.EXPECT().SetSession(gomock.AssignableToTypeOf(ctxType), &transmission.SetSessionReq{
+		TurtleScheduleStartsAt: transmission.OptInt(9*60 + 30),
+	}).Return(nil).After(call)
+	call = getSession(&moved).After(call)
+	call = tg.EXPECT().Send(editMatcher(msg.chatID(), msg.messageID(), `Schedule: \*09:30\*–\*18:00\*`)).After(call)
+
+	call = tg.EXPECT().AnswerCallbackQuery(tgbotapi.NewCallback(done.callbackID(), "")).After(call)
+	call = getSession(&moved).After(call)
+	tg.EXPECT().Send(editMatcher(msg.chatID(), msg.messageID(),
+		`^(?s)🐢 Turtle mode is \*on\* by schedule\n.*on \*Monday, Tuesday, Wednesday, Saturday\*$`)).After(call)
+
+	run(msg, day, start, done)
+}
+
+func TestTurtleRequest(t *testing.T) {
+	session := &transmission.Session{
+		TurtleDownloadRateLimit: 1 << 10,
+		TurtleUploadRateLimit:   50 << 10,
+		TurtleScheduleOnDays:    transmission.Sunday,
+		TurtleScheduleStartsAt:  0,
+		TurtleScheduleStopsAt:   23*60 + 45,
+	}
+
+	var tests = []struct {
+		action string
+		want   *transmission.SetSessionReq
+	}{
+		{action: "toggle", want: &transmission.SetSessionReq{TurtleEnabled: transmission.OptBool(true)}},
+		{action: "schedule", want: &transmission.SetSessionReq{TurtleScheduleEnabled: transmission.OptBool(true)}},
+		{action: "start-", want: &transmission.SetSessionReq{TurtleScheduleStartsAt: transmission.OptInt(23*60 + 30)}},
+		{action: "end+", want: &transmission.SetSessionReq{TurtleScheduleStopsAt: transmission.OptInt(15)}},
+		{action: "down-", want: &transmission.SetSessionReq{TurtleDownloadRateLimit: transmission.OptInt64(1 << 10)}},
+		{action: "up+", want: &transmission.SetSessionReq{TurtleUploadRateLimit: transmission.OptInt64(100 << 10)}},
+		{action: "day6", want: &transmission.SetSessionReq{TurtleScheduleOnDays: transmission.OptWeekday(0)}},
+		{action: "day7"},
+		{action: "sideways"},
+	}
+
+	for _, tc := range tests {
+		got, err := turtleRequest(session, tc.action)
+		if tc.want == nil {
+			if err == nil {
+				t.Errorf("%s: expected an error", tc.action)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", tc.action, err)
+		}
+		if !reflect.DeepEqual(tc.want, got) {
+			t.Errorf("%s: unexpected request, want = %+v, got = %+v", tc.action, tc.want, got)
+		}
+	}
+}
+
+func TestTurtleScheduled(t *testing.T) {
+	session := &transmission.Session{
+		TurtleScheduleEnabled:  true,
+		TurtleScheduleOnDays:   transmission.Friday,
+		TurtleScheduleStartsAt: 22 * 60,
+		TurtleScheduleStopsAt:  7 * 60,
+	}
+	daytime := &transmission.Session{
+		TurtleScheduleEnabled:  true,
+		TurtleScheduleOnDays:   transmission.Friday,
+		TurtleScheduleStartsAt: 9 * 60,
+		TurtleScheduleStopsAt:  17 * 60,
+	}
+
+	var tests = []struct {
+		name    string
+		session *transmission.Session
+		now     time.Time
+		want    bool
+	}{
+		{name: "friday_night", session: session, now: time.Date(2021, time.March, 5, 23, 0, 0, 0, time.UTC), want: true},
+		{name: "saturday_morning", session: session, now: time.Date(2021, time.March, 6, 6, 59, 0, 0, time.UTC), want: true},
+		{name: "saturday_night", session: session, now: time.Date(2021, time.March, 6, 23, 0, 0, 0, time.UTC)},
+		{name: "friday_morning", session: session, now: time.Date(2021, time.March, 5, 6, 0, 0, 0, time.UTC)},
+		{name: "friday_day", session: session, now: time.Date(2021, time.March, 5, 12, 0, 0, 0, time.UTC)},
+		{name: "daytime", session: daytime, now: time.Date(2021, time.March, 5, 9, 0, 0, 0, time.UTC), want: true},
+		{name: "daytime_end", session: daytime, now: time.Date(2021, time.March, 5, 17, 0, 0, 0, time.UTC)},
+		{
+			name:    "disabled",
+			session: &transmission.Session{TurtleScheduleOnDays: transmission.Friday, TurtleScheduleStopsAt: 24 * 60},
+			now:     time.Date(2021, time.March, 5, 12, 0, 0, 0, time.UTC),
+		},
+	}
+
+	for _, tc := range tests {
+		if got := turtleScheduled(tc.session, tc.now); tc.want != got {
+			t.Errorf("%s: unexpected result, want = %t, got = %t", tc.name, tc.want, got)
+		}
+	}
+}
+
+func TestStartStopTorrents(t *testing.T) {
+	var tests = []struct {
+		name      string
+		command   string
+		args      string
+		isStart   bool
+		expectIDs transmission.Identifier
+	}{
+		{
+			name:    "resume_all",
+			command: "resume",
+			isStart: true,
+		},
+		{
+			name:      "resume_two",
+			command:   "resume",
+			args:      "2   7",
+			isStart:   true,
+			expectIDs: transmission.IDs(transmission.ID(2), transmission.ID(7)),
+		},
+		{
+			name:      "pause_one",
+			command:   "stop",
+			args:      "3",
+			expectIDs: transmission.IDs(transmission.ID(3)),
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			run, tg, tr := newTestBot(t)
+			gen := new(updateGenerator)
+
+			update := gen.newMessage(withCommand(tc.command, tc.args))
+
+			call := tr.EXPECT().StopTorrents
+			if tc.isStart {
+				call = tr.EXPECT().StartTorrents
+			}
+
+			startStopCall := call(gomock.AssignableToTypeOf(ctxType), tc.expectIDs).Return(nil)
+			tg.EXPECT().Send(messageMatcher(update.chatID(), "Done")).After(startStopCall)
+			run(update)
+		})
+	}
+}
+
+func TestLimit(t *testing.T) {
+	var tests = []struct {
+		name    string
+		command string
+		args    string
+		ids     transmission.Identifier
+		req     *transmission.SetTorrentReq
+		expect  string
+	}{
+		{
+			name:    "limit",
+			command: "limit",
+			args:    "1 2 down=2M up=500K",
+			ids:     transmission.IDs(transmission.ID(1), transmission.ID(2)),
+			req: &transmission.SetTorrentReq{
+				DownloadRateLimit:        transmission.OptInt64(2 << 20),
+				DownloadRateLimitEnabled: transmission.OptBool(true),
+				UploadRateLimit:          transmission.OptInt64(500 << 10),
+				UploadRateLimitEnabled:   transmission.OptBool(true),
+			},
+			expect: "Done",
+		},
+		{
+			name:    "limit_up_off",
+			command: "limit",
+			args:    "3 up=off",
+			ids:     transmission.IDs(transmission.ID(3)),
+			req:     &transmission.SetTorrentReq{UploadRateLimitEnabled: transmission.OptBool(false)},
+			expect:  "Done",
+		},
+		{
+			name:    "limit_off",
+			command: "limit",
+			args:    "3 off",
+			ids:     transmission.IDs(transmission.ID(3)),
+			req: &transmission.SetTorrentReq{
+				DownloadRateLimitEnabled: transmission.OptBool(false),
+				UploadRateLimitEnabled:   transmission.OptBool(false),
+			},
+			expect: "Done",
+		},
+		{
+			name:    "limit_no_ids",
+			command: "limit",
+			args:    "down=1M",
+			expect:  "^Tell me which torrents to limit",
+		},
+		{
+			name:    "limit_bad_speed",
+			command: "limit",
+			args:    "1 down=fast",
+			expect:  `^"fast" is not a valid speed\. Tell me`,
+		},
+		{
+			name:    "limit_unknown",
+			command: "limit",
+			args:    "1 sideways=1M",
+			expect:  `^I don't know what "sideways" is\. Tell me`,
+		},
+		{
+			name:    "priority",
+			command: "priority",
+			args:    "4 HIGH",
+			ids:     transmission.IDs(transmission.ID(4)),
+			req:     &transmission.SetTorrentReq{Priority: transmission.OptPriority(transmission.PriorityHigh)},
+			expect:  "Done",
+		},
+		{
+			name:    "priority_unknown",
+			command: "priority",
+			args:    "4 urgent",
+			expect:  "^Tell me which torrents to prioritize",
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			run, tg, tr := newTestBot(t)
+			gen := new(updateGenerator)
+
+			update := gen.newMessage(withCommand(tc.command, tc.args))
+
+			if tc.req != nil {
+				tr.EXPECT().SetTorrents(gomock.AssignableToTypeOf(ctxType), tc.ids, tc.req).Return(nil)
+			}
+			tg.EXPECT().Send(messageMatcher(update.chatID(), tc.expect))
+			run(update)
+		})
+	}
+}
+
+func TestSeedPolicy(t *testing.T) {
+	var tests = []struct {
+		name    string
+		args    string
+		ids     transmission.Identifier
+		torrent *transmission.SetTorrentReq
+		session *transmission.SetSessionReq
+		current *transmission.Session
+		expect  string
+	}{
+		{
+			name:    "show",
+			current: &transmission.Session{UploadRatio: 1.5, UploadRatioEnabled: true},
+			expect:  `^Torrents stop seeding at ratio \*1\\\.5\*$`,
+		},
+		{
+			name: "show_both",
+			current: &transmission.Session{
+				UploadRatio:             2,
+				UploadRatioEnabled:      true,
+				IdleSeedingLimit:        90 * time.Minute,
+				IdleSeedingLimitEnabled: true,
+			},
+			expect: `^Torrents stop seeding at ratio \*2\* or after being idle for \*1h30m\*$`,
+		},
+		{
+			name: "set_global",
+			args: "ratio=2 idle=60m",
+			session: &transmission.SetSessionReq{
+				UploadRatioLimit:        transmission.OptFloat64(2),
+				UploadRatioLimitEnabled: transmission.OptBool(true),
+				IdleSeedingLimit:        transmission.OptDuration(time.Hour),
+				IdleSeedingLimitEnabled: transmission.OptBool(true),
+			},
+			current: &transmission.Session{IdleSeedingLimit: time.Hour},
+			expect:  `^Torrents seed forever$`,
+		},
+		{
+			name:    "set_global_unlimited",
+			args:    "ratio=unlimited",
+			session: &transmission.SetSessionReq{UploadRatioLimitEnabled: transmission.OptBool(false)},
+			current: &transmission.Session{IdleSeedingLimit: time.Hour, IdleSeedingLimitEnabled: true},
+			expect:  `^Torrents stop seeding after being idle for \*1h\*$`,
+		},
+		{
+			name: "set_torrents",
+			args: "1 2 ratio=0.5 idle=global",
+			ids:  transmission.IDs(transmission.ID(1), transmission.ID(2)),
+			torrent: &transmission.SetTorrentReq{
+				UploadRatioLimit:     transmission.OptFloat64(0.5),
+				UploadRatioLimitMode: transmission.OptLimit(transmission.LimitLocal),
+				IdleSeedingLimitMode: transmission.OptLimit(transmission.LimitGlobal),
+			},
+			expect: "Done",
+		},
+		{
+			name: "set_torrent_unlimited",
+			args: "3 ratio=unlimited",
+			ids:  transmission.IDs(transmission.ID(3)),
+			torrent: &transmission.SetTorrentReq{
+				UploadRatioLimitMode: transmission.OptLimit(transmission.LimitUnlimited),
+			},
+			expect: "Done",
+		},
+		{
+			name:   "torrents_no_settings",
+			args:   "3",
+			expect: "^Tell me how long to seed",
+		},
+		{
+			name:   "global_is_per_torrent",
+			args:   "ratio=global",
+			expect: `^"global" is not a valid ratio\. Tell me`,
+		},
+		{
+			name:   "nan_ratio",
+			args:   "ratio=nan",
+			expect: `^"nan" is not a valid ratio\. Tell me`,
+		},
+		{
+			name:   "inf_ratio",
+			args:   "1 ratio=+Inf",
+			expect: `^"\+Inf" is not a valid ratio\. Tell me`,
+		},
+		{
+			name:   "short_idle",
+			args:   "1 idle=30s",
+			expect: `^"30s" is not a valid idle time`,
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			run, tg, tr := newTestBot(t)
+			gen := new(updateGenerator)
+
+			update := gen.newMessage(withCommand("seedpolicy", tc.args))
+
+			if tc.torrent != nil {
+				tr.EXPECT().SetTorrents(gomock.AssignableToTypeOf(ctxType), tc.ids, tc.torrent).Return(nil)
+			}
+			var setCall *gomock.Call
+			if tc.session != nil {
+				setCall = tr.EXPECT().SetSession(gomock.AssignableToTypeOf(ctxType), tc.session).Return(nil)
+			}
+			if tc.current != nil {
+				getCall := tr.EXPECT().GetSession(gomock.AssignableToTypeOf(ctxType),
+					transmission.SessionFieldUploadRatio,
+					transmission.SessionFieldUploadRatioEnabled,
+					transmission.SessionFieldIdleSeedingLimit,
+					transmission.SessionFieldIdleSeedingLimitEnabled,
+				).Return(tc.current, nil)
+				if setCall != nil {
+					getCall.After(setCall)
+				}
+			}
+			tg.EXPECT().Send(messageMatcher(update.chatID(), tc.expect))
+			run(update)
+		})
+	}
+}
+
+func TestSpeed(t *testing.T) {
+	var tests = []struct {
+		name   string
+		args   string
+		req    *transmission.SetSessionReq
+		expect string
+	}{
+		{
+			name:   "show",
+			expect: `^Speed limits: ↓\*8\\\.0 MiB/s\* ↑\*unlimited\*$`,
+		},
+		{
+			name: "set",
+			args: "down=8M up=1.0 MiB",
+			req: &transmission.SetSessionReq{
+				DownloadRateLimit:        transmission.OptInt64(8 << 20),
+				DownloadRateLimitEnabled: transmission.OptBool(true),
+				UploadRateLimit:          transmission.OptInt64(1 << 20),
+				UploadRateLimitEnabled:   transmission.OptBool(true),
+			},
+			expect: `^Speed limits:`,
+		},
+		{
+			name: "set_si",
+			args: "up=500 kB/s",
+			req: &transmission.SetSessionReq{
+				UploadRateLimit:        transmission.OptInt64(500000),
+				UploadRateLimitEnabled: transmission.OptBool(true),
+			},
+			expect: `^Speed limits:`,
+		},
+		{
+			name:   "set_unlimited",
+			args:   "down=unlimited",
+			req:    &transmission.SetSessionReq{DownloadRateLimitEnabled: transmission.OptBool(false)},
+			expect: `^Speed limits:`,
+		},
+		{
+			name:   "invalid",
+			args:   "down=1 MiB up=fast",
+			expect: `^"fast" is not a valid speed\. Tell me the speed limits`,
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			cbID := strings.Repeat("0", callbackIDLen)
+			run, tg, tr := newTestBot(t, withCallbackIDGenerator(func() string { return cbID }))
+			gen := new(updateGenerator)
+
+			update := gen.newMessage(withCommand("speed", tc.args))
+
+			var setCall *gomock.Call
+			if tc.req != nil {
+				setCall = tr.EXPECT().SetSession(gomock.AssignableToTypeOf(ctxType), tc.req).Return(nil)
+			}
+			if !strings.Contains(tc.expect, "Tell me") {
+				getCall := tr.EXPECT().GetSession(gomock.AssignableToTypeOf(ctxType), gomock.Any()).
+					Return(&transmission.Session{DownloadRateLimit: 8 << 20, DownloadRateLimitEnabled: true}, nil)
+				if setCall != nil {
+					getCall.After(setCall)
+				}
+			}
+			tg.EXPECT().Send(messageMatcher(update.chatID(), tc.expect))
+			run(update)
+		})
+	}
+}
+
+func TestSpeed_presets(t *testing.T) {
+	cbID := strings.Repeat("0", callbackIDLen)
+	run, tg, tr := newTestBot(t, withCallbackIDGenerator(func() string { return cbID }))
+	gen := new(updateGenerator)
+
+	msg := gen.newMessage(withCommand("speed"))
+	cb := gen.newCallback(msg.Message, cbID+"up=5M")
+
+	fields := []interface{}{
+		transmission.SessionFieldDownloadRateLimit,
+		transmission.SessionFieldDownloadRateLimitEnabled,
+		transmission.SessionFieldUploadRateLimit,
+		transmission.SessionFieldUploadRateLimitEnabled,
+		transmission.SessionFieldTurtleEnabled,
+	}
+	presets := inlineKeyboardMatcher(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("↓ 1M", cbID+"down=1M"),
+			tgbotapi.NewInlineKeyboardButtonData("↓ 5M", cbID+"down=5M"),
+			tgbotapi.NewInlineKeyboardButtonData("↓ 10M", cbID+"down=10M"),
+			tgbotapi.NewInlineKeyboardButtonData("↓ ∞", cbID+"down=off"),
+		),
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("↑ 1M", cbID+"up=1M"),
+			tgbotapi.NewInlineKeyboardButtonData("↑ 5M", cbID+"up=5M"),
+			tgbotapi.NewInlineKeyboardButtonData("↑ 10M", cbID+"up=10M"),
+			tgbotapi.NewInlineKeyboardButtonData("↑ ∞", cbID+"up=off"),
+		),
+	)
+
+	call := tr.EXPECT().GetSession(gomock.AssignableToTypeOf(ctxType), fields...).
+		Return(&transmission.Session{TurtleEnabled: true}, nil)
+	call = tg.EXPECT().Send(gomock.All(
+		messageMatcher(msg.chatID(), `^Speed limits: ↓\*unlimited\* ↑\*unlimited\*\n\n🐢 Turtle mode is on`),
+		presets,
+	)).After(call)
+	call = tg.EXPECT().AnswerCallbackQuery(tgbotapi.NewCallback(cb.callbackID(), "")).After(call)
+	call = tr.EXPECT().SetSession(gomock.AssignableToTypeOf(ctxType), &transmission.SetSessionReq{
+		UploadRateLimit:        transmission.OptInt64(5 << 20),
+		UploadRateLimitEnabled: transmission.OptBool(true),
+	}).Return(nil).After(call)
+	call = tr.EXPECT().GetSession(gomock.AssignableToTypeOf(ctxType), fields...).Return(&transmission.Session{
+		UploadRateLimit:        5 << 20,
+		UploadRateLimitEnabled: true,
+	}, nil).After(call)
+	tg.EXPECT().Send(gomock.All(
+		editMatcher(msg.chatID(), msg.messageID(), `^Speed limits: ↓\*unlimited\* ↑\*5\\\.0 MiB/s\*$`),
+		presets,
+	)).After(call)
+
+	run(msg, cb)
+}
+
+func TestParseRate(t *testing.T) {
+	var tests = []struct {
+		rate string
+		want int64
+	}{
+		{rate: "500K", want: 500 << 10},
+		{rate: "2MiB/s", want: 2 << 20},
+		{rate: "1.5 GiB", want: 3 << 29},
+		{rate: "1K", want: 1 << 10},
+		{rate: "1024 B", want: 1 << 10},
+		{rate: "8MB", want: 8000000},
+		{rate: "100kB/s", want: 100000},
+		{rate: "0"},
+		{rate: "500"},
+		{rate: "1023 B"},
+		{rate: "fast"},
+	}
+
+	for _, tc := range tests {
+		got, err := parseRate(tc.rate)
+		if tc.want == 0 {
+			if err == nil {
+				t.Errorf("%s: expected an error", tc.rate)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tc.rate, err)
+		}
+		if tc.want != got {
+			t.Errorf("%s: unexpected rate, want = %d, got = %d", tc.rate, tc.want, got)
+		}
+	}
+}
+
+func TestJoinUnits(t *testing.T) {
+	got := joinUnits(strings.Fields("down=1.0 MiB up=500 kB/s idle=5 off B"))
+	want := []string{"down=1.0 MiB", "up=500 kB/s", "idle=5", "off", "B"}
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("unexpected fields, want = %q, got = %q", want, got)
+	}
+}
+
+func TestQueue(t *testing.T) {
 	var tests = []struct {
-		name      string
-		command   string
-		args      string
-		isStart   bool
-		expectIDs transmission.Identifier
+		name   string
+		args   string
+		req    *transmission.SetSessionReq
+		expect string
 	}{
 		{
-			name:    "resume_all",
-			command: "resume",
-			isStart: true,
+			name:   "show",
+			expect: `^Downloading \*2\* at a time\n\n\*1\*\\\. \\<\*3\*\\> \*Second\*\nDownloading\n`,
 		},
 		{
-			name:      "resume_two",
-			command:   "resume",
-			args:      "2   7",
-			isStart:   true,
-			expectIDs: transmission.IDs(transmission.ID(2), transmission.ID(7)),
+			name: "size",
+			args: "size=2",
+			req: &transmission.SetSessionReq{
+				DownloadQueueLimit:        transmission.OptInt(2),
+				DownloadQueueLimitEnabled: transmission.OptBool(true),
+			},
+			expect: `^Downloading \*2\* at a time`,
 		},
 		{
-			name:      "pause_one",
-			command:   "stop",
-			args:      "3",
-			expectIDs: transmission.IDs(transmission.ID(3)),
+			name:   "size_off",
+			args:   "size=off",
+			req:    &transmission.SetSessionReq{DownloadQueueLimitEnabled: transmission.OptBool(false)},
+			expect: `^Downloading \*2\* at a time`,
+		},
+		{
+			name:   "invalid",
+			args:   "size=0",
+			expect: `^"0" is not a valid queue size\. Tell me the download queue size`,
+		},
+		{
+			name:   "unknown",
+			args:   "limit=2",
+			expect: `^I don't understand "limit=2"\. Tell me the download queue size`,
 		},
 	}
 
 	for _, tc := range tests {
 		tc := tc
 		t.Run(tc.name, func(t *testing.T) {
-			run, tg, tr := newTestBot(t)
+			cbID := strings.Repeat("0", callbackIDLen)
+			run, tg, tr := newTestBot(t, withCallbackIDGenerator(func() string { return cbID }))
 			gen := new(updateGenerator)
 
-			update := gen.newMessage(withCommand(tc.command, tc.args))
+			update := gen.newMessage(withCommand("queue", tc.args))
 
-			call := tr.EXPECT().StopTorrents
-			if tc.isStart {
-				call = tr.EXPECT().StartTorrents
+			if !strings.Contains(tc.expect, "Tell me") {
+				var call *gomock.Call
+				if tc.req != nil {
+					call = tr.EXPECT().SetSession(gomock.AssignableToTypeOf(ctxType), tc.req).Return(nil)
+				}
+				getCall := tr.EXPECT().GetSession(gomock.AssignableToTypeOf(ctxType),
+					transmission.SessionFieldDownloadQueueLimit,
+					transmission.SessionFieldDownloadQueueLimitEnabled,
+				).Return(&transmission.Session{DownloadQueueLimit: 2, DownloadQueueLimitEnabled: true}, nil)
+				if call != nil {
+					getCall.After(call)
+				}
+				tr.EXPECT().GetTorrents(gomock.AssignableToTypeOf(ctxType), transmission.All(),
+					transmission.TorrentFieldID,
+					transmission.TorrentFieldName,
+					transmission.TorrentFieldStatus,
+					transmission.TorrentFieldPositionInQueue,
+				).Return([]*transmission.Torrent{
+					{ID: 1, Name: "Seeding", Status: transmission.StatusSeed, PositionInQueue: 0},
+					{ID: 2, Name: "Third", Status: transmission.StatusDownloadWait, PositionInQueue: 3},
+					{ID: 3, Name: "Second", Status: transmission.StatusDownload, PositionInQueue: 1},
+					{ID: 4, Name: "Stopped", Status: transmission.StatusStopped, PositionInQueue: 2},
+				}, nil).After(getCall)
 			}
-
-			startStopCall := call(gomock.AssignableToTypeOf(ctxType), tc.expectIDs).Return(nil)
-			tg.EXPECT().Send(messageMatcher(update.chatID(), "Done")).After(startStopCall)
+			matchers := []gomock.Matcher{messageMatcher(update.chatID(), tc.expect)}
+			if tc.name == "show" {
+				matchers = append(matchers,
+					messageMatcher(update.chatID(), `(?s)\*2\*\\\. \\<\*2\*\\> \*Third\*\nQueued for downloading\n$`),
+					inlineKeyboardMatcher(
+						tgbotapi.NewInlineKeyboardRow(
+							tgbotapi.NewInlineKeyboardButtonData("3 ⏫", cbID+"top3"),
+							tgbotapi.NewInlineKeyboardButtonData("3 🔼", cbID+"up3"),
+							tgbotapi.NewInlineKeyboardButtonData("3 🔽", cbID+"down3"),
+							tgbotapi.NewInlineKeyboardButtonData("3 ⏬", cbID+"bottom3"),
+						),
+						tgbotapi.NewInlineKeyboardRow(
+							tgbotapi.NewInlineKeyboardButtonData("2 ⏫", cbID+"top2"),
+							tgbotapi.NewInlineKeyboardButtonData("2 🔼", cbID+"up2"),
+							tgbotapi.NewInlineKeyboardButtonData("2 🔽", cbID+"down2"),
+							tgbotapi.NewInlineKeyboardButtonData("2 ⏬", cbID+"bottom2"),
+						),
+					),
+				)
+			}
+			tg.EXPECT().Send(gomock.All(matchers...))
 			run(update)
 		})
 	}
 }
 
+func TestQueue_move(t *testing.T) {
+	cbID := strings.Repeat("0", callbackIDLen)
+	run, tg, tr := newTestBot(t, withCallbackIDGenerator(func() string { return cbID }))
+	gen := new(updateGenerator)
+
+	msg := gen.newMessage(withCommand("queue"))
+	cb := gen.newCallback(msg.Message, cbID+"top2")
+
+	queue := func(first, second *transmission.Torrent) *gomock.Call {
+		tr.EXPECT().GetSession(gomock.AssignableToTypeOf(ctxType), gomock.Any(), gomock.Any()).
+			Return(&transmission.Session{}, nil)
+		return tr.EXPECT().GetTorrents(gomock.AssignableToTypeOf(ctxType), transmission.All(),
+			gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
+			Return([]*transmission.Torrent{first, second}, nil)
+	}
+
+	call := queue(
+		&transmission.Torrent{ID: 1, Name: "First", Status: transmission.StatusDownload, PositionInQueue: 0},
+		&transmission.Torrent{ID: 2, Name: "Second", Status: transmission.StatusDownloadWait, PositionInQueue: 1},
+	)
+	call = tg.EXPECT().Send(messageMatcher(msg.chatID(),
+		`^Download queue size is not limited\n\n\*1\*\\\. \\<\*1\*\\> \*First\*`)).After(call)
+	call = tg.EXPECT().AnswerCallbackQuery(tgbotapi.NewCallback(cb.callbackID(), "")).After(call)
+	call = tr.EXPECT().QueueMoveToTop(gomock.AssignableToTypeOf(ctxType), transmission.IDs(transmission.ID(2))).
+		Return(nil).After(call)
+	call = queue(
+		&transmission.Torrent{ID: 1, Name: "First", Status: transmission.StatusDownloadWait, PositionInQueue: 1},
+		&transmission.Torrent{ID: 2, Name: "Second", Status: transmission.StatusDownload, PositionInQueue: 0},
+	).After(call)
+	tg.EXPECT().Send(editMatcher(msg.chatID(), msg.messageID(),
+		`^Download queue size is not limited\n\n\*1\*\\\. \\<\*2\*\\> \*Second\*`)).After(call)
+
+	run(msg, cb)
+}
+
+func TestQueue_moveUpDown(t *testing.T) {
+	cbID := strings.Repeat("0", callbackIDLen)
+	run, tg, tr := newTestBot(t, withCallbackIDGenerator(func() string { return cbID }))
+	gen := new(updateGenerator)
+
+	msg := gen.newMessage(withCommand("queue"))
+	up := gen.newCallback(msg.Message, cbID+"up3")
+	down := gen.newCallback(msg.Message, cbID+"down1")
+	first := gen.newCallback(msg.Message, cbID+"up1")
+
+	// The seeding torrent sits between the queued ones, yet the queued ones
+	// are swapped with each other rather than with it
+	tr.EXPECT().GetSession(gomock.AssignableToTypeOf(ctxType), gomock.Any(), gomock.Any()).
+		Return(&transmission.Session{}, nil).AnyTimes()
+	tr.EXPECT().GetTorrents(gomock.AssignableToTypeOf(ctxType), transmission.All(), gomock.Any(), gomock.Any(),
+		gomock.Any(), gomock.Any()).Return([]*transmission.Torrent{
+		{ID: 1, Name: "First", Status: transmission.StatusDownload, PositionInQueue: 0},
+		{ID: 2, Name: "Seeding", Status: transmission.StatusSeed, PositionInQueue: 1},
+		{ID: 3, Name: "Second", Status: transmission.StatusDownloadWait, PositionInQueue: 2},
+	}, nil).AnyTimes()
+
+	call := tg.EXPECT().Send(messageMatcher(msg.chatID(), `^Download queue size is not limited`))
+	call = tg.EXPECT().AnswerCallbackQuery(tgbotapi.NewCallback(up.callbackID(), "")).After(call)
+	call = tr.EXPECT().SetTorrents(gomock.AssignableToTypeOf(ctxType), transmission.IDs(transmission.ID(3)),
+		&transmission.SetTorrentReq{PositionInQueue: transmission.OptInt(0)}).Return(nil).After(call)
+	call = tg.EXPECT().Send(editMatcher(msg.chatID(), msg.messageID(), `^Download queue`)).After(call)
+	call = tg.EXPECT().AnswerCallbackQuery(tgbotapi.NewCallback(down.callbackID(), "")).After(call)
+	call = tr.EXPECT().SetTorrents(gomock.AssignableToTypeOf(ctxType), transmission.IDs(transmission.ID(1)),
+		&transmission.SetTorrentReq{PositionInQueue: transmission.OptInt(2)}).Return(nil).After(call)
+	call = tg.EXPECT().Send(editMatcher(msg.chatID(), msg.messageID(), `^Download queue`)).After(call)
+	// The first torrent can't move any higher
+	call = tg.EXPECT().AnswerCallbackQuery(tgbotapi.NewCallback(first.callbackID(), "")).After(call)
+	tg.EXPECT().Send(editMatcher(msg.chatID(), msg.messageID(), `^Download queue`)).After(call)
+
+	run(msg, up, down, first)
+}
+
 func TestList(t *testing.T) {
 	run, tg, tr := newTestBot(t)
 	gen := new(updateGenerator)
@@ -571,13 +2494,35 @@ func TestList(t *testing.T) {
 			UploadRatio:  1.2,
 			ETA:          20 * time.Minute,
 		},
+		{
+			ID:                       2,
+			Name:                     "limited torrent",
+			Status:                   transmission.StatusSeed,
+			ValidSize:                1024,
+			WantedSize:               1024,
+			DownloadRateLimit:        2 << 20,
+			DownloadRateLimitEnabled: true,
+			Priority:                 transmission.PriorityLow,
+		},
+		{
+			ID:          3,
+			Name:        "seeded torrent",
+			Status:      transmission.StatusStopped,
+			IsFinished:  true,
+			ValidSize:   1024,
+			WantedSize:  1024,
+			UploadRatio: 2,
+		},
 	}, nil)
 
 	tg.EXPECT().Send(
 		messageMatcher(update.chatID(), `^(?s)Here is what I got:\s+`+
 			`\\<\*1\*\\> \*test torrent\*`+
 			`.*Downloading \*1\\\.0 KiB\* of \*2\\\.0 KiB\* \\\(\*50\\\.0%\*\\\)`+
-			`.*↓\*10 B/s\* ↑\*20 B/s\* ☯\*1\\\.20\*   ETA: \*20m0s\*`),
+			`.*↓\*10 B/s\* ↑\*20 B/s\* ☯\*1\\\.20\*   ETA: \*20m0s\*\n\n`+
+			`\\<\*2\*\\> \*limited torrent\*`+
+			`.*\n🚧 ↓\*2\\\.0 MiB/s\*   ⏬ \*low\* priority\n\n`+
+			`\\<\*3\*\\> \*seeded torrent\* /info\\_3\nDone seeding \*1\\\.0 KiB\*`),
 	)
 
 	run(update)
@@ -619,6 +2564,444 @@ func TestList_filter(t *testing.T) {
 	run(update)
 }
 
+func TestList_pages(t *testing.T) {
+	cbID := strings.Repeat("0", callbackIDLen)
+	run, tg, tr := newTestBot(t, withCallbackIDGenerator(func() string { return cbID }))
+	gen := new(updateGenerator)
+
+	var torrents []*transmission.Torrent
+	for i := 1; i <= 25; i++ {
+		torrents = append(torrents, &transmission.Torrent{
+			ID:         transmission.ID(i),
+			Name:       fmt.Sprintf("torrent %d", i),
+			Status:     transmission.StatusSeed,
+			ValidSize:  1024,
+			WantedSize: 1024,
+		})
+	}
+
+	msg := gen.newMessage(withCommand("list", "torrent"))
+	next := gen.newCallback(msg.Message, cbID+"1")
+	tr.EXPECT().GetTorrents(gomock.AssignableToTypeOf(ctxType), nil, gomock.Any()).Return(torrents, nil).Times(2)
+
+	firstCall := tg.EXPECT().Send(gomock.All(
+		messageMatcher(msg.chatID(), `^(?s)Here is what I got:.*\\<\*10\*\\>.*Page \*1\* of \*3\*$`),
+		inlineKeyboardMatcher(tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("▶️", cbID+"1"),
+		)),
+	))
+	answerCall := tg.EXPECT().AnswerCallbackQuery(tgbotapi.NewCallback(next.callbackID(), "")).After(firstCall)
+	tg.EXPECT().Send(gomock.All(
+		editMatcher(msg.chatID(), msg.messageID(),
+			`^(?s)Here is what I got:\s+\\<\*11\*\\>.*\\<\*20\*\\>.*Page \*2\* of \*3\*$`),
+		inlineKeyboardMatcher(tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("◀️", cbID+"0"),
+			tgbotapi.NewInlineKeyboardButtonData("▶️", cbID+"2"),
+		)),
+	)).After(answerCall)
+
+	run(msg, next)
+}
+
+func TestPaginate(t *testing.T) {
+	var tests = []struct {
+		name    string
+		entries []string
+		size    int
+		maxLen  int
+		want    [][]string
+	}{
+		{
+			name: "empty",
+		},
+		{
+			name:    "by_size",
+			entries: []string{"a", "b", "c", "d", "e"},
+			size:    2,
+			maxLen:  100,
+			want:    [][]string{{"a", "b"}, {"c", "d"}, {"e"}},
+		},
+		{
+			name:    "by_length",
+			entries: []string{"aaa", "bbb", "ccc", "d"},
+			size:    10,
+			maxLen:  7,
+			want:    [][]string{{"aaa", "bbb"}, {"ccc", "d"}},
+		},
+		{
+			name:    "utf16",
+			entries: []string{"🐢🐢", "🚀🚀", "a"},
+			size:    10,
+			maxLen:  5,
+			want:    [][]string{{"🐢🐢"}, {"🚀🚀", "a"}},
+		},
+		{
+			name:    "too_long",
+			entries: []string{"aaaaa", "b"},
+			size:    10,
+			maxLen:  3,
+			want:    [][]string{{"aaaaa"}, {"b"}},
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			got := paginate(tc.entries, tc.size, tc.maxLen)
+			if !reflect.DeepEqual(tc.want, got) {
+				t.Errorf("unexpected pages, want = %q, got = %q", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestInfo(t *testing.T) {
+	cbID := strings.Repeat("0", callbackIDLen)
+	run, tg, tr := newTestBot(t, withCallbackIDGenerator(func() string { return cbID }))
+	gen := new(updateGenerator)
+
+	msg := gen.newMessage(withCommand("info_1"))
+	tr.EXPECT().GetTorrents(gomock.AssignableToTypeOf(ctxType), transmission.IDs(transmission.ID(1)), gomock.Any()).
+		Return([]*transmission.Torrent{{
+			ID:                1,
+			Hash:              "abc",
+			Name:              "test torrent",
+			Status:            transmission.StatusStopped,
+			ErrorType:         transmission.ErrorTypeLocalError,
+			Error:             "No data found",
+			DownloadDirectory: "/downloads",
+			ValidSize:         1024,
+			WantedSize:        2048,
+			UploadRateLimit:   500 << 10,
+			UploadRateLimited: true,
+			Priority:          transmission.PriorityHigh,
+			ConnectedPeers:    3,
+			Files:             make([]transmission.File, 2),
+			TrackerStats: []transmission.TrackerStat{
+				{
+					Host:                    &url.URL{Host: "tracker.example.com"},
+					Seeders:                 10,
+					Leechers:                5,
+					HasAnnounced:            true,
+					IsLastAnnounceSucceeded: true,
+					LastAnnouncePeerCount:   7,
+					LastAnnounceTime:        time.Now().Add(-time.Minute),
+				},
+			},
+		}}, nil)
+	tg.EXPECT().Send(gomock.All(
+		messageMatcher(msg.chatID(), `^(?s)\\<\*1\*\\> \*test torrent\*`+
+			`.*Stopped \*1\\\.0 KiB\* of \*2\\\.0 KiB\*`+
+			`.*\n🚧 ↑\*500 KiB/s\*   ⏫ \*high\* priority\n`+
+			`.*Hash: `+"`abc`"+
+			`.*Location: \*/downloads\*`+
+			`.*Peers: \*3\* connected, seeders: \*10\*, leechers: \*5\*`+
+			`.*Files: \*2\*`+
+			`.*tracker\\\.example\\\.com: ok, 7 peers`+
+			`.*No data found`),
+		inlineKeyboardMatcher(
+			tgbotapi.NewInlineKeyboardRow(
+				tgbotapi.NewInlineKeyboardButtonData("Resume", cbID+"start"),
+				tgbotapi.NewInlineKeyboardButtonData("Verify", cbID+"verify"),
+				tgbotapi.NewInlineKeyboardButtonData("Reannounce", cbID+"reannounce"),
+			),
+			tgbotapi.NewInlineKeyboardRow(
+				tgbotapi.NewInlineKeyboardButtonData("Remove", cbID+"remove"),
+				tgbotapi.NewInlineKeyboardButtonData("Refresh", cbID+"refresh"),
+			),
+		),
+	))
+
+	run(msg)
+}
+
+func TestInfo_actions(t *testing.T) {
+	cbID := strings.Repeat("0", callbackIDLen)
+	run, tg, tr := newTestBot(t, withCallbackIDGenerator(func() string { return cbID }))
+	gen := new(updateGenerator)
+
+	torrent := []*transmission.Torrent{{ID: 1, Hash: "abc", Name: "test torrent", Status: transmission.StatusSeed}}
+	msg := gen.newMessage(withCommand("info", "1"))
+	verify := gen.newCallback(msg.Message, cbID+"verify")
+	remove := gen.newCallback(msg.Message, cbID+"remove")
+	ids := transmission.IDs(transmission.Hash("abc"))
+
+	getCall := tr.EXPECT().GetTorrents(gomock.AssignableToTypeOf(ctxType), transmission.IDs(transmission.ID(1)),
+		gomock.Any()).Return(torrent, nil)
+	sendCall := tg.EXPECT().Send(messageMatcher(msg.chatID(), `^(?s)\\<\*1\*\\> \*test torrent\*`)).After(getCall)
+
+	answerCall := tg.EXPECT().AnswerCallbackQuery(tgbotapi.NewCallback(verify.callbackID(), "")).After(sendCall)
+	verifyCall := tr.EXPECT().VerifyTorrents(gomock.AssignableToTypeOf(ctxType), ids).After(answerCall)
+	getCall = tr.EXPECT().GetTorrents(gomock.AssignableToTypeOf(ctxType), ids, gomock.Any()).
+		Return(torrent, nil).After(verifyCall)
+	sendCall = tg.EXPECT().Send(gomock.All(
+		editMatcher(msg.chatID(), msg.messageID(), `^(?s)\\<\*1\*\\> \*test torrent\*.*Seeding`),
+		inlineKeyboardMatcher(
+			tgbotapi.NewInlineKeyboardRow(
+				tgbotapi.NewInlineKeyboardButtonData("Pause", cbID+"stop"),
+				tgbotapi.NewInlineKeyboardButtonData("Verify", cbID+"verify"),
+				tgbotapi.NewInlineKeyboardButtonData("Reannounce", cbID+"reannounce"),
+			),
+			tgbotapi.NewInlineKeyboardRow(
+				tgbotapi.NewInlineKeyboardButtonData("Remove", cbID+"remove"),
+				tgbotapi.NewInlineKeyboardButtonData("Refresh", cbID+"refresh"),
+			),
+		),
+	)).After(getCall)
+
+	answerCall = tg.EXPECT().AnswerCallbackQuery(tgbotapi.NewCallback(remove.callbackID(), "")).After(sendCall)
+	getCall = tr.EXPECT().GetTorrents(gomock.AssignableToTypeOf(ctxType), ids, gomock.Any()).
+		Return(torrent, nil).After(answerCall)
+	tg.EXPECT().Send(gomock.All(
+		editMatcher(msg.chatID(), msg.messageID(), `^(?s)I'm going to remove the following torrents`),
+		inlineKeyboardMatcher(tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("Yes", cbID+"yes"),
+			tgbotapi.NewInlineKeyboardButtonData("No", cbID+"no"),
+			tgbotapi.NewInlineKeyboardButtonData("Cancel", cbID+"cancel"),
+		)),
+	)).After(getCall)
+
+	run(msg, verify, remove)
+}
+
+func TestInfo_viewer(t *testing.T) {
+	cbID := strings.Repeat("0", callbackIDLen)
+	run, tg, tr := newTestBot(t,
+		WithUsers(User{Name: "viewer", Role: RoleViewer}),
+		withCallbackIDGenerator(func() string { return cbID }),
+	)
+	gen := new(updateGenerator)
+
+	torrent := []*transmission.Torrent{{ID: 1, Hash: "abc", Name: "test torrent", Status: transmission.StatusSeed}}
+	msg := gen.newMessage(withUser("viewer"), withCommand("info", "1"))
+	refresh := gen.newCallback(msg.Message, cbID+"refresh", withUser("viewer"))
+	stop := gen.newCallback(msg.Message, cbID+"stop", withUser("viewer"))
+	adminStop := gen.newCallback(msg.Message, cbID+"stop")
+	ids := transmission.IDs(transmission.Hash("abc"))
+
+	getCall := tr.EXPECT().GetTorrents(gomock.AssignableToTypeOf(ctxType), transmission.IDs(transmission.ID(1)),
+		gomock.Any()).Return(torrent, nil)
+	sendCall := tg.EXPECT().Send(messageMatcher(msg.chatID(), `^(?s)\\<\*1\*\\> \*test torrent\*`)).After(getCall)
+
+	answerCall := tg.EXPECT().AnswerCallbackQuery(tgbotapi.NewCallback(refresh.callbackID(), "")).After(sendCall)
+	getCall = tr.EXPECT().GetTorrents(gomock.AssignableToTypeOf(ctxType), ids, gomock.Any()).
+		Return(torrent, nil).After(answerCall)
+	sendCall = tg.EXPECT().Send(editMatcher(msg.chatID(), msg.messageID(), `^(?s)\\<\*1\*\\> \*test torrent\*`)).
+		After(getCall)
+
+	// Viewers can't stop torrents, but the card keeps working for admins
+	answerCall = tg.EXPECT().AnswerCallbackQuery(tgbotapi.NewCallback(stop.callbackID(), forbiddenText)).
+		After(sendCall)
+	answerCall = tg.EXPECT().AnswerCallbackQuery(tgbotapi.NewCallback(adminStop.callbackID(), "")).After(answerCall)
+	stopCall := tr.EXPECT().StopTorrents(gomock.AssignableToTypeOf(ctxType), ids).After(answerCall)
+	getCall = tr.EXPECT().GetTorrents(gomock.AssignableToTypeOf(ctxType), ids, gomock.Any()).
+		Return(torrent, nil).After(stopCall)
+	tg.EXPECT().Send(editMatcher(msg.chatID(), msg.messageID(), `^(?s)\\<\*1\*\\> \*test torrent\*`)).
+		After(getCall)
+
+	run(msg, refresh, stop, adminStop)
+}
+
+func TestFiles(t *testing.T) {
+	cbID := strings.Repeat("0", callbackIDLen)
+	run, tg, tr := newTestBot(t, withCallbackIDGenerator(func() string { return cbID }))
+	gen := new(updateGenerator)
+
+	torrent := &transmission.Torrent{ID: 1, Hash: "abc", Name: "test torrent"}
+	for i := 0; i < 10; i++ {
+		torrent.Files = append(torrent.Files, transmission.File{
+			Name:       fmt.Sprintf("file%d.mkv", i),
+			Size:       2048,
+			Downloaded: 1024,
+		})
+		torrent.FileStats = append(torrent.FileStats, transmission.FileStat{
+			Downloaded: 1024,
+			Wanted:     true,
+		})
+	}
+	torrent.FileStats[9].Priority = transmission.PriorityHigh
+
+	msg := gen.newMessage(withCommand("files", "1"))
+	next := gen.newCallback(msg.Message, cbID+"page1")
+	unwant := gen.newCallback(msg.Message, cbID+"want9")
+	ids := transmission.IDs(transmission.Hash("abc"))
+
+	getCall := tr.EXPECT().GetTorrents(gomock.AssignableToTypeOf(ctxType), transmission.IDs(transmission.ID(1)),
+		gomock.Any()).Return([]*transmission.Torrent{torrent}, nil)
+	sendCall := tg.EXPECT().Send(gomock.All(
+		messageMatcher(msg.chatID(), `^(?s)\\<\*1\*\\> \*test torrent\*`+
+			`.*1\\\. ✅ \*file0\\\.mkv\*\s+\*1\\\.0 KiB\* of \*2\\\.0 KiB\* \\\(\*50\\\.0%\*\\\)`+
+			`.*8\\\. ✅ \*file7\\\.mkv\*.*Page \*1\* of \*2\*$`),
+		inlineKeyboardMatcher(
+			tgbotapi.NewInlineKeyboardRow(
+				tgbotapi.NewInlineKeyboardButtonData("1 ✅", cbID+"want0"),
+				tgbotapi.NewInlineKeyboardButtonData("1 normal", cbID+"prio0"),
+			),
+			tgbotapi.NewInlineKeyboardRow(
+				tgbotapi.NewInlineKeyboardButtonData("2 ✅", cbID+"want1"),
+				tgbotapi.NewInlineKeyboardButtonData("2 normal", cbID+"prio1"),
+			),
+			tgbotapi.NewInlineKeyboardRow(
+				tgbotapi.NewInlineKeyboardButtonData("3 ✅", cbID+"want2"),
+				tgbotapi.NewInlineKeyboardButtonData("3 normal", cbID+"prio2"),
+			),
+			tgbotapi.NewInlineKeyboardRow(
+				tgbotapi.NewInlineKeyboardButtonData("4 ✅", cbID+"want3"),
+				tgbotapi.NewInlineKeyboardButtonData("4 normal", cbID+"prio3"),
+			),
+			tgbotapi.NewInlineKeyboardRow(
+				tgbotapi.NewInlineKeyboardButtonData("5 ✅", cbID+"want4"),
+				tgbotapi.NewInlineKeyboardButtonData("5 normal", cbID+"prio4"),
+			),
+			tgbotapi.NewInlineKeyboardRow(
+				tgbotapi.NewInlineKeyboardButtonData("6 ✅", cbID+"want5"),
+				tgbotapi.NewInlineKeyboardButtonData("6 normal", cbID+"prio5"),
+			),
+			tgbotapi.NewInlineKeyboardRow(
+				tgbotapi.NewInlineKeyboardButtonData("7 ✅", cbID+"want6"),
+				tgbotapi.NewInlineKeyboardButtonData("7 normal", cbID+"prio6"),
+			),
+			tgbotapi.NewInlineKeyboardRow(
+				tgbotapi.NewInlineKeyboardButtonData("8 ✅", cbID+"want7"),
+				tgbotapi.NewInlineKeyboardButtonData("8 normal", cbID+"prio7"),
+			),
+			tgbotapi.NewInlineKeyboardRow(
+				tgbotapi.NewInlineKeyboardButtonData("▶️", cbID+"page1"),
+			),
+		),
+	)).After(getCall)
+
+	answerCall := tg.EXPECT().AnswerCallbackQuery(tgbotapi.NewCallback(next.callbackID(), "")).After(sendCall)
+	getCall = tr.EXPECT().GetTorrents(gomock.AssignableToTypeOf(ctxType), ids, gomock.Any()).
+		Return([]*transmission.Torrent{torrent}, nil).After(answerCall)
+	sendCall = tg.EXPECT().Send(gomock.All(
+		editMatcher(msg.chatID(), msg.messageID(),
+			`^(?s)\\<\*1\*\\> \*test torrent\*\s+9\\\. ✅ \*file8\\\.mkv\*`+
+				`.*10\\\. ✅ \*file9\\\.mkv\*.*high priority.*Page \*2\* of \*2\*$`),
+		inlineKeyboardMatcher(
+			tgbotapi.NewInlineKeyboardRow(
+				tgbotapi.NewInlineKeyboardButtonData("9 ✅", cbID+"want8"),
+				tgbotapi.NewInlineKeyboardButtonData("9 normal", cbID+"prio8"),
+			),
+			tgbotapi.NewInlineKeyboardRow(
+				tgbotapi.NewInlineKeyboardButtonData("10 ✅", cbID+"want9"),
+				tgbotapi.NewInlineKeyboardButtonData("10 high", cbID+"prio9"),
+			),
+			tgbotapi.NewInlineKeyboardRow(
+				tgbotapi.NewInlineKeyboardButtonData("◀️", cbID+"page0"),
+			),
+		),
+	)).After(getCall)
+
+	answerCall = tg.EXPECT().AnswerCallbackQuery(tgbotapi.NewCallback(unwant.callbackID(), "")).After(sendCall)
+	getCall = tr.EXPECT().GetTorrents(gomock.AssignableToTypeOf(ctxType), ids, transmission.TorrentFieldFileStats).
+		Return([]*transmission.Torrent{torrent}, nil).After(answerCall)
+	setCall := tr.EXPECT().SetTorrents(gomock.AssignableToTypeOf(ctxType), ids, &transmission.SetTorrentReq{
+		UnwantedFiles: []int{9},
+	}).DoAndReturn(func(context.Context, transmission.Identifier, *transmission.SetTorrentReq) error {
+		torrent.FileStats[9].Wanted = false
+		return nil
+	}).After(getCall)
+	getCall = tr.EXPECT().GetTorrents(gomock.AssignableToTypeOf(ctxType), ids, gomock.Any()).
+		Return([]*transmission.Torrent{torrent}, nil).After(setCall)
+	tg.EXPECT().Send(gomock.All(
+		editMatcher(msg.chatID(), msg.messageID(), `^(?s).*10\\\. ⬜ \*file9\\\.mkv\*.*Page \*2\* of \*2\*$`),
+		inlineKeyboardMatcher(
+			tgbotapi.NewInlineKeyboardRow(
+				tgbotapi.NewInlineKeyboardButtonData("9 ✅", cbID+"want8"),
+				tgbotapi.NewInlineKeyboardButtonData("9 normal", cbID+"prio8"),
+			),
+			tgbotapi.NewInlineKeyboardRow(
+				tgbotapi.NewInlineKeyboardButtonData("10 ⬜", cbID+"want9"),
+				tgbotapi.NewInlineKeyboardButtonData("10 high", cbID+"prio9"),
+			),
+			tgbotapi.NewInlineKeyboardRow(
+				tgbotapi.NewInlineKeyboardButtonData("◀️", cbID+"page0"),
+			),
+		),
+	)).After(getCall)
+
+	run(msg, next, unwant)
+}
+
+func TestFiles_viewer(t *testing.T) {
+	cbID := strings.Repeat("0", callbackIDLen)
+	run, tg, tr := newTestBot(t,
+		WithUsers(User{Name: "viewer", Role: RoleViewer}),
+		withCallbackIDGenerator(func() string { return cbID }),
+	)
+	gen := new(updateGenerator)
+
+	torrent := &transmission.Torrent{ID: 1, Hash: "abc", Name: "test torrent"}
+	for i := 0; i < 10; i++ {
+		torrent.Files = append(torrent.Files, transmission.File{Name: fmt.Sprintf("file%d.mkv", i)})
+	}
+
+	msg := gen.newMessage(withUser("viewer"), withCommand("files", "1"))
+	next := gen.newCallback(msg.Message, cbID+"page1", withUser("viewer"))
+	unwant := gen.newCallback(msg.Message, cbID+"want9", withUser("viewer"))
+	ids := transmission.IDs(transmission.Hash("abc"))
+
+	getCall := tr.EXPECT().GetTorrents(gomock.AssignableToTypeOf(ctxType), transmission.IDs(transmission.ID(1)),
+		gomock.Any()).Return([]*transmission.Torrent{torrent}, nil)
+	sendCall := tg.EXPECT().Send(messageMatcher(msg.chatID(), `^(?s).*Page \*1\* of \*2\*$`)).After(getCall)
+
+	answerCall := tg.EXPECT().AnswerCallbackQuery(tgbotapi.NewCallback(next.callbackID(), "")).After(sendCall)
+	getCall = tr.EXPECT().GetTorrents(gomock.AssignableToTypeOf(ctxType), ids, gomock.Any()).
+		Return([]*transmission.Torrent{torrent}, nil).After(answerCall)
+	sendCall = tg.EXPECT().Send(editMatcher(msg.chatID(), msg.messageID(), `^(?s).*Page \*2\* of \*2\*$`)).
+		After(getCall)
+
+	// Viewers can't toggle the files
+	tg.EXPECT().AnswerCallbackQuery(tgbotapi.NewCallback(unwant.callbackID(), forbiddenText)).After(sendCall)
+
+	run(msg, next, unwant)
+}
+
+func TestMoveTorrents(t *testing.T) {
+	cbID := strings.Repeat("0", callbackIDLen)
+	run, tg, tr := newTestBot(t,
+		WithLocations(
+			Location{Name: "loc1", Path: "/path/to/loc1"},
+			Location{Name: "loc2", Path: "/path/to/loc2"},
+		),
+		withCallbackIDGenerator(func() string { return cbID }),
+	)
+	gen := new(updateGenerator)
+
+	msg := gen.newMessage(withCommand("move", "1 2"))
+	cb := gen.newCallback(msg.Message, cbID+"loc2")
+	torrents := []*transmission.Torrent{
+		{ID: 1, Hash: "abc", Name: "first"},
+		{ID: 2, Hash: "def", Name: "second"},
+	}
+	hashes := transmission.IDs(transmission.Hash("abc"), transmission.Hash("def"))
+
+	getCall := tr.EXPECT().GetTorrents(gomock.AssignableToTypeOf(ctxType),
+		transmission.IDs(transmission.ID(1), transmission.ID(2)), gomock.Any()).Return(torrents, nil)
+	askCall := tg.EXPECT().Send(gomock.All(
+		messageMatcher(msg.chatID(), `^(?s)Where should I move.*\\<\*1\*\\> \*first\*.*\\<\*2\*\\> \*second\*`),
+		inlineKeyboardMatcher(
+			tgbotapi.NewInlineKeyboardRow(
+				tgbotapi.NewInlineKeyboardButtonData("loc1", cbID+"loc1"),
+				tgbotapi.NewInlineKeyboardButtonData("loc2", cbID+"loc2"),
+			),
+			tgbotapi.NewInlineKeyboardRow(
+				tgbotapi.NewInlineKeyboardButtonData("Cancel", cbID+"cancel"),
+			),
+		),
+	)).After(getCall)
+	answerCall := tg.EXPECT().AnswerCallbackQuery(tgbotapi.NewCallback(cb.callbackID(), "")).After(askCall)
+	moveCall := tr.EXPECT().SetTorrentsLocation(gomock.AssignableToTypeOf(ctxType), hashes, "/path/to/loc2", true).
+		After(answerCall)
+	getCall = tr.EXPECT().GetTorrents(gomock.AssignableToTypeOf(ctxType), hashes, gomock.Any()).
+		Return(torrents, nil).After(moveCall)
+	tg.EXPECT().Send(editMatcher(msg.chatID(), msg.messageID(),
+		`^(?s)Moving the following torrents to \*/path/to/loc2\*.*\\<\*1\*\\> \*first\*`)).After(getCall)
+
+	run(msg, cb)
+}
+
 func TestRemoveTorrent(t *testing.T) {
 	cbID := strings.Repeat("0", callbackIDLen)
 	run, tg, tr := newTestBot(t, withCallbackIDGenerator(func() string {
@@ -657,3 +3040,60 @@ func TestRemoveTorrent(t *testing.T) {
 
 	run(updates...)
 }
+
+func TestNotify(t *testing.T) {
+	ctrl := gomock.NewController(t)
+
+	tg := NewMockTelegram(ctrl)
+	tr := NewMockTransmission(ctrl)
+	bot := New(tg, tr)
+
+	gen := new(updateGenerator)
+	first := gen.newMessage(withMsgText("magnet:/1"))
+	second := gen.newMessage(withMsgText("magnet:/2"), func(u *tgbotapi.Update) {
+		u.Message.Chat.ID = 456
+	})
+	bot.trackTorrent(newOwner(first.Message), &transmission.NewTorrent{ID: 1, Hash: "abc", Name: "first"})
+	bot.trackTorrent(newOwner(second.Message), &transmission.NewTorrent{ID: 2, Hash: "def", Name: "second"})
+
+	ctx := context.Background()
+	firstCall := tr.EXPECT().GetTorrents(gomock.AssignableToTypeOf(ctxType), gomock.Any(), gomock.Any()).
+		Return([]*transmission.Torrent{
+			{ID: 1, Hash: "abc", Name: "first", Status: transmission.StatusDownload, DataDone: 0.5},
+			{ID: 2, Hash: "def", Name: "second", Status: transmission.StatusSeed, DataDone: 1,
+				DownloadDirectory: "/downloads"},
+		}, nil)
+	sendCall := tg.EXPECT().Send(messageMatcher(456, `(?s)\\<\*2\*\\> second is downloaded.*/downloads`,
+		hasReplyMsgID(second.messageID()))).After(firstCall)
+	bot.checkTorrents(ctx)
+
+	// The first torrent was removed, so no notification is expected for it
+	tr.EXPECT().GetTorrents(gomock.AssignableToTypeOf(ctxType),
+		transmission.IDs(transmission.Hash("abc")), gomock.Any()).Return(nil, nil).After(sendCall)
+	bot.checkTorrents(ctx)
+
+	// Nothing to track anymore
+	bot.checkTorrents(ctx)
+}
+
+func TestServe(t *testing.T) {
+	ctrl := gomock.NewController(t)
+
+	tg := NewMockTelegram(ctrl)
+	tr := NewMockTransmission(ctrl)
+	bot := New(tg, tr, WithAllowedUsers("admin"))
+
+	gen := new(updateGenerator)
+	update := gen.newMessage(withCommand("start"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	updates := make(chan tgbotapi.Update)
+	tg.EXPECT().Send(messageMatcher(update.chatID(), "Drop me")).Do(func(_ tgbotapi.Chattable) {
+		cancel()
+	})
+
+	go func() {
+		updates <- update.Update
+	}()
+	bot.Serve(ctx, updates)
+}
@@ -1,8 +1,15 @@
 package bot
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
+	"regexp"
+	"strings"
+	"time"
 
+	"github.com/dustin/go-humanize"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
 	"github.com/google/uuid"
 )
 
@@ -12,24 +19,180 @@ type Location struct {
 	Path string
 }
 
+// Rule picks a location for new torrents automatically, so that the user
+// isn't asked where to download them. All the set conditions must hold for
+// the rule to match.
+type Rule struct {
+	Name string
+	// Name of the location to download matching torrents to
+	Location string
+
+	// Regular expression the torrent name must match
+	Pattern string
+	// Host of one of the torrent trackers, subdomains match as well
+	Tracker string
+	// Extensions of the largest file of the torrent, e.g. mkv
+	Extensions []string
+	// Torrent size limits, zero means there is no limit
+	MinSize int64
+	MaxSize int64
+}
+
+// ParseRule parses a rule in the NAME:LOCATION:COND[;COND...] format, where
+// COND is one of name~REGEXP, tracker=HOST, ext=EXT[|EXT...], size>SIZE or
+// size<SIZE.
+func ParseRule(s string) (Rule, error) {
+	parts := strings.SplitN(s, ":", 3)
+	if len(parts) != 3 || parts[0] == "" || parts[1] == "" {
+		return Rule{}, fmt.Errorf("invalid rule %q", s)
+	}
+	r := Rule{Name: parts[0], Location: parts[1]}
+
+	for _, cond := range strings.Split(parts[2], ";") {
+		var err error
+		switch {
+		case strings.HasPrefix(cond, "name~"):
+			r.Pattern = cond[len("name~"):]
+			_, err = regexp.Compile(r.Pattern)
+		case strings.HasPrefix(cond, "tracker="):
+			r.Tracker = strings.ToLower(cond[len("tracker="):])
+		case strings.HasPrefix(cond, "ext="):
+			for _, ext := range strings.Split(cond[len("ext="):], "|") {
+				r.Extensions = append(r.Extensions, strings.ToLower(strings.TrimPrefix(ext, ".")))
+			}
+		case strings.HasPrefix(cond, "size>"), strings.HasPrefix(cond, "size<"):
+			var size uint64
+			if size, err = humanize.ParseBytes(cond[len("size>"):]); err == nil && cond[4] == '>' {
+				r.MinSize = int64(size)
+			} else if err == nil {
+				r.MaxSize = int64(size)
+			}
+		default:
+			err = errors.New("unknown condition")
+		}
+		if err != nil {
+			return Rule{}, fmt.Errorf("invalid rule %q condition %q: %v", r.Name, cond, err)
+		}
+	}
+
+	return r, nil
+}
+
+func (r Rule) String() string {
+	var conds []string
+	if r.Pattern != "" {
+		conds = append(conds, "name~"+r.Pattern)
+	}
+	if r.Tracker != "" {
+		conds = append(conds, "tracker="+r.Tracker)
+	}
+	if len(r.Extensions) > 0 {
+		conds = append(conds, "ext="+strings.Join(r.Extensions, "|"))
+	}
+	if r.MinSize > 0 {
+		conds = append(conds, "size>"+humanize.IBytes(uint64(r.MinSize)))
+	}
+	if r.MaxSize > 0 {
+		conds = append(conds, "size<"+humanize.IBytes(uint64(r.MaxSize)))
+	}
+
+	return fmt.Sprintf("%s:%s:%s", r.Name, r.Location, strings.Join(conds, ";"))
+}
+
+// Role defines what a user is allowed to do with the bot.
+type Role int
+
+const (
+	// RoleViewer can look at torrents and statistics.
+	RoleViewer Role = iota + 1
+	// RoleAdder can also add new torrents.
+	RoleAdder
+	// RoleAdmin can do anything, including removing torrents and changing
+	// Transmission settings.
+	RoleAdmin
+)
+
+var (
+	roleNames = map[Role]string{
+		RoleViewer: "viewer",
+		RoleAdder:  "adder",
+		RoleAdmin:  "admin",
+	}
+)
+
+func (r Role) String() string {
+	if n, ok := roleNames[r]; ok {
+		return n
+	}
+	return fmt.Sprintf("Role(%d)", r)
+}
+
+// ParseRole returns a role with the given name.
+func ParseRole(name string) (Role, error) {
+	for r, n := range roleNames {
+		if n == name {
+			return r, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown role %q", name)
+}
+
+// User is a telegram account that is allowed to control the bot. The account
+// is identified either by its username or numeric ID.
+type User struct {
+	Name string
+	ID   int
+	Role Role
+}
+
 type config struct {
-	Log          Logger
-	AllowedUsers []string
-	HTTPClient   *http.Client
-	SetCommands  bool
-	Locations    []Location
+	Log            Logger
+	AllowedUsers   []string
+	AllowedUserIDs []int
+	Users          []User
+	AllowedChats   []int64
+	Username       string
+	Token          string
+	HTTPClient     *http.Client
+	SetCommands    bool
+	Locations      []Location
+	Rules          []Rule
+	Store          Store
+
+	MaxTorrentSize  int64
+	DownloadTimeout time.Duration
+
+	NotifyInterval time.Duration
+	Concurrency    int
+	UpdateTimeout  time.Duration
 
 	// only for tests
+	APIEndpoint   string
 	NewCallbackID func() string
+	BackoffMin    time.Duration
+	BackoffMax    time.Duration
+	Now           func() time.Time
 }
 
 func defaultConfig() *config {
 	return &config{
 		Log:        noopLogger{},
 		HTTPClient: http.DefaultClient,
+
+		NotifyInterval: time.Minute,
+		Concurrency:    4,
+		UpdateTimeout:  time.Minute,
+
+		MaxTorrentSize:  10 << 20,
+		DownloadTimeout: 30 * time.Second,
+
+		APIEndpoint: tgbotapi.APIEndpoint,
 		NewCallbackID: func() string {
 			return uuid.New().String()
 		},
+		BackoffMin: 100 * time.Millisecond,
+		BackoffMax: time.Minute,
+		Now:        time.Now,
 	}
 }
 
@@ -60,6 +223,46 @@ func WithAllowedUsers(users ...string) Option {
 	})
 }
 
+// WithAllowedUserIDs sets a numeric ID of the telegram account that is allowed
+// to control the bot. Unlike usernames, IDs never change, so this is the
+// preferred way to authorize users.
+func WithAllowedUserIDs(ids ...int) Option {
+	return optionFunc(func(c *config) {
+		c.AllowedUserIDs = append(c.AllowedUserIDs, ids...)
+	})
+}
+
+// WithUsers allows the given users to control the bot according to their
+// roles. Users added with WithAllowedUsers and WithAllowedUserIDs are admins.
+func WithUsers(users ...User) Option {
+	return optionFunc(func(c *config) {
+		c.Users = append(c.Users, users...)
+	})
+}
+
+// WithAllowedChats sets IDs of the group chats the bot is allowed to work in.
+// Only users that are allowed to control the bot can use it in the group.
+func WithAllowedChats(ids ...int64) Option {
+	return optionFunc(func(c *config) {
+		c.AllowedChats = append(c.AllowedChats, ids...)
+	})
+}
+
+// WithUsername sets the bot's own username. It's used to tell whether a
+// message posted to a group chat is addressed to the bot.
+func WithUsername(name string) Option {
+	return optionFunc(func(c *config) {
+		c.Username = name
+	})
+}
+
+// WithToken sets the bot token. It's required to receive updates with Run.
+func WithToken(token string) Option {
+	return optionFunc(func(c *config) {
+		c.Token = token
+	})
+}
+
 // WithHTTPClient sets an HTTP client for the bot.
 func WithHTTPClient(client *http.Client) Option {
 	return optionFunc(func(c *config) {
@@ -85,6 +288,74 @@ func WithLocations(l ...Location) Option {
 	})
 }
 
+// WithRules adds rules that pick locations for new torrents. The first
+// matching rule wins. Rules referring to unknown locations are ignored.
+func WithRules(r ...Rule) Option {
+	return optionFunc(func(c *config) {
+		c.Rules = append(c.Rules, r...)
+	})
+}
+
+// WithNotifyInterval sets how often the bot checks whether torrents it has
+// added are done downloading.
+func WithNotifyInterval(interval time.Duration) Option {
+	return optionFunc(func(c *config) {
+		if interval > 0 {
+			c.NotifyInterval = interval
+		}
+	})
+}
+
+// WithConcurrency sets the maximum number of updates processed concurrently.
+// Updates from the same chat are always processed sequentially.
+func WithConcurrency(n int) Option {
+	return optionFunc(func(c *config) {
+		if n > 0 {
+			c.Concurrency = n
+		}
+	})
+}
+
+// WithUpdateTimeout sets the maximum time the bot is allowed to spend
+// processing a single update.
+func WithUpdateTimeout(timeout time.Duration) Option {
+	return optionFunc(func(c *config) {
+		if timeout > 0 {
+			c.UpdateTimeout = timeout
+		}
+	})
+}
+
+// WithStore configures the bot to keep its state in s. By default, the state
+// is kept in memory and is lost on restart.
+func WithStore(s Store) Option {
+	return optionFunc(func(c *config) {
+		if s != nil {
+			c.Store = s
+		}
+	})
+}
+
+// WithMaxTorrentSize sets the maximum size of a .torrent file the bot agrees
+// to download from Telegram.
+func WithMaxTorrentSize(size int64) Option {
+	return optionFunc(func(c *config) {
+		if size > 0 {
+			c.MaxTorrentSize = size
+		}
+	})
+}
+
+// WithDownloadTimeout sets the maximum time the bot is allowed to spend
+// downloading a .torrent file from Telegram.
+func WithDownloadTimeout(timeout time.Duration) Option {
+	return optionFunc(func(c *config) {
+		if timeout > 0 {
+			c.DownloadTimeout = timeout
+		}
+	})
+}
+
 // withCallbackIDGenerator overwrites default callback ID generator. Private as
 // it's intended for tests only.
 func withCallbackIDGenerator(gen func() string) Option {
@@ -94,3 +365,34 @@ func withCallbackIDGenerator(gen func() string) Option {
 		}
 	})
 }
+
+// withAPIEndpoint overwrites Telegram API endpoint used to receive updates.
+// Private as it's intended for tests only.
+func withAPIEndpoint(endpoint string) Option {
+	return optionFunc(func(c *config) {
+		if endpoint != "" {
+			c.APIEndpoint = endpoint
+		}
+	})
+}
+
+// withBackoff overwrites default backoff configuration used when Telegram API
+// is unavailable. Private as it's intended for tests only.
+func withBackoff(min, max time.Duration) Option {
+	return optionFunc(func(c *config) {
+		if min > 0 && max >= min {
+			c.BackoffMin = min
+			c.BackoffMax = max
+		}
+	})
+}
+
+// withClock overwrites the function used to get the current time. Private as
+// it's intended for tests only.
+func withClock(now func() time.Time) Option {
+	return optionFunc(func(c *config) {
+		if now != nil {
+			c.Now = now
+		}
+	})
+}
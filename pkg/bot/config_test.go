@@ -3,6 +3,7 @@ package bot
 import (
 	"net/http"
 	"testing"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
 )
@@ -26,6 +27,37 @@ func TestConfig(t *testing.T) {
 			opts: []Option{WithAllowedUsers("user1", "user2")},
 			want: &config{AllowedUsers: []string{"user1", "user2"}},
 		},
+		{
+			name: "allowed_user_ids",
+			opts: []Option{WithAllowedUserIDs(1, 2), WithAllowedUserIDs(3)},
+			want: &config{AllowedUserIDs: []int{1, 2, 3}},
+		},
+		{
+			name: "users",
+			opts: []Option{WithUsers(
+				User{Name: "user1", Role: RoleViewer},
+				User{ID: 2, Role: RoleAdder},
+			)},
+			want: &config{Users: []User{
+				{Name: "user1", Role: RoleViewer},
+				{ID: 2, Role: RoleAdder},
+			}},
+		},
+		{
+			name: "allowed_chats",
+			opts: []Option{WithAllowedChats(-100, -200)},
+			want: &config{AllowedChats: []int64{-100, -200}},
+		},
+		{
+			name: "username",
+			opts: []Option{WithUsername("testbot")},
+			want: &config{Username: "testbot"},
+		},
+		{
+			name: "token",
+			opts: []Option{WithToken("123:abc")},
+			want: &config{Token: "123:abc"},
+		},
 		{
 			name: "http_client",
 			opts: []Option{WithHTTPClient(testHTTPClient)},
@@ -53,6 +85,34 @@ func TestConfig(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "rules",
+			opts: []Option{
+				WithRules(Rule{Name: "movies", Location: "loc1", Extensions: []string{"mkv"}}),
+				WithRules(Rule{Name: "shows", Location: "loc2", Pattern: "S\\d\\dE\\d\\d"}),
+			},
+			want: &config{
+				Rules: []Rule{
+					{Name: "movies", Location: "loc1", Extensions: []string{"mkv"}},
+					{Name: "shows", Location: "loc2", Pattern: "S\\d\\dE\\d\\d"},
+				},
+			},
+		},
+		{
+			name: "notify_interval",
+			opts: []Option{WithNotifyInterval(5 * time.Minute)},
+			want: &config{NotifyInterval: 5 * time.Minute},
+		},
+		{
+			name: "concurrency",
+			opts: []Option{WithConcurrency(8)},
+			want: &config{Concurrency: 8},
+		},
+		{
+			name: "update_timeout",
+			opts: []Option{WithUpdateTimeout(30 * time.Second)},
+			want: &config{UpdateTimeout: 30 * time.Second},
+		},
 	}
 
 	for _, tc := range tests {
@@ -68,3 +128,81 @@ func TestConfig(t *testing.T) {
 		})
 	}
 }
+
+func TestParseRole(t *testing.T) {
+	for _, r := range []Role{RoleViewer, RoleAdder, RoleAdmin} {
+		got, err := ParseRole(r.String())
+		if err != nil {
+			t.Fatalf("unexpected error parsing %q: %v", r, err)
+		}
+		if got != r {
+			t.Errorf("unexpected role, want = %v, got = %v", r, got)
+		}
+	}
+
+	if _, err := ParseRole("superuser"); err == nil {
+		t.Errorf("expected an error parsing unknown role")
+	}
+}
+
+func TestParseRule(t *testing.T) {
+	var tests = []struct {
+		name string
+		rule string
+		want Rule
+	}{
+		{
+			name: "name",
+			rule: "shows:tv:name~(?i)s\\d\\de\\d\\d",
+			want: Rule{Name: "shows", Location: "tv", Pattern: "(?i)s\\d\\de\\d\\d"},
+		},
+		{
+			name: "all",
+			rule: "hd:movies:name~a:b;tracker=Tracker.org;ext=.MKV|avi;size>4GiB;size<100GiB",
+			want: Rule{
+				Name:       "hd",
+				Location:   "movies",
+				Pattern:    "a:b",
+				Tracker:    "tracker.org",
+				Extensions: []string{"mkv", "avi"},
+				MinSize:    4 << 30,
+				MaxSize:    100 << 30,
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := ParseRule(tc.rule)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !cmp.Equal(tc.want, got) {
+				t.Errorf("got unexpected result, diff = \n%s", cmp.Diff(tc.want, got))
+			}
+
+			again, err := ParseRule(got.String())
+			if err != nil {
+				t.Fatalf("unexpected error parsing %q: %v", got.String(), err)
+			}
+			if !cmp.Equal(got, again) {
+				t.Errorf("rule changed after formatting, diff = \n%s", cmp.Diff(got, again))
+			}
+		})
+	}
+
+	for _, rule := range []string{
+		"shows",
+		"shows:tv",
+		":tv:name~x",
+		"shows:tv:",
+		"shows:tv:name~(",
+		"shows:tv:size>4X",
+		"shows:tv:seeders>10",
+	} {
+		if _, err := ParseRule(rule); err == nil {
+			t.Errorf("expected an error parsing %q", rule)
+		}
+	}
+}
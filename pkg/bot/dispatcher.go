@@ -0,0 +1,91 @@
+package bot
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+// dispatcher processes updates concurrently, while making sure that updates
+// coming from the same chat are processed one by one in the order they were
+// received.
+type dispatcher struct {
+	handle  func(context.Context, tgbotapi.Update)
+	timeout time.Duration
+	sem     chan struct{}
+
+	wg     sync.WaitGroup
+	mu     sync.Mutex
+	queues map[int64][]tgbotapi.Update
+}
+
+func newDispatcher(concurrency int, timeout time.Duration,
+	handle func(context.Context, tgbotapi.Update)) *dispatcher {
+	return &dispatcher{
+		handle:  handle,
+		timeout: timeout,
+		sem:     make(chan struct{}, concurrency),
+		queues:  make(map[int64][]tgbotapi.Update),
+	}
+}
+
+// dispatch schedules u for processing. Processing of the update is cancelled
+// as soon as ctx is cancelled or the update timeout expires.
+func (d *dispatcher) dispatch(ctx context.Context, u tgbotapi.Update) {
+	chat := getChatID(u)
+
+	d.mu.Lock()
+	q, busy := d.queues[chat]
+	d.queues[chat] = append(q, u)
+	d.mu.Unlock()
+	if busy {
+		return
+	}
+
+	d.wg.Add(1)
+	go d.work(ctx, chat)
+}
+
+func (d *dispatcher) work(ctx context.Context, chat int64) {
+	defer d.wg.Done()
+
+	for {
+		d.mu.Lock()
+		q := d.queues[chat]
+		if len(q) == 0 {
+			delete(d.queues, chat)
+			d.mu.Unlock()
+			return
+		}
+		u := q[0]
+		d.queues[chat] = q[1:]
+		d.mu.Unlock()
+
+		d.sem <- struct{}{}
+		uctx, cancel := context.WithTimeout(ctx, d.timeout)
+		d.handle(uctx, u)
+		cancel()
+		<-d.sem
+	}
+}
+
+// wait waits for all the dispatched updates to be processed.
+func (d *dispatcher) wait() {
+	d.wg.Wait()
+}
+
+func getChatID(u tgbotapi.Update) int64 {
+	switch {
+	case u.Message != nil && u.Message.Chat != nil:
+		return u.Message.Chat.ID
+	case u.CallbackQuery != nil && u.CallbackQuery.Message != nil && u.CallbackQuery.Message.Chat != nil:
+		return u.CallbackQuery.Message.Chat.ID
+	}
+	if user := getUser(u); user != nil {
+		return int64(user.ID)
+	}
+
+	return 0
+}
@@ -0,0 +1,66 @@
+package bot
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestDispatcher(t *testing.T) {
+	var (
+		mu        sync.Mutex
+		processed = make(map[int64][]int)
+		unblock   = make(chan struct{})
+	)
+
+	d := newDispatcher(2, time.Minute, func(ctx context.Context, u tgbotapi.Update) {
+		if _, ok := ctx.Deadline(); !ok {
+			t.Errorf("expected update %d to have a deadline", u.UpdateID)
+		}
+		// The first update from the first chat is blocked until the
+		// second chat is done, which can only happen if updates from
+		// different chats are processed concurrently.
+		if u.UpdateID == 1 {
+			<-unblock
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		chat := u.Message.Chat.ID
+		processed[chat] = append(processed[chat], u.UpdateID)
+		if chat == 2 && len(processed[chat]) == 2 {
+			close(unblock)
+		}
+	})
+
+	newUpdate := func(id int, chat int64) tgbotapi.Update {
+		return tgbotapi.Update{
+			UpdateID: id,
+			Message:  &tgbotapi.Message{Chat: &tgbotapi.Chat{ID: chat}},
+		}
+	}
+
+	ctx := context.Background()
+	for _, u := range []tgbotapi.Update{
+		newUpdate(1, 1),
+		newUpdate(2, 2),
+		newUpdate(3, 1),
+		newUpdate(4, 2),
+		newUpdate(5, 1),
+	} {
+		d.dispatch(ctx, u)
+	}
+	d.wait()
+
+	want := map[int64][]int{
+		1: {1, 3, 5},
+		2: {2, 4},
+	}
+	if diff := cmp.Diff(want, processed); diff != "" {
+		t.Errorf("unexpected processing order (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,167 @@
+package bot
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+	"github.com/pborzenkov/go-transmission/transmission"
+)
+
+var (
+	// duplicateFields are the torrent fields required to tell the user about
+	// a duplicate
+	duplicateFields = []transmission.TorrentField{
+		transmission.TorrentFieldID,
+		transmission.TorrentFieldHash,
+		transmission.TorrentFieldName,
+		transmission.TorrentFieldStatus,
+		transmission.TorrentFieldDownloadDirectory,
+		transmission.TorrentFieldValidSize,
+		transmission.TorrentFieldWantedSize,
+	}
+)
+
+type duplicateState struct {
+	Hash transmission.Hash `json:"hash"`
+}
+
+// findTorrent returns the torrent with the given hash, or nil if Transmission
+// doesn't have it.
+func (b *Bot) findTorrent(ctx context.Context, hash transmission.Hash) (*transmission.Torrent, error) {
+	torrents, err := b.trans.GetTorrents(ctx, transmission.IDs(hash), duplicateFields...)
+	if err != nil {
+		return nil, err
+	}
+	if len(torrents) == 0 {
+		return nil, nil
+	}
+	return torrents[0], nil
+}
+
+// addNew adds the torrent unless Transmission already has it, in which case
+// the existing torrent is returned instead. Transmission never adds the same
+// torrent twice, but the client doesn't tell whether the torrent is a
+// duplicate, so it's looked up by the hash of the source if it's known, or
+// among the torrents Transmission had before the torrent was added otherwise.
+func (b *Bot) addNew(ctx context.Context, src *torrentSource,
+	req *transmission.AddTorrentReq) (*transmission.NewTorrent, *transmission.Torrent, error) {
+	var known map[transmission.Hash]struct{}
+	if src.Hash != "" {
+		dup, err := b.findTorrent(ctx, src.Hash)
+		if err != nil || dup != nil {
+			return nil, dup, err
+		}
+	} else {
+		torrents, err := b.trans.GetTorrents(ctx, transmission.All(), transmission.TorrentFieldHash)
+		if err != nil {
+			return nil, nil, err
+		}
+		known = make(map[transmission.Hash]struct{}, len(torrents))
+		for _, t := range torrents {
+			known[t.Hash] = struct{}{}
+		}
+	}
+
+	torrent, err := b.trans.AddTorrent(ctx, req)
+	if err != nil {
+		return nil, nil, err
+	}
+	if _, ok := known[torrent.Hash]; ok {
+		dup, err := b.findTorrent(ctx, torrent.Hash)
+		if err != nil || dup != nil {
+			return nil, dup, err
+		}
+	}
+
+	return torrent, nil, nil
+}
+
+// renderDuplicate tells the user that Transmission already has the torrent
+// and offers to view it or resume it if it's paused and the user may do so.
+func (b *Bot) renderDuplicate(t *transmission.Torrent, u *tgbotapi.User) ([]replyOption, error) {
+	cbID, err := b.addCallback(callbackDuplicate, RoleAdder, &duplicateState{Hash: t.Hash})
+	if err != nil {
+		return nil, err
+	}
+	row := tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData("View", cbID+"view"))
+	if t.Status == transmission.StatusStopped && b.mayResume(u, b.userRole(u), t.Hash) {
+		row = append(row, tgbotapi.NewInlineKeyboardButtonData("Resume", cbID+"resume"))
+	}
+
+	return []replyOption{
+		withText("♻️ Already have it: " + duplicateText(t)),
+		withMarkdownV2(),
+		withInlineKeyboard(row),
+	}, nil
+}
+
+func duplicateText(t *transmission.Torrent) string {
+	var perc float64
+	if t.WantedSize > 0 {
+		perc = float64(t.ValidSize) / float64(t.WantedSize) * 100
+	}
+	var paused string
+	if t.Status == transmission.StatusStopped {
+		paused = ", paused"
+	}
+
+	return fmt.Sprintf("\\<*%d*\\> %s, *%s%%* done%s, in *%s*", t.ID, escapeMarkdownV2(t.Name),
+		escapeMarkdownV2(fmt.Sprintf("%.0f", perc)), paused, escapeMarkdownV2(t.DownloadDirectory))
+}
+
+// mayResume tells whether the user may resume the torrent. Like /resume, it's
+// for admins, but the user who has added the torrent may resume it as well.
+func (b *Bot) mayResume(u *tgbotapi.User, role Role, hash transmission.Hash) bool {
+	if role >= RoleAdmin {
+		return true
+	}
+	owners, err := b.store.GetOwners()
+	if err != nil {
+		b.log.Infof("failed to load owners of the tracked torrents: %v", err)
+		return false
+	}
+	o, ok := owners[hash]
+	return ok && isOwnerOrAdmin(u, role, o.UserID)
+}
+
+// duplicateGuard lets anyone who may add torrents view the duplicate, while
+// resuming it is checked by mayResume.
+func (b *Bot) duplicateGuard(q *tgbotapi.CallbackQuery, data json.RawMessage, role Role) bool {
+	if q.Data != "resume" {
+		return true
+	}
+	var state duplicateState
+	if err := json.Unmarshal(data, &state); err != nil {
+		// Let duplicateCallback report the error
+		return true
+	}
+	return b.mayResume(q.From, role, state.Hash)
+}
+
+func (b *Bot) duplicateCallback(ctx context.Context, q *tgbotapi.CallbackQuery,
+	data json.RawMessage) (tgbotapi.Chattable, error) {
+	var state duplicateState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, err
+	}
+
+	switch q.Data {
+	case "view":
+	case "resume":
+		if err := b.trans.StartTorrents(ctx, transmission.IDs(state.Hash)); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, errors.New("I don't know this action") //nolint:stylecheck
+	}
+
+	opts, err := b.renderInfo(ctx, state.Hash)
+	if err != nil {
+		return nil, err
+	}
+
+	return edit(q.Message, opts...), nil
+}
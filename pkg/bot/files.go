@@ -0,0 +1,343 @@
+package bot
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"text/template"
+	"unicode/utf16"
+
+	"github.com/dustin/go-humanize"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+	"github.com/pborzenkov/go-transmission/transmission"
+)
+
+// filesPageSize is the maximum number of files on a single page of the list
+// of files
+const filesPageSize = 8
+
+var (
+	filesTemplate = template.Must(template.New("files").Parse(
+		`{{ .Header }}{{ if .Picking }}{{ if .Files }}Pick the files to download and press *Start*` +
+			`{{ else }}I don't know its files yet, press *Start* to download everything{{ end }}
+{{ end }}
+{{ range .Files }}{{ . }}{{ end }}{{ if gt .Pages 1 }}
+Page *{{ .Page }}* of *{{ .Pages }}*{{ end }}`,
+	))
+
+	filesEntryTemplate = template.Must(template.New("files_entry").Parse(
+		`
+{{ .Index }}\. {{ if .Wanted }}✅{{ else }}⬜{{ end }} *{{ .Name }}*
+*{{ .Done }}* of *{{ .Size }}* \(*{{ .Perc }}%*\){{ if .Priority }}   {{ .Priority }} priority{{ end }}
+`,
+	))
+
+	priorityNames = map[transmission.Priority]string{
+		transmission.PriorityLow:    "low",
+		transmission.PriorityNormal: "normal",
+		transmission.PriorityHigh:   "high",
+	}
+)
+
+type filesState struct {
+	Hash transmission.Hash `json:"hash"`
+	Page int               `json:"page"`
+	// The torrent has just been added paused, and the user picks the files
+	// to download
+	Picking bool `json:"picking,omitempty"`
+	// ID of the user who has added the torrent being picked
+	UserID int `json:"user_id,omitempty"`
+}
+
+func (b *Bot) listFiles(ctx context.Context, m *tgbotapi.Message, args string) (tgbotapi.Chattable, error) {
+	id, err := strconv.Atoi(strings.TrimSpace(args))
+	if err != nil {
+		return reply(m, withText("Tell me which torrent you are interested in, e.g. /files 1")), nil
+	}
+
+	opts, err := b.renderFiles(ctx, transmission.ID(id), 0, false, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	return reply(m, opts...), nil
+}
+
+// filesGuard lets viewers page through the files, while toggling them is for
+// admins only. The files of a torrent that has just been added are picked by
+// the user who has added it.
+func filesGuard(q *tgbotapi.CallbackQuery, data json.RawMessage, role Role) bool {
+	var state filesState
+	if err := json.Unmarshal(data, &state); err != nil {
+		// Let filesCallback report the error
+		return true
+	}
+	switch {
+	case strings.HasPrefix(q.Data, "page"):
+		return true
+	case state.Picking:
+		return isOwnerOrAdmin(q.From, role, state.UserID)
+	default:
+		return role >= RoleAdmin
+	}
+}
+
+func (b *Bot) filesCallback(ctx context.Context, q *tgbotapi.CallbackQuery,
+	data json.RawMessage) (tgbotapi.Chattable, error) {
+	var state filesState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, err
+	}
+
+	page := state.Page
+	switch {
+	case strings.HasPrefix(q.Data, "page"):
+		var err error
+		if page, err = strconv.Atoi(strings.TrimPrefix(q.Data, "page")); err != nil {
+			return nil, err
+		}
+	case strings.HasPrefix(q.Data, "want"), strings.HasPrefix(q.Data, "prio"):
+		if err := b.updateFile(ctx, state.Hash, q.Data[:4], q.Data[4:]); err != nil {
+			return nil, err
+		}
+	case state.Picking && q.Data == "start":
+		return b.startPicked(ctx, q, state.Hash)
+	case state.Picking && q.Data == "cancel":
+		if err := b.trans.RemoveTorrents(ctx, transmission.IDs(state.Hash), true); err != nil {
+			return nil, err
+		}
+		b.forgetTorrent(state.Hash)
+		return edit(q.Message, withText("Ok, not gonna download it")), nil
+	default:
+		return nil, errors.New("I don't know this action") //nolint:stylecheck
+	}
+
+	opts, err := b.renderFiles(ctx, state.Hash, page, state.Picking, state.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	return edit(q.Message, opts...), nil
+}
+
+// startPicked starts the torrent added paused once the user has picked the
+// files to download.
+func (b *Bot) startPicked(ctx context.Context, q *tgbotapi.CallbackQuery,
+	hash transmission.Hash) (tgbotapi.Chattable, error) {
+	if err := b.trans.StartTorrents(ctx, transmission.IDs(hash)); err != nil {
+		return nil, err
+	}
+	torrents, err := b.trans.GetTorrents(ctx, transmission.IDs(hash),
+		transmission.TorrentFieldID,
+		transmission.TorrentFieldName,
+		transmission.TorrentFieldDownloadDirectory,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if len(torrents) == 0 {
+		return edit(q.Message, withText("Don't have this torrent anymore")), nil
+	}
+	t := torrents[0]
+
+	return edit(q.Message,
+		addedText(&transmission.NewTorrent{ID: t.ID, Name: t.Name}, t.DownloadDirectory),
+		withMarkdownV2(),
+	), nil
+}
+
+// updateFile either toggles the file wanted status or cycles through the file
+// priorities.
+func (b *Bot) updateFile(ctx context.Context, hash transmission.Hash, action, index string) error {
+	idx, err := strconv.Atoi(index)
+	if err != nil {
+		return err
+	}
+
+	torrents, err := b.trans.GetTorrents(ctx, transmission.IDs(hash), transmission.TorrentFieldFileStats)
+	if err != nil {
+		return err
+	}
+	if len(torrents) == 0 {
+		return errors.New("I don't have this torrent anymore") //nolint:stylecheck
+	}
+	if idx < 0 || idx >= len(torrents[0].FileStats) {
+		return errors.New("I don't have this file") //nolint:stylecheck
+	}
+	stat := torrents[0].FileStats[idx]
+
+	req := new(transmission.SetTorrentReq)
+	switch {
+	case action == "want" && stat.Wanted:
+		req.UnwantedFiles = []int{idx}
+	case action == "want":
+		req.WantedFiles = []int{idx}
+	case stat.Priority == transmission.PriorityLow:
+		req.NormalPriorityFiles = []int{idx}
+	case stat.Priority == transmission.PriorityNormal:
+		req.HighPriorityFiles = []int{idx}
+	default:
+		req.LowPriorityFiles = []int{idx}
+	}
+
+	return b.trans.SetTorrents(ctx, transmission.IDs(hash), req)
+}
+
+// renderFiles renders the requested page of the list of the torrent files
+// along with the buttons to toggle the files. When picking is set, the user
+// with the owner ID is also offered to start or cancel the torrent.
+func (b *Bot) renderFiles(ctx context.Context, id transmission.SingularIdentifier, page int,
+	picking bool, owner int) ([]replyOption, error) {
+	torrents, err := b.trans.GetTorrents(ctx, transmission.IDs(id),
+		transmission.TorrentFieldID,
+		transmission.TorrentFieldHash,
+		transmission.TorrentFieldName,
+		transmission.TorrentFieldFiles,
+		transmission.TorrentFieldFileStats,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if len(torrents) == 0 {
+		return []replyOption{withText("Don't have this torrent")}, nil
+	}
+	t := torrents[0]
+
+	header := fmt.Sprintf("\\<*%d*\\> *%s*\n", t.ID, escapeMarkdownV2(truncate(t.Name, maxListNameLen)))
+	entries := make([]string, 0, len(t.Files))
+	for i, f := range t.Files {
+		entry, err := renderFilesEntry(i, &f, fileStat(t, i))
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	pages := paginate(entries, filesPageSize, maxMessageLen-listReservedLen-len(utf16.Encode([]rune(header))))
+	if page >= len(pages) {
+		page = len(pages) - 1
+	}
+	if page < 0 {
+		page = 0
+	}
+
+	res := struct {
+		Header  string
+		Picking bool
+		Files   []string
+		Page    int
+		Pages   int
+	}{
+		Header:  header,
+		Picking: picking,
+		Page:    page + 1,
+		Pages:   len(pages),
+	}
+	first := 0
+	for _, p := range pages[:page] {
+		first += len(p)
+	}
+	if len(pages) > 0 {
+		res.Files = pages[page]
+	}
+	buf := new(strings.Builder)
+	if err := filesTemplate.Execute(buf, &res); err != nil {
+		return nil, err
+	}
+	opts := []replyOption{withText(buf.String()), withMarkdownV2()}
+	if len(t.Files) == 0 && !picking {
+		return opts, nil
+	}
+
+	// Anyone allowed to see the files may page through them, filesGuard
+	// takes care of the rest of the buttons
+	role := RoleViewer
+	if picking {
+		role = RoleAdder
+	}
+	cbID, err := b.addCallback(callbackFiles, role, &filesState{
+		Hash:    t.Hash,
+		Page:    page,
+		Picking: picking,
+		UserID:  owner,
+	})
+	if err != nil {
+		return nil, err
+	}
+	rows := make([][]tgbotapi.InlineKeyboardButton, 0, len(res.Files)+1)
+	for i := first; i < first+len(res.Files); i++ {
+		stat := fileStat(t, i)
+		wanted := "⬜"
+		if stat.Wanted {
+			wanted = "✅"
+		}
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(fmt.Sprintf("%d %s", i+1, wanted), cbID+"want"+strconv.Itoa(i)),
+			tgbotapi.NewInlineKeyboardButtonData(fmt.Sprintf("%d %s", i+1, priorityNames[stat.Priority]),
+				cbID+"prio"+strconv.Itoa(i)),
+		))
+	}
+	var nav []tgbotapi.InlineKeyboardButton
+	if page > 0 {
+		nav = append(nav, tgbotapi.NewInlineKeyboardButtonData("◀️", cbID+"page"+strconv.Itoa(page-1)))
+	}
+	if page < len(pages)-1 {
+		nav = append(nav, tgbotapi.NewInlineKeyboardButtonData("▶️", cbID+"page"+strconv.Itoa(page+1)))
+	}
+	if len(nav) > 0 {
+		rows = append(rows, nav)
+	}
+	if picking {
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("Start", cbID+"start"),
+			tgbotapi.NewInlineKeyboardButtonData("Cancel", cbID+"cancel"),
+		))
+	}
+
+	return append(opts, withInlineKeyboard(rows...)), nil
+}
+
+// fileStat returns stats of the i-th file of the torrent. Files are wanted
+// and have normal priority unless Transmission says otherwise.
+func fileStat(t *transmission.Torrent, i int) transmission.FileStat {
+	if i < len(t.FileStats) {
+		return t.FileStats[i]
+	}
+	return transmission.FileStat{Wanted: true}
+}
+
+func renderFilesEntry(i int, f *transmission.File, stat transmission.FileStat) (string, error) {
+	var perc float64
+	if f.Size > 0 {
+		perc = float64(f.Downloaded) / float64(f.Size) * 100
+	}
+	var priority string
+	if stat.Priority != transmission.PriorityNormal {
+		priority = priorityNames[stat.Priority]
+	}
+
+	buf := new(strings.Builder)
+	if err := filesEntryTemplate.Execute(buf, struct {
+		Index    int
+		Wanted   bool
+		Name     string
+		Done     string
+		Size     string
+		Perc     string
+		Priority string
+	}{
+		Index:    i + 1,
+		Wanted:   stat.Wanted,
+		Name:     escapeMarkdownV2(truncate(f.Name, maxListNameLen)),
+		Done:     escapeMarkdownV2(humanize.IBytes(uint64(f.Downloaded))),
+		Size:     escapeMarkdownV2(humanize.IBytes(uint64(f.Size))),
+		Perc:     escapeMarkdownV2(fmt.Sprintf("%.1f", perc)),
+		Priority: priority,
+	}); err != nil {
+		return "", err
+	}
+
+	return buf.String(), nil
+}
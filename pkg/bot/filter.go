@@ -0,0 +1,303 @@
+package bot
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/dustin/go-humanize"
+	"github.com/pborzenkov/go-transmission/transmission"
+)
+
+// torrentFilter selects torrents matching a query and sorts them. The query
+// is a list of space separated terms:
+//
+//	status:<status>    torrent status (stopped, checking, queued, downloading, seeding)
+//	dir:<path>         torrent download directory (including subdirectories)
+//	size<op><size>     torrent size, e.g. size>4G (<op> is one of <, <=, =, >=, >)
+//	ratio<op><ratio>   torrent upload ratio, e.g. ratio<1 (torrents without ratio never match)
+//	error              torrents with errors
+//	sort:<key> [desc]  sort by id, name, size, progress, ratio, added, down or up
+//
+// Terms of the same kind, except for sort, are ORed, while terms of different
+// kinds are ANDed. All the other terms are treated as a case-insensitive
+// substring of the torrent name.
+type torrentFilter struct {
+	name     string
+	statuses map[transmission.Status]struct{}
+	dirs     []string
+	conds    []func(*transmission.Torrent) bool
+	errored  bool
+
+	less func(a, b *transmission.Torrent) bool
+	desc bool
+
+	fields map[transmission.TorrentField]struct{}
+}
+
+var (
+	filterStatuses = map[string][]transmission.Status{
+		"stopped":     {transmission.StatusStopped},
+		"paused":      {transmission.StatusStopped},
+		"checking":    {transmission.StatusCheckWait, transmission.StatusCheck},
+		"queued":      {transmission.StatusCheckWait, transmission.StatusDownloadWait, transmission.StatusSeedWait},
+		"downloading": {transmission.StatusDownload},
+		"seeding":     {transmission.StatusSeed},
+	}
+
+	filterSortKeys = map[string]struct {
+		field transmission.TorrentField
+		less  func(a, b *transmission.Torrent) bool
+	}{
+		"id": {transmission.TorrentFieldID, func(a, b *transmission.Torrent) bool {
+			return a.ID < b.ID
+		}},
+		"name": {transmission.TorrentFieldName, func(a, b *transmission.Torrent) bool {
+			return strings.ToLower(a.Name) < strings.ToLower(b.Name)
+		}},
+		"size": {transmission.TorrentFieldWantedSize, func(a, b *transmission.Torrent) bool {
+			return a.WantedSize < b.WantedSize
+		}},
+		"progress": {transmission.TorrentFieldDataDone, func(a, b *transmission.Torrent) bool {
+			return a.DataDone < b.DataDone
+		}},
+		"ratio": {transmission.TorrentFieldUploadRatio, func(a, b *transmission.Torrent) bool {
+			return a.UploadRatio < b.UploadRatio
+		}},
+		"added": {transmission.TorrentFieldAddedAt, func(a, b *transmission.Torrent) bool {
+			return a.AddedAt.Before(b.AddedAt)
+		}},
+		"down": {transmission.TorrentFieldDownloadRate, func(a, b *transmission.Torrent) bool {
+			return a.DownloadRate < b.DownloadRate
+		}},
+		"up": {transmission.TorrentFieldUploadRate, func(a, b *transmission.Torrent) bool {
+			return a.UploadRate < b.UploadRate
+		}},
+	}
+
+	filterCondRe = regexp.MustCompile(`^(size|ratio)(<=|>=|<|>|=)(.+)$`)
+)
+
+// parseFilter parses the query into a filter.
+func parseFilter(query string) (*torrentFilter, error) {
+	f := &torrentFilter{
+		statuses: make(map[transmission.Status]struct{}),
+		fields:   make(map[transmission.TorrentField]struct{}),
+	}
+
+	var name []string
+	terms := strings.Fields(query)
+	for i := 0; i < len(terms); i++ {
+		term := terms[i]
+		lterm := strings.ToLower(term)
+
+		if m := filterCondRe.FindStringSubmatch(lterm); m != nil {
+			if err := f.addCond(m[1], m[2], m[3]); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if lterm == "error" {
+			f.errored = true
+			f.addFields(transmission.TorrentFieldErrorType)
+			continue
+		}
+
+		key, value, ok := cutTerm(term)
+		switch {
+		case ok && key == "status":
+			statuses, ok := filterStatuses[strings.ToLower(value)]
+			if !ok {
+				return nil, fmt.Errorf("unknown status %q", value)
+			}
+			for _, s := range statuses {
+				f.statuses[s] = struct{}{}
+			}
+			f.addFields(transmission.TorrentFieldStatus)
+		case ok && key == "dir":
+			f.dirs = append(f.dirs, path.Clean(value))
+			f.addFields(transmission.TorrentFieldDownloadDirectory)
+		case ok && key == "sort":
+			s, ok := filterSortKeys[strings.ToLower(value)]
+			if !ok {
+				return nil, fmt.Errorf("unknown sort key %q", value)
+			}
+			f.less = s.less
+			f.addFields(s.field)
+			if i+1 < len(terms) {
+				switch strings.ToLower(terms[i+1]) {
+				case "desc":
+					f.desc = true
+					i++
+				case "asc":
+					i++
+				}
+			}
+		default:
+			name = append(name, term)
+		}
+	}
+	if len(name) > 0 {
+		f.name = strings.ToLower(strings.Join(name, " "))
+		f.addFields(transmission.TorrentFieldName)
+	}
+
+	return f, nil
+}
+
+func cutTerm(term string) (key, value string, ok bool) {
+	i := strings.Index(term, ":")
+	if i <= 0 || i == len(term)-1 {
+		return "", "", false
+	}
+	return strings.ToLower(term[:i]), term[i+1:], true
+}
+
+func (f *torrentFilter) addCond(key, op, value string) error {
+	var (
+		get   func(*transmission.Torrent) float64
+		limit float64
+	)
+	switch key {
+	case "size":
+		size, err := parseSize(value)
+		if err != nil {
+			return fmt.Errorf("invalid size %q", value)
+		}
+		limit = float64(size)
+		get = func(t *transmission.Torrent) float64 { return float64(t.WantedSize) }
+		f.addFields(transmission.TorrentFieldWantedSize)
+	case "ratio":
+		ratio, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return fmt.Errorf("invalid ratio %q", value)
+		}
+		limit = ratio
+		get = func(t *transmission.Torrent) float64 { return t.UploadRatio }
+		f.addFields(transmission.TorrentFieldUploadRatio)
+	}
+
+	var cmp func(a, b float64) bool
+	switch op {
+	case "<":
+		cmp = func(a, b float64) bool { return a < b }
+	case "<=":
+		cmp = func(a, b float64) bool { return a <= b }
+	case "=":
+		cmp = func(a, b float64) bool { return a == b }
+	case ">=":
+		cmp = func(a, b float64) bool { return a >= b }
+	case ">":
+		cmp = func(a, b float64) bool { return a > b }
+	}
+	f.conds = append(f.conds, func(t *transmission.Torrent) bool {
+		// Negative ratio means Transmission doesn't know it yet
+		if key == "ratio" && t.UploadRatio < 0 {
+			return false
+		}
+		return cmp(get(t), limit)
+	})
+
+	return nil
+}
+
+func (f *torrentFilter) addFields(fields ...transmission.TorrentField) {
+	for _, field := range fields {
+		f.fields[field] = struct{}{}
+	}
+}
+
+// requiredFields returns torrent fields required to apply the filter in
+// addition to the given ones.
+func (f *torrentFilter) requiredFields(fields ...transmission.TorrentField) []transmission.TorrentField {
+	seen := make(map[transmission.TorrentField]struct{}, len(fields)+len(f.fields))
+	res := make([]transmission.TorrentField, 0, len(fields)+len(f.fields))
+	for _, field := range fields {
+		if _, ok := seen[field]; !ok {
+			seen[field] = struct{}{}
+			res = append(res, field)
+		}
+	}
+	extra := make([]transmission.TorrentField, 0, len(f.fields))
+	for field := range f.fields {
+		if _, ok := seen[field]; !ok {
+			extra = append(extra, field)
+		}
+	}
+	sort.Slice(extra, func(i, j int) bool { return extra[i] < extra[j] })
+
+	return append(res, extra...)
+}
+
+// isEmpty returns true if the filter matches all the torrents.
+func (f *torrentFilter) isEmpty() bool {
+	return f.name == "" && len(f.statuses) == 0 && len(f.dirs) == 0 && len(f.conds) == 0 && !f.errored
+}
+
+// match returns true if t matches the filter.
+func (f *torrentFilter) match(t *transmission.Torrent) bool {
+	if f.name != "" && !strings.Contains(strings.ToLower(t.Name), f.name) {
+		return false
+	}
+	if len(f.statuses) > 0 {
+		if _, ok := f.statuses[t.Status]; !ok {
+			return false
+		}
+	}
+	if len(f.dirs) > 0 && !matchDirs(f.dirs, t.DownloadDirectory) {
+		return false
+	}
+	for _, cond := range f.conds {
+		if !cond(t) {
+			return false
+		}
+	}
+	if f.errored && t.ErrorType == transmission.ErrorTypeOK {
+		return false
+	}
+
+	return true
+}
+
+func matchDirs(dirs []string, dir string) bool {
+	dir = path.Clean(dir)
+	for _, d := range dirs {
+		if d == "/" || dir == d || strings.HasPrefix(dir, d+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// apply returns torrents matching the filter in the requested order.
+func (f *torrentFilter) apply(torrents []*transmission.Torrent) []*transmission.Torrent {
+	res := make([]*transmission.Torrent, 0, len(torrents))
+	for _, t := range torrents {
+		if f.match(t) {
+			res = append(res, t)
+		}
+	}
+	if f.less != nil {
+		sort.SliceStable(res, func(i, j int) bool {
+			if f.desc {
+				return f.less(res[j], res[i])
+			}
+			return f.less(res[i], res[j])
+		})
+	}
+
+	return res
+}
+
+// parseSize parses a size, e.g. 4G, 1.5GiB or 700MB. Since the bot shows
+// sizes in binary units, single letter suffixes are binary units as well.
+func parseSize(s string) (uint64, error) {
+	v := strings.TrimSpace(s)
+	if n := len(v); n > 0 && strings.ContainsRune("kKmMgGtT", rune(v[n-1])) {
+		v += "i"
+	}
+	return humanize.ParseBytes(v)
+}
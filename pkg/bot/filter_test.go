@@ -0,0 +1,198 @@
+package bot
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/pborzenkov/go-transmission/transmission"
+)
+
+func TestParseFilter_invalid(t *testing.T) {
+	var tests = []struct {
+		name  string
+		query string
+	}{
+		{name: "status", query: "status:unknown"},
+		{name: "sort", query: "sort:unknown"},
+		{name: "size", query: "size>4X"},
+		{name: "ratio", query: "ratio<abc"},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := parseFilter(tc.query); err == nil {
+				t.Errorf("expected an error, got nil")
+			}
+		})
+	}
+}
+
+func TestTorrentFilter(t *testing.T) {
+	now := time.Now()
+	torrents := []*transmission.Torrent{
+		{
+			ID:                1,
+			Name:              "Some Movie 1080p",
+			Status:            transmission.StatusDownload,
+			DownloadDirectory: "/movies",
+			WantedSize:        8 << 30,
+			UploadRatio:       0.5,
+			AddedAt:           now.Add(-time.Hour),
+		},
+		{
+			ID:                2,
+			Name:              "Some Show: S01",
+			Status:            transmission.StatusSeed,
+			DownloadDirectory: "/shows/some",
+			WantedSize:        2 << 30,
+			UploadRatio:       2,
+			AddedAt:           now.Add(-2 * time.Hour),
+		},
+		{
+			ID:                3,
+			Name:              "Another Movie",
+			Status:            transmission.StatusStopped,
+			DownloadDirectory: "/movies2",
+			WantedSize:        1 << 30,
+			UploadRatio:       1,
+			ErrorType:         transmission.ErrorTypeTrackerError,
+			AddedAt:           now,
+		},
+		{
+			ID:                4,
+			Name:              "Linux ISO",
+			Status:            transmission.StatusCheck,
+			DownloadDirectory: "/iso",
+			WantedSize:        4100000000,
+			UploadRatio:       -1,
+			AddedAt:           now.Add(-3 * time.Hour),
+		},
+	}
+
+	var tests = []struct {
+		name  string
+		query string
+		want  []transmission.ID
+		empty bool
+	}{
+		{
+			name:  "empty",
+			query: "",
+			want:  []transmission.ID{1, 2, 3, 4},
+			empty: true,
+		},
+		{
+			name:  "name",
+			query: "some MOVIE",
+			want:  []transmission.ID{1},
+		},
+		{
+			name:  "status",
+			query: "status:downloading status:stopped",
+			want:  []transmission.ID{1, 3},
+		},
+		{
+			name:  "dir",
+			query: "dir:/movies/",
+			want:  []transmission.ID{1},
+		},
+		{
+			name:  "dir_root",
+			query: "dir:/",
+			want:  []transmission.ID{1, 2, 3, 4},
+		},
+		{
+			name:  "size",
+			query: "size>4G",
+			want:  []transmission.ID{1},
+		},
+		{
+			name:  "size_si",
+			query: "size>4GB",
+			want:  []transmission.ID{1, 4},
+		},
+		{
+			name:  "size_range",
+			query: "size>=1GiB size<4GB",
+			want:  []transmission.ID{2, 3},
+		},
+		{
+			name:  "ratio",
+			query: "ratio<1",
+			want:  []transmission.ID{1},
+		},
+		{
+			name:  "ratio_le",
+			query: "ratio<=1",
+			want:  []transmission.ID{1, 3},
+		},
+		{
+			name:  "error",
+			query: "error",
+			want:  []transmission.ID{3},
+		},
+		{
+			name:  "sort",
+			query: "sort:size",
+			want:  []transmission.ID{3, 2, 4, 1},
+			empty: true,
+		},
+		{
+			name:  "sort_desc",
+			query: "sort:added desc",
+			want:  []transmission.ID{3, 1, 2, 4},
+			empty: true,
+		},
+		{
+			name:  "combined",
+			query: "movie status:downloading sort:ratio desc size>1G",
+			want:  []transmission.ID{1},
+		},
+		{
+			name:  "unknown_key",
+			query: "show: s01",
+			want:  []transmission.ID{2},
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			f, err := parseFilter(tc.query)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if f.isEmpty() != tc.empty {
+				t.Errorf("unexpected isEmpty(), want = %v, got = %v", tc.empty, f.isEmpty())
+			}
+
+			got := make([]transmission.ID, 0)
+			for _, t := range f.apply(torrents) {
+				got = append(got, t.ID)
+			}
+			if !reflect.DeepEqual(tc.want, got) {
+				t.Errorf("unexpected torrents, want = %v, got = %v", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestTorrentFilter_requiredFields(t *testing.T) {
+	f, err := parseFilter("status:seeding sort:ratio name")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := []transmission.TorrentField{
+		transmission.TorrentFieldID,
+		transmission.TorrentFieldName,
+		transmission.TorrentFieldStatus,
+		transmission.TorrentFieldUploadRatio,
+	}
+	got := f.requiredFields(transmission.TorrentFieldID, transmission.TorrentFieldName)
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("unexpected fields, want = %v, got = %v", want, got)
+	}
+}
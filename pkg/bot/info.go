@@ -0,0 +1,323 @@
+package bot
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+	"unicode/utf8"
+
+	"github.com/dustin/go-humanize"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+	"github.com/pborzenkov/go-transmission/transmission"
+)
+
+const (
+	// maxInfoTrackers is the maximum number of trackers displayed on the
+	// torrent card
+	maxInfoTrackers = 5
+	// maxInfoErrorLen is the maximum number of characters of the torrent
+	// error displayed on the torrent card
+	maxInfoErrorLen = 512
+
+	infoDateFormat = "2006-01-02 15:04"
+)
+
+var (
+	infoTemplate = template.Must(template.New("info").Parse(
+		`\<*{{ .ID }}*\> *{{ .Name }}*
+
+{{ .Status }} *{{ .Valid }}* of *{{ .Wanted }}* \(*{{ .Perc }}%*\)
+↓*{{ .DownloadRate }}/s* ↑*{{ .UploadRate }}/s* ☯*{{ .Ratio }}*{{ if .ETA }}   ETA: *{{ .ETA }}*{{ end }}` +
+			`{{ if .Limits }}
+{{ .Limits }}{{ end }}
+
+Hash: ` + "`{{ .Hash }}`" + `
+Location: *{{ .Dir }}*{{ if .Added }}
+Added: *{{ .Added }}*{{ end }}{{ if .Done }}
+Done: *{{ .Done }}*{{ end }}
+Peers: *{{ .Peers }}* connected{{ if ge .Seeders 0 }}, seeders: *{{ .Seeders }}*{{ end }}` +
+			`{{ if ge .Leechers 0 }}, leechers: *{{ .Leechers }}*{{ end }}
+Files: *{{ .Files }}* /files\_{{ .ID }}{{ if .Trackers }}
+
+Trackers:{{ range .Trackers }}
+• {{ . }}{{ end }}{{ end }}{{ if .Error }}
+
+⚠️ {{ .Error }}{{ end }}`,
+	))
+)
+
+type torrentInfoState struct {
+	Hash transmission.Hash `json:"hash"`
+}
+
+func (b *Bot) torrentInfo(ctx context.Context, m *tgbotapi.Message, args string) (tgbotapi.Chattable, error) {
+	id, err := strconv.Atoi(strings.TrimSpace(args))
+	if err != nil {
+		return reply(m, withText("Tell me which torrent you are interested in, e.g. /info 1")), nil
+	}
+
+	opts, err := b.renderInfo(ctx, transmission.ID(id))
+	if err != nil {
+		return nil, err
+	}
+
+	return reply(m, opts...), nil
+}
+
+// torrentInfoGuard lets viewers refresh the card, while the rest of the
+// buttons are for admins only.
+func torrentInfoGuard(q *tgbotapi.CallbackQuery, _ json.RawMessage, role Role) bool {
+	return q.Data == "refresh" || role >= RoleAdmin
+}
+
+func (b *Bot) torrentInfoCallback(ctx context.Context, q *tgbotapi.CallbackQuery,
+	data json.RawMessage) (tgbotapi.Chattable, error) {
+	var state torrentInfoState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, err
+	}
+
+	ids := transmission.IDs(state.Hash)
+	var err error
+	switch q.Data {
+	case "stop":
+		err = b.trans.StopTorrents(ctx, ids)
+	case "start":
+		err = b.trans.StartTorrents(ctx, ids)
+	case "verify":
+		err = b.trans.VerifyTorrents(ctx, ids)
+	case "reannounce":
+		err = b.trans.ReannounceTorrents(ctx, ids)
+	case "remove":
+		torrents, err := b.trans.GetTorrents(ctx, ids,
+			transmission.TorrentFieldID,
+			transmission.TorrentFieldHash,
+			transmission.TorrentFieldName,
+		)
+		if err != nil {
+			return nil, err
+		}
+		if len(torrents) == 0 {
+			return edit(q.Message, withText("Don't have this torrent anymore")), nil
+		}
+		opts, err := b.confirmRemoval(torrents)
+		if err != nil {
+			return nil, err
+		}
+		return edit(q.Message, opts...), nil
+	case "refresh":
+	default:
+		return nil, errors.New("I don't know this action") //nolint:stylecheck
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	opts, err := b.renderInfo(ctx, state.Hash)
+	if err != nil {
+		return nil, err
+	}
+
+	return edit(q.Message, opts...), nil
+}
+
+// renderInfo renders a detailed card of the torrent along with the action
+// buttons.
+func (b *Bot) renderInfo(ctx context.Context, id transmission.SingularIdentifier) ([]replyOption, error) {
+	torrents, err := b.trans.GetTorrents(ctx, transmission.IDs(id),
+		transmission.TorrentFieldID,
+		transmission.TorrentFieldHash,
+		transmission.TorrentFieldName,
+		transmission.TorrentFieldStatus,
+		transmission.TorrentFieldIsFinished,
+		transmission.TorrentFieldErrorType,
+		transmission.TorrentFieldError,
+		transmission.TorrentFieldDownloadDirectory,
+		transmission.TorrentFieldAddedAt,
+		transmission.TorrentFieldDoneAt,
+		transmission.TorrentFieldValidSize,
+		transmission.TorrentFieldWantedSize,
+		transmission.TorrentFieldDownloadRate,
+		transmission.TorrentFieldUploadRate,
+		transmission.TorrentFieldUploadRatio,
+		transmission.TorrentFieldETA,
+		transmission.TorrentFieldDownloadRateLimit,
+		transmission.TorrentFieldDownloadRateLimitEnabled,
+		transmission.TorrentFieldUploadRateLimit,
+		transmission.TorrentFieldUploadRateLimited,
+		transmission.TorrentFieldPriority,
+		transmission.TorrentFieldConnectedPeers,
+		transmission.TorrentFieldFiles,
+		transmission.TorrentFieldTrackerStats,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if len(torrents) == 0 {
+		return []replyOption{withText("Don't have this torrent")}, nil
+	}
+	t := torrents[0]
+
+	text, err := renderInfoCard(t)
+	if err != nil {
+		return nil, err
+	}
+
+	// Anyone who can see the card can refresh it, the other actions are
+	// checked by the callback itself
+	cbID, err := b.addCallback(callbackTorrentInfo, RoleViewer, &torrentInfoState{Hash: t.Hash})
+	if err != nil {
+		return nil, err
+	}
+	toggle := tgbotapi.NewInlineKeyboardButtonData("Pause", cbID+"stop")
+	if t.Status == transmission.StatusStopped {
+		toggle = tgbotapi.NewInlineKeyboardButtonData("Resume", cbID+"start")
+	}
+
+	return []replyOption{
+		withText(text),
+		withMarkdownV2(),
+		withInlineKeyboard(
+			tgbotapi.NewInlineKeyboardRow(
+				toggle,
+				tgbotapi.NewInlineKeyboardButtonData("Verify", cbID+"verify"),
+				tgbotapi.NewInlineKeyboardButtonData("Reannounce", cbID+"reannounce"),
+			),
+			tgbotapi.NewInlineKeyboardRow(
+				tgbotapi.NewInlineKeyboardButtonData("Remove", cbID+"remove"),
+				tgbotapi.NewInlineKeyboardButtonData("Refresh", cbID+"refresh"),
+			),
+		),
+	}, nil
+}
+
+func renderInfoCard(t *transmission.Torrent) (string, error) {
+	var eta string
+	if t.ETA > 0 {
+		eta = t.ETA.String()
+	}
+
+	seeders, leechers := -1, -1
+	trackers := make([]string, 0, maxInfoTrackers+1)
+	for i, ts := range t.TrackerStats {
+		if ts.Seeders > seeders {
+			seeders = ts.Seeders
+		}
+		if ts.Leechers > leechers {
+			leechers = ts.Leechers
+		}
+		if i < maxInfoTrackers {
+			trackers = append(trackers, escapeMarkdownV2(trackerHost(&ts)+": "+trackerStatus(&ts)))
+		}
+	}
+	if n := len(t.TrackerStats) - maxInfoTrackers; n > 0 {
+		trackers = append(trackers, escapeMarkdownV2(fmt.Sprintf("and %d more", n)))
+	}
+
+	var torrentErr string
+	if t.ErrorType != transmission.ErrorTypeOK {
+		torrentErr = escapeMarkdownV2(truncate(fmt.Sprintf("%s: %s", t.ErrorType, t.Error), maxInfoErrorLen))
+	}
+
+	buf := new(strings.Builder)
+	if err := infoTemplate.Execute(buf, struct {
+		ID           transmission.ID
+		Name         string
+		Hash         transmission.Hash
+		Status       string
+		Valid        string
+		Wanted       string
+		Perc         string
+		DownloadRate string
+		UploadRate   string
+		Ratio        string
+		ETA          string
+		Limits       string
+		Dir          string
+		Added        string
+		Done         string
+		Peers        int
+		Seeders      int
+		Leechers     int
+		Files        int
+		Trackers     []string
+		Error        string
+	}{
+		ID:           t.ID,
+		Name:         escapeMarkdownV2(truncate(t.Name, maxListNameLen)),
+		Hash:         t.Hash,
+		Status:       torrentStatus(t),
+		Valid:        escapeMarkdownV2(humanize.IBytes(uint64(t.ValidSize))),
+		Wanted:       escapeMarkdownV2(humanize.IBytes(uint64(t.WantedSize))),
+		Perc:         escapeMarkdownV2(fmt.Sprintf("%.1f", float64(t.ValidSize)/float64(t.WantedSize)*100)),
+		DownloadRate: escapeMarkdownV2(humanize.IBytes(uint64(t.DownloadRate))),
+		UploadRate:   escapeMarkdownV2(humanize.IBytes(uint64(t.UploadRate))),
+		Ratio:        escapeMarkdownV2(fmt.Sprintf("%.2f", t.UploadRatio)),
+		ETA:          eta,
+		Limits:       renderLimits(t),
+		Dir:          escapeMarkdownV2(t.DownloadDirectory),
+		Added:        formatDate(t.AddedAt),
+		Done:         formatDate(t.DoneAt),
+		Peers:        t.ConnectedPeers,
+		Seeders:      seeders,
+		Leechers:     leechers,
+		Files:        len(t.Files),
+		Trackers:     trackers,
+		Error:        torrentErr,
+	}); err != nil {
+		return "", err
+	}
+
+	return buf.String(), nil
+}
+
+func trackerHost(ts *transmission.TrackerStat) string {
+	switch {
+	case ts.Host != nil && ts.Host.Host != "":
+		return ts.Host.Host
+	case ts.Host != nil:
+		return ts.Host.String()
+	case ts.AnnounceURL != nil:
+		return ts.AnnounceURL.Host
+	default:
+		return fmt.Sprintf("tracker %d", ts.ID)
+	}
+}
+
+func trackerStatus(ts *transmission.TrackerStat) string {
+	switch {
+	case !ts.HasAnnounced:
+		return "not announced yet"
+	case ts.IsLastAnnounceTimedOut:
+		return "timed out"
+	case ts.IsLastAnnounceSucceeded:
+		return fmt.Sprintf("ok, %d peers, announced %s", ts.LastAnnouncePeerCount,
+			humanize.Time(ts.LastAnnounceTime))
+	case ts.LastAnnounceResult != "":
+		return ts.LastAnnounceResult
+	default:
+		return "failed"
+	}
+}
+
+// truncate makes sure s is not longer than n characters.
+func truncate(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	return string([]rune(s)[:n-1]) + "…"
+}
+
+// formatDate formats a date reported by Transmission. Transmission reports
+// unset dates as Unix epoch, so they are formatted as empty strings.
+func formatDate(t time.Time) string {
+	if t.IsZero() || t.Unix() <= 0 {
+		return ""
+	}
+	return escapeMarkdownV2(t.Format(infoDateFormat))
+}
@@ -0,0 +1,216 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/dustin/go-humanize"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+	"github.com/pborzenkov/go-transmission/transmission"
+)
+
+const (
+	limitUsage    = "Tell me which torrents to limit and how, e.g. /limit 1 2 down=2M up=500K or /limit 1 off"
+	priorityUsage = "Tell me which torrents to prioritize and how, e.g. /priority 1 2 high"
+)
+
+func (b *Bot) limitTorrents(ctx context.Context, m *tgbotapi.Message, args string) (tgbotapi.Chattable, error) {
+	ids, settings := splitIDs(args)
+	if ids == nil || len(settings) == 0 {
+		return reply(m, withText(limitUsage)), nil
+	}
+	req, err := parseLimits(settings)
+	if err != nil {
+		return reply(m, withText(fmt.Sprintf("%v. %s", err, limitUsage))), nil
+	}
+	if err := b.trans.SetTorrents(ctx, ids, req); err != nil {
+		return nil, err
+	}
+
+	return reply(m, withText("Done 😎")), nil
+}
+
+func (b *Bot) prioritizeTorrents(ctx context.Context, m *tgbotapi.Message, args string) (tgbotapi.Chattable, error) {
+	ids, settings := splitIDs(args)
+	if ids == nil || len(settings) != 1 {
+		return reply(m, withText(priorityUsage)), nil
+	}
+	var prio transmission.Priority
+	switch strings.ToLower(settings[0]) {
+	case "high":
+		prio = transmission.PriorityHigh
+	case "normal":
+		prio = transmission.PriorityNormal
+	case "low":
+		prio = transmission.PriorityLow
+	default:
+		return reply(m, withText(priorityUsage)), nil
+	}
+	if err := b.trans.SetTorrents(ctx, ids, &transmission.SetTorrentReq{
+		Priority: transmission.OptPriority(prio),
+	}); err != nil {
+		return nil, err
+	}
+
+	return reply(m, withText("Done 😎")), nil
+}
+
+// splitIDs splits command arguments into the leading torrent IDs and the
+// rest. Unlike getTorrentIDs, it returns nil if there are no IDs, so that
+// the settings are never applied to all the torrents by accident.
+func splitIDs(args string) (transmission.Identifier, []string) {
+	fields := strings.Fields(args)
+	var ids []transmission.SingularIdentifier
+	for len(fields) > 0 {
+		id, err := strconv.Atoi(fields[0])
+		if err != nil {
+			break
+		}
+		ids = append(ids, transmission.ID(id))
+		fields = fields[1:]
+	}
+	if len(ids) == 0 {
+		return nil, joinUnits(fields)
+	}
+
+	return transmission.IDs(ids...), joinUnits(fields)
+}
+
+// rateLimit is a parsed value of a speed limit setting.
+type rateLimit struct {
+	Enabled bool
+	Rate    int64
+}
+
+// parseLimits parses speed limit settings for torrents.
+func parseLimits(settings []string) (*transmission.SetTorrentReq, error) {
+	down, up, err := parseRateLimits(settings)
+	if err != nil {
+		return nil, err
+	}
+
+	req := new(transmission.SetTorrentReq)
+	if down != nil {
+		req.DownloadRateLimitEnabled = transmission.OptBool(down.Enabled)
+		if down.Enabled {
+			req.DownloadRateLimit = transmission.OptInt64(down.Rate)
+		}
+	}
+	if up != nil {
+		req.UploadRateLimitEnabled = transmission.OptBool(up.Enabled)
+		if up.Enabled {
+			req.UploadRateLimit = transmission.OptInt64(up.Rate)
+		}
+	}
+	return req, nil
+}
+
+// parseRateLimits parses speed limit settings, that is either a single off,
+// or down=RATE and up=RATE, where RATE is either a speed or off (unlimited).
+func parseRateLimits(settings []string) (down, up *rateLimit, err error) {
+	if len(settings) == 1 && strings.EqualFold(settings[0], "off") {
+		return &rateLimit{}, &rateLimit{}, nil
+	}
+
+	for _, s := range settings {
+		parts := strings.SplitN(s, "=", 2)
+		if len(parts) != 2 {
+			return nil, nil, fmt.Errorf("I don't understand %q", s) //nolint:stylecheck
+		}
+		limit := new(rateLimit)
+		switch strings.ToLower(parts[0]) {
+		case "down":
+			down = limit
+		case "up":
+			up = limit
+		default:
+			return nil, nil, fmt.Errorf("I don't know what %q is", parts[0]) //nolint:stylecheck
+		}
+		if v := strings.ToLower(parts[1]); v == "off" || v == "unlimited" {
+			continue
+		}
+		if limit.Rate, err = parseRate(parts[1]); err != nil {
+			return nil, nil, err
+		}
+		limit.Enabled = true
+	}
+
+	return down, up, nil
+}
+
+// joinUnits glues units separated by a space back to the values they
+// follow, so that down=1.0 MiB is a single setting.
+func joinUnits(fields []string) []string {
+	res := make([]string, 0, len(fields))
+	for _, f := range fields {
+		if n := len(res); n > 0 && isDigit(res[n-1][len(res[n-1])-1]) && isRateUnit(f) {
+			res[n-1] += " " + f
+			continue
+		}
+		res = append(res, f)
+	}
+	return res
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// isRateUnit checks whether s is a unit of a transfer rate, e.g. MiB/s.
+func isRateUnit(s string) bool {
+	u := strings.TrimSuffix(strings.ToLower(s), "/s")
+	if u == "b" {
+		return true
+	}
+	if len(u) == 0 || !strings.ContainsRune("kmgt", rune(u[0])) {
+		return false
+	}
+	switch u[1:] {
+	case "", "b", "i", "ib":
+		return true
+	}
+	return false
+}
+
+// parseRate parses a transfer rate, e.g. 500K, 2MiB/s, 1.5 MB or anything
+// else humanize.IBytes prints.
+func parseRate(s string) (int64, error) {
+	rate, err := parseSize(strings.TrimSuffix(strings.TrimSpace(s), "/s"))
+	if err != nil {
+		return 0, fmt.Errorf("%q is not a valid speed", s)
+	}
+	// Transmission takes speed limits in whole kilobytes, so anything less
+	// would turn into zero and stop the transfer altogether
+	if rate < 1<<10 {
+		return 0, errors.New("speed must be at least 1 KiB")
+	}
+
+	return int64(rate), nil
+}
+
+// renderLimits describes speed limits and bandwidth priority of the torrent,
+// if they differ from the defaults.
+func renderLimits(t *transmission.Torrent) string {
+	var parts []string
+	if t.DownloadRateLimitEnabled || t.UploadRateLimited {
+		limits := "🚧"
+		if t.DownloadRateLimitEnabled {
+			limits += " ↓*" + escapeMarkdownV2(humanize.IBytes(uint64(t.DownloadRateLimit))) + "/s*"
+		}
+		if t.UploadRateLimited {
+			limits += " ↑*" + escapeMarkdownV2(humanize.IBytes(uint64(t.UploadRateLimit))) + "/s*"
+		}
+		parts = append(parts, limits)
+	}
+	switch t.Priority {
+	case transmission.PriorityHigh:
+		parts = append(parts, "⏫ *high* priority")
+	case transmission.PriorityLow:
+		parts = append(parts, "⏬ *low* priority")
+	}
+
+	return strings.Join(parts, "   ")
+}
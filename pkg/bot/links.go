@@ -0,0 +1,142 @@
+package bot
+
+import (
+	"encoding/base32"
+	"encoding/hex"
+	"net/url"
+	"regexp"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+	"github.com/pborzenkov/go-transmission/transmission"
+)
+
+// maxLinkNameLen is the maximum number of characters of a link displayed to
+// the user
+const maxLinkNameLen = 64
+
+var (
+	linkRe = regexp.MustCompile(`(?i)(?:magnet:\?|https?://)[^\s<>"'` + "`" + `]+`)
+)
+
+// extractLinks returns all the magnet links and links to .torrent files found
+// in the message text, caption and text links, without duplicates. A message
+// consisting of a single link is taken as is, even if the link doesn't look
+// like a .torrent file, since it's likely a tracker download link.
+func extractLinks(m *tgbotapi.Message) []string {
+	if link := singleLink(m.Text); link != "" {
+		return []string{link}
+	}
+	if link := singleLink(m.Caption); link != "" && m.Text == "" {
+		return []string{link}
+	}
+
+	var links []string
+	seen := make(map[string]struct{})
+	add := func(link string) {
+		if _, ok := seen[link]; ok || !isTorrentLink(link) {
+			return
+		}
+		seen[link] = struct{}{}
+		links = append(links, link)
+	}
+
+	for _, text := range []string{m.Text, m.Caption} {
+		for _, link := range linkRe.FindAllString(text, -1) {
+			add(strings.TrimRight(link, ".,;:!?)]}"))
+		}
+	}
+	if m.Entities != nil {
+		for _, e := range *m.Entities {
+			if e.Type == "text_link" {
+				add(e.URL)
+			}
+		}
+	}
+
+	return links
+}
+
+// singleLink returns the text if it consists of a single link.
+func singleLink(text string) string {
+	text = strings.TrimSpace(text)
+	if strings.ContainsAny(text, " \t\r\n") {
+		return ""
+	}
+	ltext := strings.ToLower(text)
+	for _, prefix := range []string{"magnet:", "http://", "https://"} {
+		if strings.HasPrefix(ltext, prefix) {
+			return text
+		}
+	}
+	return ""
+}
+
+// isTorrentLink checks whether the link is either a magnet link or a link to
+// a .torrent file.
+func isTorrentLink(link string) bool {
+	u, err := url.Parse(link)
+	if err != nil {
+		return false
+	}
+	switch strings.ToLower(u.Scheme) {
+	case "magnet":
+		return strings.HasPrefix(u.RawQuery, "xt=") || strings.Contains(u.RawQuery, "&xt=")
+	case "http", "https":
+		return u.Host != "" && strings.HasSuffix(strings.ToLower(u.Path), ".torrent")
+	default:
+		return false
+	}
+}
+
+// linkName returns a short human readable name of the link.
+func linkName(link string) string {
+	if u, err := url.Parse(link); err == nil && strings.EqualFold(u.Scheme, "magnet") {
+		if dn := u.Query().Get("dn"); dn != "" {
+			return truncate(dn, maxLinkNameLen)
+		}
+	}
+	return truncate(link, maxLinkNameLen)
+}
+
+// magnetHash returns the info hash of the torrent the magnet link points to,
+// or an empty string if it's not a magnet link or it doesn't have a valid
+// BitTorrent v1 info hash.
+func magnetHash(link string) transmission.Hash {
+	u, err := url.Parse(link)
+	if err != nil || !strings.EqualFold(u.Scheme, "magnet") {
+		return ""
+	}
+	for _, xt := range u.Query()["xt"] {
+		if !strings.HasPrefix(strings.ToLower(xt), "urn:btih:") {
+			continue
+		}
+		hash := xt[len("urn:btih:"):]
+		switch len(hash) {
+		case 40:
+			if _, err := hex.DecodeString(hash); err == nil {
+				return transmission.Hash(strings.ToLower(hash))
+			}
+		case 32:
+			if data, err := base32.StdEncoding.DecodeString(strings.ToUpper(hash)); err == nil {
+				return transmission.Hash(hex.EncodeToString(data))
+			}
+		}
+	}
+	return ""
+}
+
+// magnetInfo returns what the magnet link tells about the torrent, that is
+// its name and trackers.
+func magnetInfo(link string) *metainfo {
+	mi := new(metainfo)
+	u, err := url.Parse(link)
+	if err != nil || !strings.EqualFold(u.Scheme, "magnet") {
+		return mi
+	}
+	q := u.Query()
+	mi.Name = q.Get("dn")
+	mi.Trackers = q["tr"]
+
+	return mi
+}
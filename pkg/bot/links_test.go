@@ -0,0 +1,120 @@
+package bot
+
+import (
+	"reflect"
+	"testing"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+	"github.com/pborzenkov/go-transmission/transmission"
+)
+
+func TestExtractLinks(t *testing.T) {
+	var tests = []struct {
+		name string
+		msg  tgbotapi.Message
+		want []string
+	}{
+		{
+			name: "single_link",
+			msg:  tgbotapi.Message{Text: " https://tracker.org/download.php?id=1 "},
+			want: []string{"https://tracker.org/download.php?id=1"},
+		},
+		{
+			name: "single_magnet",
+			msg:  tgbotapi.Message{Text: "magnet:?xt=urn:btih:abc"},
+			want: []string{"magnet:?xt=urn:btih:abc"},
+		},
+		{
+			name: "commentary",
+			msg: tgbotapi.Message{Text: "Check these out: magnet:?xt=urn:btih:abc&dn=first, " +
+				"https://tracker.org/files/second.torrent (the best one) and https://tracker.org/about.\n" +
+				"MAGNET:?xt=urn:btih:def"},
+			want: []string{
+				"magnet:?xt=urn:btih:abc&dn=first",
+				"https://tracker.org/files/second.torrent",
+				"MAGNET:?xt=urn:btih:def",
+			},
+		},
+		{
+			name: "duplicates",
+			msg:  tgbotapi.Message{Text: "magnet:?xt=urn:btih:abc and magnet:?xt=urn:btih:abc again"},
+			want: []string{"magnet:?xt=urn:btih:abc"},
+		},
+		{
+			name: "text_links",
+			msg: tgbotapi.Message{
+				Text: "first and second and site",
+				Entities: &[]tgbotapi.MessageEntity{
+					{Type: "text_link", Offset: 0, Length: 5, URL: "magnet:?xt=urn:btih:abc"},
+					{Type: "bold", Offset: 10, Length: 3},
+					{Type: "text_link", Offset: 10, Length: 6, URL: "http://tracker.org/second.torrent"},
+					{Type: "text_link", Offset: 21, Length: 4, URL: "http://tracker.org/"},
+				},
+			},
+			want: []string{"magnet:?xt=urn:btih:abc", "http://tracker.org/second.torrent"},
+		},
+		{
+			name: "caption",
+			msg:  tgbotapi.Message{Caption: "New release! magnet:?xt=urn:btih:abc"},
+			want: []string{"magnet:?xt=urn:btih:abc"},
+		},
+		{
+			name: "no_links",
+			msg:  tgbotapi.Message{Text: "what should we watch tonight? https://example.com magnet:?dn=noxt"},
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			if got := extractLinks(&tc.msg); !reflect.DeepEqual(tc.want, got) {
+				t.Errorf("unexpected links, want = %q, got = %q", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestLinkName(t *testing.T) {
+	var tests = []struct {
+		link string
+		want string
+	}{
+		{link: "magnet:?xt=urn:btih:abc&dn=Some+Movie", want: "Some Movie"},
+		{link: "magnet:?xt=urn:btih:abc", want: "magnet:?xt=urn:btih:abc"},
+		{
+			link: "https://tracker.org/files/a/very/long/path/to/the/torrent/file/that/wont/fit/file.torrent",
+			want: "https://tracker.org/files/a/very/long/path/to/the/torrent/file/…",
+		},
+	}
+
+	for _, tc := range tests {
+		if got := linkName(tc.link); tc.want != got {
+			t.Errorf("unexpected name of %q, want = %q, got = %q", tc.link, tc.want, got)
+		}
+	}
+}
+
+func TestMagnetHash(t *testing.T) {
+	var tests = []struct {
+		link string
+		want transmission.Hash
+	}{
+		{
+			link: "magnet:?xt=urn:btih:C12FE1C06BBA254A9DC9F519B335AA7C1367A88A&dn=Some+Movie",
+			want: "c12fe1c06bba254a9dc9f519b335aa7c1367a88a",
+		},
+		{
+			link: "magnet:?dn=Some+Movie&xt=urn:btih:YEX6DQDLXISUVHOJ6UM3GNNKPQJWPKEK",
+			want: "c12fe1c06bba254a9dc9f519b335aa7c1367a88a",
+		},
+		{link: "magnet:?xt=urn:btih:abc"},
+		{link: "magnet:?xt=urn:btmh:1220caf1e1c30e81cb361b9ee167c4aa64228a7fa4fa9f6105232b28ad099f3a302e"},
+		{link: "https://tracker.org/c12fe1c06bba254a9dc9f519b335aa7c1367a88a.torrent"},
+	}
+
+	for _, tc := range tests {
+		if got := magnetHash(tc.link); tc.want != got {
+			t.Errorf("unexpected hash of %q, want = %q, got = %q", tc.link, tc.want, got)
+		}
+	}
+}
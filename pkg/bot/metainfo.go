@@ -0,0 +1,339 @@
+package bot
+
+import (
+	"crypto/sha1" //nolint:gosec
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/dustin/go-humanize"
+	"github.com/pborzenkov/go-transmission/transmission"
+)
+
+const (
+	// maxBencodeDepth is the maximum nesting level of bencoded lists and
+	// dictionaries. Real torrents don't go deeper than a few levels.
+	maxBencodeDepth = 32
+	// maxSummaryFiles is the maximum number of files displayed in the torrent
+	// summary
+	maxSummaryFiles = 5
+	// maxSummaryTrackers is the maximum number of trackers displayed in the
+	// torrent summary
+	maxSummaryTrackers = 3
+)
+
+var (
+	summaryTemplate = template.Must(template.New("summary").Parse(
+		`📦 {{ .Name }}
+{{ .Size }}{{ if gt .Files 1 }} in {{ .Files }} files{{ end }}{{ if .Private }}, private{{ end }}` +
+			`{{ if .Trackers }}
+Trackers: {{ .Trackers }}{{ end }}{{ range .Names }}
+• {{ . }}{{ end }}`,
+	))
+)
+
+// metainfo is the information about a torrent extracted from a .torrent file.
+type metainfo struct {
+	// SHA-1 of the info dictionary, the way Transmission reports it
+	InfoHash transmission.Hash
+	Name     string
+	// Total size of all the files
+	Size    int64
+	Files   []metainfoFile
+	Private bool
+	// Announce URLs of all the trackers, without duplicates
+	Trackers []string
+}
+
+type metainfoFile struct {
+	// Path of the file relative to the torrent directory
+	Path string
+	Size int64
+}
+
+// parseMetainfo parses and validates contents of a .torrent file.
+func parseMetainfo(data []byte) (*metainfo, error) {
+	d := &bdecoder{data: data}
+	v, err := d.value()
+	if err != nil {
+		return nil, err
+	}
+	root, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, errors.New("not a dictionary")
+	}
+	info, ok := root["info"].(map[string]interface{})
+	if !ok {
+		return nil, errors.New("no info dictionary")
+	}
+
+	hash := sha1.Sum(d.info) //nolint:gosec
+	mi := &metainfo{InfoHash: transmission.Hash(hex.EncodeToString(hash[:]))}
+	if mi.Name, ok = utf8String(info, "name"); !ok || mi.Name == "" {
+		return nil, errors.New("no torrent name")
+	}
+	if n, ok := info["piece length"].(int64); !ok || n <= 0 {
+		return nil, errors.New("invalid piece length")
+	}
+	if p, ok := info["pieces"].(string); !ok || len(p) == 0 || len(p)%20 != 0 {
+		return nil, errors.New("invalid piece hashes")
+	}
+	if p, ok := info["private"].(int64); ok && p == 1 {
+		mi.Private = true
+	}
+
+	switch files := info["files"].(type) {
+	case nil:
+		size, ok := info["length"].(int64)
+		if !ok || size < 0 {
+			return nil, errors.New("invalid file length")
+		}
+		mi.Files = []metainfoFile{{Path: mi.Name, Size: size}}
+	case []interface{}:
+		for i, f := range files {
+			file, err := parseMetainfoFile(f)
+			if err != nil {
+				return nil, fmt.Errorf("file %d: %v", i+1, err)
+			}
+			mi.Files = append(mi.Files, *file)
+		}
+		if len(mi.Files) == 0 {
+			return nil, errors.New("no files")
+		}
+	default:
+		return nil, errors.New("invalid list of files")
+	}
+	for _, f := range mi.Files {
+		mi.Size += f.Size
+	}
+
+	seen := make(map[string]struct{})
+	addTracker := func(v interface{}) {
+		tr, ok := v.(string)
+		if _, dup := seen[tr]; !ok || dup || tr == "" {
+			return
+		}
+		seen[tr] = struct{}{}
+		mi.Trackers = append(mi.Trackers, tr)
+	}
+	addTracker(root["announce"])
+	if tiers, ok := root["announce-list"].([]interface{}); ok {
+		for _, tier := range tiers {
+			if tier, ok := tier.([]interface{}); ok {
+				for _, tr := range tier {
+					addTracker(tr)
+				}
+			}
+		}
+	}
+
+	return mi, nil
+}
+
+func parseMetainfoFile(v interface{}) (*metainfoFile, error) {
+	file, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, errors.New("not a dictionary")
+	}
+	size, ok := file["length"].(int64)
+	if !ok || size < 0 {
+		return nil, errors.New("invalid length")
+	}
+	path, ok := file["path.utf-8"].([]interface{})
+	if !ok {
+		path, ok = file["path"].([]interface{})
+	}
+	if !ok || len(path) == 0 {
+		return nil, errors.New("invalid path")
+	}
+	elems := make([]string, 0, len(path))
+	for _, e := range path {
+		s, ok := e.(string)
+		if !ok {
+			return nil, errors.New("invalid path")
+		}
+		elems = append(elems, s)
+	}
+
+	return &metainfoFile{Path: strings.Join(elems, "/"), Size: size}, nil
+}
+
+// utf8String returns a string value of the key from the dictionary,
+// preferring its UTF-8 variant if there is one.
+func utf8String(dict map[string]interface{}, key string) (string, bool) {
+	if s, ok := dict[key+".utf-8"].(string); ok {
+		return s, true
+	}
+	s, ok := dict[key].(string)
+	return s, ok
+}
+
+// summary renders a short human readable description of the torrent.
+func (mi *metainfo) summary() (string, error) {
+	trackers := make([]string, 0, maxSummaryTrackers)
+	for _, tr := range mi.Trackers {
+		if len(trackers) == maxSummaryTrackers {
+			trackers = append(trackers, fmt.Sprintf("and %d more", len(mi.Trackers)-maxSummaryTrackers))
+			break
+		}
+		if u, err := url.Parse(tr); err == nil && u.Host != "" {
+			tr = u.Hostname()
+		}
+		trackers = append(trackers, tr)
+	}
+
+	var names []string
+	if len(mi.Files) > 1 {
+		for i, f := range mi.Files {
+			if i == maxSummaryFiles {
+				names = append(names, fmt.Sprintf("and %d more", len(mi.Files)-maxSummaryFiles))
+				break
+			}
+			names = append(names, fmt.Sprintf("%s (%s)", truncate(f.Path, maxListNameLen),
+				humanize.IBytes(uint64(f.Size))))
+		}
+	}
+
+	buf := new(strings.Builder)
+	if err := summaryTemplate.Execute(buf, struct {
+		Name     string
+		Size     string
+		Files    int
+		Private  bool
+		Trackers string
+		Names    []string
+	}{
+		Name:     truncate(mi.Name, maxListNameLen),
+		Size:     humanize.IBytes(uint64(mi.Size)),
+		Files:    len(mi.Files),
+		Private:  mi.Private,
+		Trackers: strings.Join(trackers, ", "),
+		Names:    names,
+	}); err != nil {
+		return "", err
+	}
+
+	return buf.String(), nil
+}
+
+// bdecoder decodes bencoded data. Integers are decoded as int64, strings as
+// string, lists as []interface{} and dictionaries as map[string]interface{}.
+type bdecoder struct {
+	data  []byte
+	pos   int
+	depth int
+
+	// Raw value of the "info" key of the top level dictionary
+	info []byte
+}
+
+func (d *bdecoder) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("malformed data at offset %d: %s", d.pos, fmt.Sprintf(format, args...))
+}
+
+func (d *bdecoder) value() (interface{}, error) {
+	if d.pos >= len(d.data) {
+		return nil, d.errorf("unexpected end of data")
+	}
+
+	switch c := d.data[d.pos]; {
+	case c == 'i':
+		d.pos++
+		return d.integer('e')
+	case c >= '0' && c <= '9':
+		return d.string()
+	case c == 'l', c == 'd':
+		if d.depth++; d.depth > maxBencodeDepth {
+			return nil, d.errorf("too deeply nested")
+		}
+		defer func() { d.depth-- }()
+
+		d.pos++
+		if c == 'l' {
+			return d.list()
+		}
+		return d.dict()
+	default:
+		return nil, d.errorf("unexpected character %q", c)
+	}
+}
+
+func (d *bdecoder) integer(end byte) (int64, error) {
+	i := d.pos
+	for i < len(d.data) && d.data[i] != end {
+		i++
+	}
+	if i == len(d.data) {
+		return 0, d.errorf("unterminated integer")
+	}
+	s := string(d.data[d.pos:i])
+	if len(s) > 1 && (s[0] == '0' || strings.HasPrefix(s, "-0")) {
+		return 0, d.errorf("invalid integer %q", s)
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, d.errorf("invalid integer %q", s)
+	}
+	d.pos = i + 1
+
+	return n, nil
+}
+
+func (d *bdecoder) string() (string, error) {
+	n, err := d.integer(':')
+	if err != nil {
+		return "", err
+	}
+	if n < 0 || n > int64(len(d.data)-d.pos) {
+		return "", d.errorf("invalid string length %d", n)
+	}
+	s := string(d.data[d.pos : d.pos+int(n)])
+	d.pos += int(n)
+
+	return s, nil
+}
+
+func (d *bdecoder) list() ([]interface{}, error) {
+	res := make([]interface{}, 0)
+	for {
+		if d.pos < len(d.data) && d.data[d.pos] == 'e' {
+			d.pos++
+			return res, nil
+		}
+		v, err := d.value()
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, v)
+	}
+}
+
+func (d *bdecoder) dict() (map[string]interface{}, error) {
+	res := make(map[string]interface{})
+	for {
+		if d.pos < len(d.data) && d.data[d.pos] == 'e' {
+			d.pos++
+			return res, nil
+		}
+		if d.pos < len(d.data) && (d.data[d.pos] < '0' || d.data[d.pos] > '9') {
+			return nil, d.errorf("dictionary key is not a string")
+		}
+		key, err := d.string()
+		if err != nil {
+			return nil, err
+		}
+		start := d.pos
+		v, err := d.value()
+		if err != nil {
+			return nil, err
+		}
+		if key == "info" && d.depth == 1 {
+			d.info = d.data[start:d.pos]
+		}
+		res[key] = v
+	}
+}
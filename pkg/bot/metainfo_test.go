@@ -0,0 +1,161 @@
+package bot
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var (
+	// testPieces is a valid "pieces" value of a torrent with a single piece.
+	testPieces = "20:" + strings.Repeat("x", 20)
+	// testTorrent is a valid 1 GiB single file torrent.
+	testTorrent = "d8:announce23:http://tracker/announce4:infod6:lengthi1073741824e" +
+		"4:name17:new fancy torrent12:piece lengthi16384e6:pieces" + testPieces + "ee"
+)
+
+func TestParseMetainfo(t *testing.T) {
+	var tests = []struct {
+		name string
+		data string
+		want *metainfo
+	}{
+		{
+			name: "single_file",
+			data: "d8:announce23:http://tracker/announce4:infod6:lengthi1024e4:name8:file.mkv" +
+				"12:piece lengthi16384e6:pieces" + testPieces + "ee",
+			want: &metainfo{
+				InfoHash: "7f57740a6fbf91efcbad9b47bfc677babf7de5d8",
+				Name:     "file.mkv",
+				Size:     1024,
+				Files:    []metainfoFile{{Path: "file.mkv", Size: 1024}},
+				Trackers: []string{"http://tracker/announce"},
+			},
+		},
+		{
+			name: "multiple_files",
+			data: "d4:infod5:filesld6:lengthi1e4:pathl1:a5:b.mkveed6:lengthi2e4:pathl5:c.srteee" +
+				"4:name3:dir12:piece lengthi16384e6:pieces" + testPieces + "7:privatei1eee",
+			want: &metainfo{
+				InfoHash: "c4b6f0301a065f63d80d2955dea7e924bd25ee4d",
+				Name:     "dir",
+				Size:     3,
+				Files: []metainfoFile{
+					{Path: "a/b.mkv", Size: 1},
+					{Path: "c.srt", Size: 2},
+				},
+				Private: true,
+			},
+		},
+		{
+			name: "announce_list",
+			data: "d8:announce3:tr113:announce-listll3:tr13:tr2el3:tr3ee4:infod6:lengthi0e" +
+				"4:name1:f12:piece lengthi1e6:pieces" + testPieces + "ee",
+			want: &metainfo{
+				InfoHash: "5c70a44f25cf7a081f0f68a070e539654142e9d3",
+				Name:     "f",
+				Files:    []metainfoFile{{Path: "f"}},
+				Trackers: []string{"tr1", "tr2", "tr3"},
+			},
+		},
+		{
+			name: "utf8",
+			data: "d4:infod5:filesld6:lengthi1e4:pathl1:?e10:path.utf-8l2:Яeee4:name1:?10:name.utf-8" +
+				"2:Я12:piece lengthi1e6:pieces" + testPieces + "ee",
+			want: &metainfo{
+				InfoHash: "c55f69b0e7813289661c58e10b333a0d3f0b7fef",
+				Name:     "Я",
+				Size:     1,
+				Files:    []metainfoFile{{Path: "Я", Size: 1}},
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := parseMetainfo([]byte(tc.data))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(tc.want, got) {
+				t.Errorf("unexpected metainfo, want = %+v, got = %+v", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestParseMetainfo_invalid(t *testing.T) {
+	var tests = []struct {
+		name string
+		data string
+	}{
+		{name: "empty", data: ""},
+		{name: "html", data: "<!DOCTYPE html><html></html>"},
+		{name: "not_dict", data: "li1ee"},
+		{name: "unterminated", data: "d4:infod"},
+		{name: "leading_zero", data: "i03e"},
+		{name: "negative_zero", data: "i-0e"},
+		{name: "string_too_long", data: "10:abc"},
+		{name: "non_string_key", data: "di1ei2ee"},
+		{name: "too_deep", data: strings.Repeat("l", maxBencodeDepth+1) + strings.Repeat("e", maxBencodeDepth+1)},
+		{name: "no_info", data: "d8:announce3:tr1e"},
+		{name: "no_name", data: "d4:infod6:lengthi1e12:piece lengthi1e6:pieces" + testPieces + "ee"},
+		{name: "no_pieces", data: "d4:infod6:lengthi1e4:name1:f12:piece lengthi1eee"},
+		{name: "bad_pieces", data: "d4:infod6:lengthi1e4:name1:f12:piece lengthi1e6:pieces3:abcee"},
+		{name: "no_length", data: "d4:infod4:name1:f12:piece lengthi1e6:pieces" + testPieces + "ee"},
+		{name: "negative_length", data: "d4:infod6:lengthi-1e4:name1:f12:piece lengthi1e6:pieces" + testPieces + "ee"},
+		{name: "no_files", data: "d4:infod5:filesle4:name1:f12:piece lengthi1e6:pieces" + testPieces + "ee"},
+		{name: "bad_path", data: "d4:infod5:filesld6:lengthi1e4:pathleee4:name1:f12:piece lengthi1e" +
+			"6:pieces" + testPieces + "ee"},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := parseMetainfo([]byte(tc.data)); err == nil {
+				t.Errorf("expected an error, got nil")
+			}
+		})
+	}
+}
+
+func TestMetainfo_summary(t *testing.T) {
+	mi := &metainfo{
+		Name: "Some Show S01",
+		Size: 7 << 30,
+		Files: []metainfoFile{
+			{Path: "e01.mkv", Size: 1 << 30},
+			{Path: "e02.mkv", Size: 1 << 30},
+			{Path: "e03.mkv", Size: 1 << 30},
+			{Path: "e04.mkv", Size: 1 << 30},
+			{Path: "e05.mkv", Size: 1 << 30},
+			{Path: "e06.mkv", Size: 1 << 30},
+			{Path: "e07.mkv", Size: 1 << 30},
+		},
+		Private: true,
+		Trackers: []string{
+			"https://tracker1.org/announce",
+			"udp://tracker2.org:6969",
+			"tracker3",
+			"http://tracker4.org/announce",
+		},
+	}
+
+	want := `📦 Some Show S01
+7.0 GiB in 7 files, private
+Trackers: tracker1.org, tracker2.org, tracker3, and 1 more
+• e01.mkv (1.0 GiB)
+• e02.mkv (1.0 GiB)
+• e03.mkv (1.0 GiB)
+• e04.mkv (1.0 GiB)
+• e05.mkv (1.0 GiB)
+• and 2 more`
+	got, err := mi.summary()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want != got {
+		t.Errorf("unexpected summary, want = %q, got = %q", want, got)
+	}
+}
@@ -0,0 +1,134 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+	"github.com/pborzenkov/go-transmission/transmission"
+)
+
+// newOwner returns an owner of the torrent requested by m.
+func newOwner(m *tgbotapi.Message) *Owner {
+	if m == nil || m.Chat == nil {
+		return nil
+	}
+
+	o := &Owner{
+		ChatID:    m.Chat.ID,
+		MessageID: m.MessageID,
+	}
+	if m.From != nil {
+		o.UserID = m.From.ID
+		o.UserName = m.From.UserName
+	}
+	return o
+}
+
+// ownerID returns the ID of the user who owns the torrent, or 0 if unknown.
+func ownerID(o *Owner) int {
+	if o == nil {
+		return 0
+	}
+	return o.UserID
+}
+
+// trackTorrent remembers who asked the bot to download a torrent, so that
+// the completion notification is delivered to the right chat.
+func (b *Bot) trackTorrent(owner *Owner, t *transmission.NewTorrent) {
+	if owner == nil || t == nil {
+		return
+	}
+
+	o := *owner
+	o.AddedAt = time.Now()
+	if err := b.store.PutOwner(t.Hash, &o); err != nil {
+		b.log.Infof("failed to save owner of torrent %q: %v", t.Hash, err)
+	}
+}
+
+func (b *Bot) watchTorrents(ctx context.Context) {
+	tmr := time.NewTicker(b.notifyInterval)
+	defer tmr.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-tmr.C:
+			b.checkTorrents(ctx)
+		}
+	}
+}
+
+func (b *Bot) checkTorrents(ctx context.Context) {
+	owners, err := b.store.GetOwners()
+	if err != nil {
+		b.log.Infof("failed to load owners of the tracked torrents: %v", err)
+		return
+	}
+	if len(owners) == 0 {
+		return
+	}
+	ids := make([]transmission.SingularIdentifier, 0, len(owners))
+	for h := range owners {
+		ids = append(ids, h)
+	}
+
+	torrents, err := b.trans.GetTorrents(ctx, transmission.IDs(ids...),
+		transmission.TorrentFieldID,
+		transmission.TorrentFieldHash,
+		transmission.TorrentFieldName,
+		transmission.TorrentFieldStatus,
+		transmission.TorrentFieldDataDone,
+		transmission.TorrentFieldDownloadDirectory,
+	)
+	if err != nil {
+		b.log.Infof("failed to check status of the tracked torrents: %v", err)
+		return
+	}
+
+	seen := make(map[transmission.Hash]struct{}, len(torrents))
+	for _, t := range torrents {
+		seen[t.Hash] = struct{}{}
+		owner, ok := owners[t.Hash]
+		if !ok || !isTorrentDone(t) {
+			continue
+		}
+		b.forgetTorrent(t.Hash)
+
+		msg := reply(
+			&tgbotapi.Message{MessageID: owner.MessageID, Chat: &tgbotapi.Chat{ID: owner.ChatID}},
+			withText(fmt.Sprintf("✅ \\<*%d*\\> %s is downloaded\n\nFind it in *%s*",
+				t.ID, escapeMarkdownV2(t.Name), escapeMarkdownV2(t.DownloadDirectory))),
+			withMarkdownV2(),
+			withQuoteMessage(),
+		)
+		if _, err := b.tg.Send(msg); err != nil {
+			b.log.Infof("failed to send download notification: %v", err)
+		}
+	}
+	// Forget about torrents that were removed in the meantime
+	for h := range owners {
+		if _, ok := seen[h]; !ok {
+			b.forgetTorrent(h)
+		}
+	}
+}
+
+func (b *Bot) forgetTorrent(h transmission.Hash) {
+	if err := b.store.DeleteOwner(h); err != nil {
+		b.log.Infof("failed to delete owner of torrent %q: %v", h, err)
+	}
+}
+
+func isTorrentDone(t *transmission.Torrent) bool {
+	switch t.Status {
+	case transmission.StatusCheckWait, transmission.StatusCheck:
+		// percentDone isn't reliable until verification is over
+		return false
+	default:
+		return t.DataDone >= 1
+	}
+}
@@ -0,0 +1,296 @@
+package bot
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"unicode"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+	"github.com/pborzenkov/go-transmission/transmission"
+)
+
+const (
+	queueUsage = "Tell me the download queue size, e.g. /queue size=3 or /queue size=off"
+	// queuePageSize is the maximum number of torrents on a single page of the
+	// queue
+	queuePageSize = 5
+)
+
+var (
+	queueTemplate = template.Must(template.New("queue").Parse(
+		`{{ if .Size }}Downloading *{{ .Size }}* at a time{{ else }}Download queue size is not limited{{ end }}
+{{ range .Torrents }}{{ . }}{{ else }}
+Nothing is queued for download{{ end }}{{ if gt .Pages 1 }}
+Page *{{ .Page }}* of *{{ .Pages }}*{{ end }}`,
+	))
+
+	queueEntryTemplate = template.Must(template.New("queue_entry").Parse(
+		`
+*{{ .Position }}*\. \<*{{ .ID }}*\> *{{ .Name }}*
+{{ .Status }}
+`,
+	))
+
+	// queueMoves are the queue movement actions in the order the buttons are
+	// shown
+	queueMoves = []struct {
+		Action string
+		Button string
+	}{
+		{"top", "⏫"},
+		{"up", "🔼"},
+		{"down", "🔽"},
+		{"bottom", "⏬"},
+	}
+)
+
+type queueState struct {
+	Page int `json:"page"`
+}
+
+func (b *Bot) queue(ctx context.Context, m *tgbotapi.Message, args string) (tgbotapi.Chattable, error) {
+	if args = strings.TrimSpace(args); args != "" {
+		req, err := parseQueueSize(args)
+		if err != nil {
+			return reply(m, withText(fmt.Sprintf("%v. %s", err, queueUsage))), nil
+		}
+		if err := b.trans.SetSession(ctx, req); err != nil {
+			return nil, err
+		}
+	}
+
+	opts, err := b.renderQueue(ctx, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	return reply(m, opts...), nil
+}
+
+func (b *Bot) queueCallback(ctx context.Context, q *tgbotapi.CallbackQuery,
+	data json.RawMessage) (tgbotapi.Chattable, error) {
+	var state queueState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, err
+	}
+
+	page := state.Page
+	if strings.HasPrefix(q.Data, "page") {
+		var err error
+		if page, err = strconv.Atoi(strings.TrimPrefix(q.Data, "page")); err != nil {
+			return nil, err
+		}
+	} else if err := b.moveInQueue(ctx, q.Data); err != nil {
+		return nil, err
+	}
+
+	opts, err := b.renderQueue(ctx, page)
+	if err != nil {
+		return nil, err
+	}
+
+	return edit(q.Message, opts...), nil
+}
+
+// moveInQueue moves the torrent as the action tells, e.g. up12 moves the
+// torrent with ID 12 one position up.
+func (b *Bot) moveInQueue(ctx context.Context, action string) error {
+	move := strings.TrimRightFunc(action, unicode.IsDigit)
+	id, err := strconv.Atoi(action[len(move):])
+	if err != nil {
+		return err
+	}
+	ids := transmission.IDs(transmission.ID(id))
+
+	switch move {
+	case "top":
+		return b.trans.QueueMoveToTop(ctx, ids)
+	case "bottom":
+		return b.trans.QueueMoveToBottom(ctx, ids)
+	case "up", "down":
+	default:
+		return errors.New("I don't know this action") //nolint:stylecheck
+	}
+
+	// Transmission keeps a single queue for all the torrents, so moving the
+	// torrent a single position might swap it with a seeding or stopped one.
+	// Instead, it takes the place of its neighbour in the download queue.
+	queued, err := b.queuedTorrents(ctx)
+	if err != nil {
+		return err
+	}
+	for i, t := range queued {
+		if t.ID != transmission.ID(id) {
+			continue
+		}
+		if move == "up" {
+			i--
+		} else {
+			i++
+		}
+		if i < 0 || i >= len(queued) {
+			return nil
+		}
+		return b.trans.SetTorrents(ctx, ids, &transmission.SetTorrentReq{
+			PositionInQueue: transmission.OptInt(queued[i].PositionInQueue),
+		})
+	}
+
+	return nil
+}
+
+// parseQueueSize parses size=N setting, where N is either the number of
+// torrents downloaded at a time or off (unlimited).
+func parseQueueSize(setting string) (*transmission.SetSessionReq, error) {
+	parts := strings.SplitN(setting, "=", 2)
+	if len(parts) != 2 || !strings.EqualFold(parts[0], "size") {
+		return nil, fmt.Errorf("I don't understand %q", setting) //nolint:stylecheck
+	}
+	if v := strings.ToLower(parts[1]); v == "off" || v == "unlimited" {
+		return &transmission.SetSessionReq{DownloadQueueLimitEnabled: transmission.OptBool(false)}, nil
+	}
+	size, err := strconv.Atoi(parts[1])
+	if err != nil || size <= 0 {
+		return nil, fmt.Errorf("%q is not a valid queue size", parts[1])
+	}
+
+	return &transmission.SetSessionReq{
+		DownloadQueueLimit:        transmission.OptInt(size),
+		DownloadQueueLimitEnabled: transmission.OptBool(true),
+	}, nil
+}
+
+// renderQueue renders the requested page of the download queue along with
+// the buttons to move the torrents around.
+func (b *Bot) renderQueue(ctx context.Context, page int) ([]replyOption, error) {
+	session, err := b.trans.GetSession(ctx,
+		transmission.SessionFieldDownloadQueueLimit,
+		transmission.SessionFieldDownloadQueueLimitEnabled,
+	)
+	if err != nil {
+		return nil, err
+	}
+	queued, err := b.queuedTorrents(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]string, 0, len(queued))
+	for i, t := range queued {
+		entry, err := renderQueueEntry(i+1, t)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	pages := paginate(entries, queuePageSize, maxMessageLen-listReservedLen)
+	if page >= len(pages) {
+		page = len(pages) - 1
+	}
+	if page < 0 {
+		page = 0
+	}
+
+	res := struct {
+		Size     int
+		Torrents []string
+		Page     int
+		Pages    int
+	}{
+		Page:  page + 1,
+		Pages: len(pages),
+	}
+	if session.DownloadQueueLimitEnabled {
+		res.Size = session.DownloadQueueLimit
+	}
+	first := 0
+	for _, p := range pages[:page] {
+		first += len(p)
+	}
+	if len(pages) > 0 {
+		res.Torrents = pages[page]
+	}
+	buf := new(strings.Builder)
+	if err := queueTemplate.Execute(buf, &res); err != nil {
+		return nil, err
+	}
+	opts := []replyOption{withText(buf.String()), withMarkdownV2()}
+	if len(queued) < 2 {
+		return opts, nil
+	}
+
+	id, err := b.addCallback(callbackQueue, RoleAdmin, &queueState{Page: page})
+	if err != nil {
+		return nil, err
+	}
+	rows := make([][]tgbotapi.InlineKeyboardButton, 0, len(res.Torrents)+1)
+	for _, t := range queued[first : first+len(res.Torrents)] {
+		row := make([]tgbotapi.InlineKeyboardButton, 0, len(queueMoves))
+		for _, m := range queueMoves {
+			row = append(row, tgbotapi.NewInlineKeyboardButtonData(fmt.Sprintf("%d %s", t.ID, m.Button),
+				fmt.Sprintf("%s%s%d", id, m.Action, t.ID)))
+		}
+		rows = append(rows, row)
+	}
+	var nav []tgbotapi.InlineKeyboardButton
+	if page > 0 {
+		nav = append(nav, tgbotapi.NewInlineKeyboardButtonData("◀️", id+"page"+strconv.Itoa(page-1)))
+	}
+	if page < len(pages)-1 {
+		nav = append(nav, tgbotapi.NewInlineKeyboardButtonData("▶️", id+"page"+strconv.Itoa(page+1)))
+	}
+	if len(nav) > 0 {
+		rows = append(rows, nav)
+	}
+
+	return append(opts, withInlineKeyboard(rows...)), nil
+}
+
+// queuedTorrents returns the download queue, that is the torrents either
+// downloading or waiting to download in the queue order.
+func (b *Bot) queuedTorrents(ctx context.Context) ([]*transmission.Torrent, error) {
+	torrents, err := b.trans.GetTorrents(ctx, transmission.All(),
+		transmission.TorrentFieldID,
+		transmission.TorrentFieldName,
+		transmission.TorrentFieldStatus,
+		transmission.TorrentFieldPositionInQueue,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	var queued []*transmission.Torrent
+	for _, t := range torrents {
+		if t.Status == transmission.StatusDownload || t.Status == transmission.StatusDownloadWait {
+			queued = append(queued, t)
+		}
+	}
+	sort.Slice(queued, func(i, j int) bool { return queued[i].PositionInQueue < queued[j].PositionInQueue })
+
+	return queued, nil
+}
+
+func renderQueueEntry(pos int, t *transmission.Torrent) (string, error) {
+	buf := new(strings.Builder)
+	if err := queueEntryTemplate.Execute(buf, struct {
+		Position int
+		ID       transmission.ID
+		Name     string
+		Status   string
+	}{
+		Position: pos,
+		ID:       t.ID,
+		Name:     escapeMarkdownV2(truncate(t.Name, maxListNameLen)),
+		Status:   torrentStatus(t),
+	}); err != nil {
+		return "", err
+	}
+
+	return buf.String(), nil
+}
@@ -74,6 +74,10 @@ func reply(m *tgbotapi.Message, opts ...replyOption) tgbotapi.Chattable {
 	msg := message{
 		MessageConfig: tgbotapi.NewMessage(m.Chat.ID, ""),
 	}
+	// Make it clear who the reply is meant for in group chats
+	if isGroup(m.Chat) {
+		opts = append([]replyOption{withQuoteMessage()}, opts...)
+	}
 	for _, opt := range opts {
 		opt(m, &msg)
 	}
@@ -0,0 +1,97 @@
+package bot
+
+import (
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// rule is a compiled Rule.
+type rule struct {
+	Rule
+	re *regexp.Regexp
+}
+
+func newRule(r Rule) (*rule, error) {
+	res := &rule{Rule: r}
+	if r.Pattern != "" {
+		re, err := regexp.Compile(r.Pattern)
+		if err != nil {
+			return nil, err
+		}
+		res.re = re
+	}
+	return res, nil
+}
+
+// match checks whether the torrent matches the rule. Conditions on the
+// things that are unknown about the torrent, like the size of a torrent
+// added via a magnet link, never hold.
+func (r *rule) match(mi *metainfo) bool {
+	if r.re != nil && (mi.Name == "" || !r.re.MatchString(mi.Name)) {
+		return false
+	}
+	if r.Tracker != "" && !matchTracker(mi.Trackers, r.Tracker) {
+		return false
+	}
+	if len(r.Extensions) > 0 || r.MinSize > 0 || r.MaxSize > 0 {
+		if len(mi.Files) == 0 {
+			return false
+		}
+		if r.MinSize > 0 && mi.Size < r.MinSize {
+			return false
+		}
+		if r.MaxSize > 0 && mi.Size > r.MaxSize {
+			return false
+		}
+	}
+	if len(r.Extensions) > 0 && !matchExtension(mi.Files, r.Extensions) {
+		return false
+	}
+
+	return true
+}
+
+func matchTracker(trackers []string, host string) bool {
+	for _, tr := range trackers {
+		u, err := url.Parse(tr)
+		if err != nil {
+			continue
+		}
+		h := strings.ToLower(u.Hostname())
+		if h == host || strings.HasSuffix(h, "."+host) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchExtension checks whether the largest file has one of the extensions.
+func matchExtension(files []metainfoFile, exts []string) bool {
+	largest := files[0]
+	for _, f := range files[1:] {
+		if f.Size > largest.Size {
+			largest = f
+		}
+	}
+
+	ext := strings.ToLower(strings.TrimPrefix(path.Ext(largest.Path), "."))
+	for _, e := range exts {
+		if e == ext {
+			return true
+		}
+	}
+	return false
+}
+
+// matchRule returns the first rule the torrent matches, or nil if there is
+// no such rule.
+func (b *Bot) matchRule(mi *metainfo) *rule {
+	for _, r := range b.rules {
+		if r.match(mi) {
+			return r
+		}
+	}
+	return nil
+}
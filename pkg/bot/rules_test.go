@@ -0,0 +1,62 @@
+package bot
+
+import (
+	"testing"
+)
+
+func TestRule_match(t *testing.T) {
+	movie := &metainfo{
+		Name: "Some.Movie.1080p",
+		Size: 8 << 30,
+		Files: []metainfoFile{
+			{Path: "Some.Movie.1080p/sample.avi", Size: 100 << 20},
+			{Path: "Some.Movie.1080p/movie.MKV", Size: 8<<30 - 100<<20},
+		},
+		Trackers: []string{"https://bt.tracker.org/announce"},
+	}
+	magnet := &metainfo{
+		Name:     "Some.Movie.1080p",
+		Trackers: []string{"udp://tracker.org:6969"},
+	}
+
+	var tests = []struct {
+		name  string
+		rule  Rule
+		mi    *metainfo
+		match bool
+	}{
+		{name: "name", rule: Rule{Pattern: `(?i)1080p`}, mi: movie, match: true},
+		{name: "name_mismatch", rule: Rule{Pattern: `2160p`}, mi: movie},
+		{name: "name_unknown", rule: Rule{Pattern: `.*`}, mi: &metainfo{}},
+		{name: "tracker_subdomain", rule: Rule{Tracker: "tracker.org"}, mi: movie, match: true},
+		{name: "tracker_exact", rule: Rule{Tracker: "tracker.org"}, mi: magnet, match: true},
+		{name: "tracker_mismatch", rule: Rule{Tracker: "other.org"}, mi: movie},
+		{name: "tracker_suffix", rule: Rule{Tracker: "racker.org"}, mi: magnet},
+		{name: "extension", rule: Rule{Extensions: []string{"avi", "mkv"}}, mi: movie, match: true},
+		{name: "extension_largest", rule: Rule{Extensions: []string{"avi"}}, mi: movie},
+		{name: "extension_unknown", rule: Rule{Extensions: []string{"mkv"}}, mi: magnet},
+		{name: "size", rule: Rule{MinSize: 4 << 30, MaxSize: 16 << 30}, mi: movie, match: true},
+		{name: "size_too_small", rule: Rule{MinSize: 10 << 30}, mi: movie},
+		{name: "size_too_big", rule: Rule{MaxSize: 1 << 30}, mi: movie},
+		{name: "size_unknown", rule: Rule{MaxSize: 1 << 30}, mi: magnet},
+		{
+			name:  "all",
+			rule:  Rule{Pattern: `1080p`, Tracker: "tracker.org", Extensions: []string{"mkv"}, MinSize: 1 << 30},
+			mi:    movie,
+			match: true,
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			r, err := newRule(tc.rule)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got := r.match(tc.mi); tc.match != got {
+				t.Errorf("unexpected match, want = %t, got = %t", tc.match, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,165 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+	"github.com/pborzenkov/go-transmission/transmission"
+)
+
+const seedPolicyUsage = "Tell me how long to seed, e.g. /seedpolicy ratio=2 idle=60m for all the torrents, " +
+	"or /seedpolicy 1 2 ratio=global idle=unlimited for specific torrents"
+
+var (
+	seedPolicyTemplate = template.Must(template.New("seed_policy").Parse(
+		`{{ if or .Ratio .Idle }}Torrents stop seeding{{ if .Ratio }} at ratio *{{ .Ratio }}*{{ end }}` +
+			`{{ if and .Ratio .Idle }} or{{ end }}{{ if .Idle }} after being idle for *{{ .Idle }}*{{ end }}` +
+			`{{ else }}Torrents seed forever{{ end }}`,
+	))
+)
+
+// seedLimit is a parsed value of a seeding limit setting. Mode tells which
+// limit applies, the value is only set for the local mode.
+type seedLimit struct {
+	Mode  transmission.Limit
+	Ratio float64
+	Idle  time.Duration
+}
+
+func (b *Bot) seedPolicy(ctx context.Context, m *tgbotapi.Message, args string) (tgbotapi.Chattable, error) {
+	ids, settings := splitIDs(args)
+	ratio, idle, err := parseSeedPolicy(settings, ids != nil)
+	if err != nil {
+		return reply(m, withText(fmt.Sprintf("%v. %s", err, seedPolicyUsage))), nil
+	}
+	if ids != nil {
+		if ratio == nil && idle == nil {
+			return reply(m, withText(seedPolicyUsage)), nil
+		}
+		req := new(transmission.SetTorrentReq)
+		if ratio != nil {
+			req.UploadRatioLimitMode = transmission.OptLimit(ratio.Mode)
+			if ratio.Mode == transmission.LimitLocal {
+				req.UploadRatioLimit = transmission.OptFloat64(ratio.Ratio)
+			}
+		}
+		if idle != nil {
+			req.IdleSeedingLimitMode = transmission.OptLimit(idle.Mode)
+			if idle.Mode == transmission.LimitLocal {
+				req.IdleSeedingLimit = transmission.OptDuration(idle.Idle)
+			}
+		}
+		if err := b.trans.SetTorrents(ctx, ids, req); err != nil {
+			return nil, err
+		}
+
+		return reply(m, withText("Done 😎")), nil
+	}
+
+	if ratio != nil || idle != nil {
+		req := new(transmission.SetSessionReq)
+		if ratio != nil {
+			req.UploadRatioLimitEnabled = transmission.OptBool(ratio.Mode == transmission.LimitLocal)
+			if ratio.Mode == transmission.LimitLocal {
+				req.UploadRatioLimit = transmission.OptFloat64(ratio.Ratio)
+			}
+		}
+		if idle != nil {
+			req.IdleSeedingLimitEnabled = transmission.OptBool(idle.Mode == transmission.LimitLocal)
+			if idle.Mode == transmission.LimitLocal {
+				req.IdleSeedingLimit = transmission.OptDuration(idle.Idle)
+			}
+		}
+		if err := b.trans.SetSession(ctx, req); err != nil {
+			return nil, err
+		}
+	}
+
+	session, err := b.trans.GetSession(ctx,
+		transmission.SessionFieldUploadRatio,
+		transmission.SessionFieldUploadRatioEnabled,
+		transmission.SessionFieldIdleSeedingLimit,
+		transmission.SessionFieldIdleSeedingLimitEnabled,
+	)
+	if err != nil {
+		return nil, err
+	}
+	var res struct {
+		Ratio string
+		Idle  string
+	}
+	if session.UploadRatioEnabled {
+		res.Ratio = escapeMarkdownV2(strconv.FormatFloat(session.UploadRatio, 'f', -1, 64))
+	}
+	if session.IdleSeedingLimitEnabled {
+		res.Idle = formatDuration(session.IdleSeedingLimit)
+	}
+	buf := new(strings.Builder)
+	if err := seedPolicyTemplate.Execute(buf, &res); err != nil {
+		return nil, err
+	}
+
+	return reply(m, withText(buf.String()), withMarkdownV2()), nil
+}
+
+// parseSeedPolicy parses ratio=RATIO and idle=DURATION settings. Both can
+// also be unlimited, and global if they are set for specific torrents.
+func parseSeedPolicy(settings []string, perTorrent bool) (ratio, idle *seedLimit, err error) {
+	for _, s := range settings {
+		parts := strings.SplitN(s, "=", 2)
+		if len(parts) != 2 {
+			return nil, nil, fmt.Errorf("I don't understand %q", s) //nolint:stylecheck
+		}
+		limit := new(seedLimit)
+		switch v := strings.ToLower(parts[1]); {
+		case v == "unlimited" || v == "off":
+			limit.Mode = transmission.LimitUnlimited
+		case v == "global" && perTorrent:
+			limit.Mode = transmission.LimitGlobal
+		default:
+			limit.Mode = transmission.LimitLocal
+		}
+
+		switch strings.ToLower(parts[0]) {
+		case "ratio":
+			if limit.Mode == transmission.LimitLocal {
+				limit.Ratio, err = strconv.ParseFloat(parts[1], 64)
+				if err != nil || limit.Ratio < 0 || math.IsNaN(limit.Ratio) || math.IsInf(limit.Ratio, 0) {
+					return nil, nil, fmt.Errorf("%q is not a valid ratio", parts[1])
+				}
+			}
+			ratio = limit
+		case "idle":
+			if limit.Mode == transmission.LimitLocal {
+				limit.Idle, err = time.ParseDuration(parts[1])
+				if err != nil || limit.Idle < time.Minute {
+					return nil, nil, fmt.Errorf("%q is not a valid idle time, it must be at least a minute", parts[1])
+				}
+			}
+			idle = limit
+		default:
+			return nil, nil, fmt.Errorf("I don't know what %q is", parts[0]) //nolint:stylecheck
+		}
+	}
+
+	return ratio, idle, nil
+}
+
+// formatDuration formats the duration without zero minutes and seconds,
+// e.g. 1h instead of 1h0m0s.
+func formatDuration(d time.Duration) string {
+	s := d.String()
+	if strings.HasSuffix(s, "m0s") {
+		s = s[:len(s)-2]
+	}
+	if strings.HasSuffix(s, "h0m") {
+		s = s[:len(s)-2]
+	}
+	return s
+}
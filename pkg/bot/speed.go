@@ -0,0 +1,141 @@
+package bot
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"text/template"
+
+	"github.com/dustin/go-humanize"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+	"github.com/pborzenkov/go-transmission/transmission"
+)
+
+const speedUsage = "Tell me the speed limits, e.g. /speed down=8M up=1M or /speed up=off"
+
+var (
+	// speedPresets are the speed limits offered as buttons
+	speedPresets = []string{"1M", "5M", "10M"}
+
+	speedTemplate = template.Must(template.New("speed").Parse(
+		`Speed limits: ↓*{{ .Down }}* ↑*{{ .Up }}*{{ if .Turtle }}
+
+🐢 Turtle mode is on, so turtle speeds apply now{{ end }}`,
+	))
+)
+
+func (b *Bot) speed(ctx context.Context, m *tgbotapi.Message, args string) (tgbotapi.Chattable, error) {
+	if settings := joinUnits(strings.Fields(args)); len(settings) > 0 {
+		req, err := parseSpeed(settings)
+		if err != nil {
+			return reply(m, withText(fmt.Sprintf("%v. %s", err, speedUsage))), nil
+		}
+		if err := b.trans.SetSession(ctx, req); err != nil {
+			return nil, err
+		}
+	}
+
+	opts, err := b.renderSpeed(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return reply(m, opts...), nil
+}
+
+func (b *Bot) speedCallback(ctx context.Context, q *tgbotapi.CallbackQuery,
+	_ json.RawMessage) (tgbotapi.Chattable, error) {
+	// The button data is a setting, the same as the one the user can type
+	req, err := parseSpeed([]string{q.Data})
+	if err != nil {
+		return nil, err
+	}
+	if err := b.trans.SetSession(ctx, req); err != nil {
+		return nil, err
+	}
+
+	opts, err := b.renderSpeed(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return edit(q.Message, opts...), nil
+}
+
+// parseSpeed parses global speed limit settings.
+func parseSpeed(settings []string) (*transmission.SetSessionReq, error) {
+	down, up, err := parseRateLimits(settings)
+	if err != nil {
+		return nil, err
+	}
+
+	req := new(transmission.SetSessionReq)
+	if down != nil {
+		req.DownloadRateLimitEnabled = transmission.OptBool(down.Enabled)
+		if down.Enabled {
+			req.DownloadRateLimit = transmission.OptInt64(down.Rate)
+		}
+	}
+	if up != nil {
+		req.UploadRateLimitEnabled = transmission.OptBool(up.Enabled)
+		if up.Enabled {
+			req.UploadRateLimit = transmission.OptInt64(up.Rate)
+		}
+	}
+	return req, nil
+}
+
+// renderSpeed renders the current global speed limits along with the preset
+// buttons.
+func (b *Bot) renderSpeed(ctx context.Context) ([]replyOption, error) {
+	s, err := b.trans.GetSession(ctx,
+		transmission.SessionFieldDownloadRateLimit,
+		transmission.SessionFieldDownloadRateLimitEnabled,
+		transmission.SessionFieldUploadRateLimit,
+		transmission.SessionFieldUploadRateLimitEnabled,
+		transmission.SessionFieldTurtleEnabled,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	buf := new(strings.Builder)
+	if err := speedTemplate.Execute(buf, struct {
+		Down   string
+		Up     string
+		Turtle bool
+	}{
+		Down:   formatRateLimit(s.DownloadRateLimit, s.DownloadRateLimitEnabled),
+		Up:     formatRateLimit(s.UploadRateLimit, s.UploadRateLimitEnabled),
+		Turtle: s.TurtleEnabled,
+	}); err != nil {
+		return nil, err
+	}
+
+	id, err := b.addCallback(callbackSpeed, RoleAdmin, nil)
+	if err != nil {
+		return nil, err
+	}
+	down := make([]tgbotapi.InlineKeyboardButton, 0, len(speedPresets)+1)
+	up := make([]tgbotapi.InlineKeyboardButton, 0, len(speedPresets)+1)
+	for _, p := range speedPresets {
+		down = append(down, tgbotapi.NewInlineKeyboardButtonData("↓ "+p, id+"down="+p))
+		up = append(up, tgbotapi.NewInlineKeyboardButtonData("↑ "+p, id+"up="+p))
+	}
+	down = append(down, tgbotapi.NewInlineKeyboardButtonData("↓ ∞", id+"down=off"))
+	up = append(up, tgbotapi.NewInlineKeyboardButtonData("↑ ∞", id+"up=off"))
+
+	return []replyOption{
+		withText(buf.String()),
+		withMarkdownV2(),
+		withInlineKeyboard(down, up),
+	}, nil
+}
+
+func formatRateLimit(rate int64, enabled bool) string {
+	if !enabled {
+		return "unlimited"
+	}
+	return escapeMarkdownV2(humanize.IBytes(uint64(rate))) + "/s"
+}
@@ -0,0 +1,214 @@
+package bot
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/pborzenkov/go-transmission/transmission"
+)
+
+// Callback is a pending callback query handler in a serializable form.
+type Callback struct {
+	// Kind of the handler
+	Kind string `json:"kind"`
+	// Minimum role required to invoke the handler
+	Role Role `json:"role"`
+	// Handler specific state
+	State json.RawMessage `json:"state,omitempty"`
+	// The handler can't be invoked after this time
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// Owner describes who asked the bot to download a torrent.
+type Owner struct {
+	// Chat the torrent was added from
+	ChatID int64 `json:"chat_id"`
+	// Message that asked to add the torrent
+	MessageID int `json:"message_id"`
+	// User that asked to add the torrent
+	UserID   int    `json:"user_id,omitempty"`
+	UserName string `json:"user_name,omitempty"`
+	// Time when the torrent was added
+	AddedAt time.Time `json:"added_at"`
+}
+
+// Store defines an interface for the bot state storage. The state must
+// survive bot restarts in order for inline keyboards to keep working.
+type Store interface {
+	// GetCallback returns a callback with the given ID, or nil if there is
+	// no such callback.
+	GetCallback(id string) (*Callback, error)
+	// PutCallback saves a callback with the given ID. Expired callbacks
+	// may be dropped by the store.
+	PutCallback(id string, cb *Callback) error
+	// DeleteCallback deletes a callback with the given ID.
+	DeleteCallback(id string) error
+
+	// GetOwners returns owners of all the tracked torrents.
+	GetOwners() (map[transmission.Hash]*Owner, error)
+	// PutOwner saves an owner of the torrent with the given hash.
+	PutOwner(hash transmission.Hash, owner *Owner) error
+	// DeleteOwner stops tracking the owner of the torrent with the given
+	// hash.
+	DeleteOwner(hash transmission.Hash) error
+}
+
+type storeState struct {
+	Callbacks map[string]*Callback         `json:"callbacks"`
+	Owners    map[transmission.Hash]*Owner `json:"owners"`
+}
+
+// FileStore is a Store that keeps the state in memory and saves it to a JSON
+// file on every modification.
+type FileStore struct {
+	path string
+
+	mu    sync.Mutex
+	state storeState
+}
+
+var _ Store = (*FileStore)(nil)
+
+// NewFileStore returns a store that saves the state to a file at path. The
+// state is loaded from the file if it exists.
+func NewFileStore(path string) (*FileStore, error) {
+	s := newMemoryStore()
+	s.path = path
+
+	data, err := ioutil.ReadFile(path)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		return s, nil
+	case err != nil:
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &s.state); err != nil {
+		return nil, fmt.Errorf("invalid state file %q: %v", path, err)
+	}
+	if s.state.Callbacks == nil {
+		s.state.Callbacks = make(map[string]*Callback)
+	}
+	if s.state.Owners == nil {
+		s.state.Owners = make(map[transmission.Hash]*Owner)
+	}
+
+	return s, nil
+}
+
+// newMemoryStore returns a store that doesn't persist the state at all.
+func newMemoryStore() *FileStore {
+	return &FileStore{
+		state: storeState{
+			Callbacks: make(map[string]*Callback),
+			Owners:    make(map[transmission.Hash]*Owner),
+		},
+	}
+}
+
+// GetCallback implements Store.
+func (s *FileStore) GetCallback(id string) (*Callback, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.state.Callbacks[id], nil
+}
+
+// PutCallback implements Store.
+func (s *FileStore) PutCallback(id string, cb *Callback) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for id, cb := range s.state.Callbacks {
+		if cb.ExpiresAt.Before(now) {
+			delete(s.state.Callbacks, id)
+		}
+	}
+	s.state.Callbacks[id] = cb
+
+	return s.save()
+}
+
+// DeleteCallback implements Store.
+func (s *FileStore) DeleteCallback(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.state.Callbacks[id]; !ok {
+		return nil
+	}
+	delete(s.state.Callbacks, id)
+
+	return s.save()
+}
+
+// GetOwners implements Store.
+func (s *FileStore) GetOwners() (map[transmission.Hash]*Owner, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	owners := make(map[transmission.Hash]*Owner, len(s.state.Owners))
+	for h, o := range s.state.Owners {
+		owners[h] = o
+	}
+
+	return owners, nil
+}
+
+// PutOwner implements Store.
+func (s *FileStore) PutOwner(hash transmission.Hash, owner *Owner) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.state.Owners[hash] = owner
+
+	return s.save()
+}
+
+// DeleteOwner implements Store.
+func (s *FileStore) DeleteOwner(hash transmission.Hash) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.state.Owners[hash]; !ok {
+		return nil
+	}
+	delete(s.state.Owners, hash)
+
+	return s.save()
+}
+
+// save writes the state to the file. The state is written to a temporary file
+// first, so that the state file is never left half-written.
+func (s *FileStore) save() error {
+	if s.path == "" {
+		return nil
+	}
+
+	data, err := json.Marshal(&s.state)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(s.path), filepath.Base(s.path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), s.path)
+}
@@ -0,0 +1,83 @@
+package bot
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFileStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+
+	s, err := NewFileStore(path)
+	if err != nil {
+		t.Fatalf("NewFileStore: unexpected error: %v", err)
+	}
+	if err := s.PutCallback("expired", &Callback{Kind: "kind", ExpiresAt: time.Now().Add(-time.Second)}); err != nil {
+		t.Fatalf("PutCallback: unexpected error: %v", err)
+	}
+	if err := s.PutCallback("valid", &Callback{
+		Kind:      "kind",
+		Role:      RoleAdmin,
+		State:     []byte(`{"key":"value"}`),
+		ExpiresAt: time.Now().Add(time.Hour),
+	}); err != nil {
+		t.Fatalf("PutCallback: unexpected error: %v", err)
+	}
+	if err := s.PutCallback("deleted", &Callback{Kind: "kind", ExpiresAt: time.Now().Add(time.Hour)}); err != nil {
+		t.Fatalf("PutCallback: unexpected error: %v", err)
+	}
+	if err := s.DeleteCallback("deleted"); err != nil {
+		t.Fatalf("DeleteCallback: unexpected error: %v", err)
+	}
+	if err := s.PutOwner("abc", &Owner{ChatID: 1, MessageID: 2, UserID: 3}); err != nil {
+		t.Fatalf("PutOwner: unexpected error: %v", err)
+	}
+	if err := s.PutOwner("def", &Owner{ChatID: 4}); err != nil {
+		t.Fatalf("PutOwner: unexpected error: %v", err)
+	}
+	if err := s.DeleteOwner("def"); err != nil {
+		t.Fatalf("DeleteOwner: unexpected error: %v", err)
+	}
+
+	// Reload the state from the file
+	s, err = NewFileStore(path)
+	if err != nil {
+		t.Fatalf("NewFileStore: unexpected error: %v", err)
+	}
+	for _, id := range []string{"expired", "deleted"} {
+		if cb, _ := s.GetCallback(id); cb != nil {
+			t.Errorf("GetCallback(%q): want nil, got %+v", id, cb)
+		}
+	}
+	cb, err := s.GetCallback("valid")
+	if err != nil {
+		t.Fatalf("GetCallback: unexpected error: %v", err)
+	}
+	if cb == nil || cb.Kind != "kind" || cb.Role != RoleAdmin || string(cb.State) != `{"key":"value"}` {
+		t.Errorf("GetCallback: unexpected callback %+v", cb)
+	}
+
+	owners, err := s.GetOwners()
+	if err != nil {
+		t.Fatalf("GetOwners: unexpected error: %v", err)
+	}
+	if len(owners) != 1 {
+		t.Fatalf("GetOwners: want 1 owner, got %d", len(owners))
+	}
+	if o := owners["abc"]; o == nil || o.ChatID != 1 || o.MessageID != 2 || o.UserID != 3 {
+		t.Errorf("GetOwners: unexpected owner %+v", o)
+	}
+}
+
+func TestFileStore_invalid(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	if err := ioutil.WriteFile(path, []byte("not a json"), 0o600); err != nil {
+		t.Fatalf("WriteFile: unexpected error: %v", err)
+	}
+
+	if _, err := NewFileStore(path); err == nil {
+		t.Errorf("NewFileStore: expected an error, got nil")
+	}
+}
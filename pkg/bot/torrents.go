@@ -1,13 +1,16 @@
 package bot
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"strconv"
 	"strings"
 	"text/template"
 	"unicode"
+	"unicode/utf16"
 	"unicode/utf8"
 
 	"github.com/dustin/go-humanize"
@@ -17,20 +20,51 @@ import (
 
 var (
 	statsTemplate = template.Must(template.New("stats").Parse(
-		`↓*{{ .DownloadRate }}/s* ↑*{{ .UploadRate }}/s* {{ if .TurtleMode }}🐢{{ else }}🚀{{ end }}   ` +
+		`↓*{{ .DownloadRate }}/s* ↑*{{ .UploadRate }}/s* ` +
+			`{{ if .TurtleMode }}🐢{{ if .Scheduled }}⏰{{ end }}{{ else }}🚀{{ end }}   ` +
 			`↻*{{ .ActiveTorrents }}* ⊗*{{ .PausedTorrents }}*   ` +
 			`↓*{{ .DownloadedTotal }}* ↑*{{ .UploadedTotal }}* ☯*{{ .Ratio }}*`,
 	))
 
 	listTemplate = template.Must(template.New("list").Parse(
 		`{{ if .Torrents }}Here is what I got:
-{{ range .Torrents }}
-\<*{{ .ID }}*\> *{{ .Name }}*
+{{ range .Torrents }}{{ . }}{{ end }}` +
+			`{{ if gt .Pages 1 }}
+Page *{{ .Page }}* of *{{ .Pages }}*{{ end }}{{ else }}Don't have any matching torrent{{ end }}`,
+	))
+
+	listEntryTemplate = template.Must(template.New("list_entry").Parse(
+		`
+\<*{{ .ID }}*\> *{{ .Name }}* /info\_{{ .ID }}
 {{ .Status }} *{{ .Valid }}* of *{{ .Wanted }}* \(*{{ .Perc }}%*\)   ` +
 			`↓*{{ .DownloadRate }}/s* ↑*{{ .UploadRate }}/s*` +
 			`{{ if .Ratio }} ☯*{{ .Ratio }}*{{ end }}` +
-			`{{ if .ETA }}   ETA: *{{ .ETA }}*{{ end }}
-{{ end }}{{ else }}Don't have any matching torrent{{ end }}`,
+			`{{ if .ETA }}   ETA: *{{ .ETA }}*{{ end }}{{ if .Limits }}
+{{ .Limits }}{{ end }}
+`,
+	))
+
+	batchTemplate = template.Must(template.New("batch").Parse(
+		`{{ range .Added }}👌 \<*{{ .ID }}*\> {{ .Name }}
+{{ end }}{{ range .Duplicates }}♻️ Already have it: {{ . }}
+{{ end }}{{ range .Failed }}❌ {{ .Name }}: {{ .Error }}
+{{ end }}{{ if .Path }}
+Will be downloaded to *{{ .Path }}*{{ end }}`,
+	))
+
+	spaceTemplate = template.Must(template.New("space").Parse(
+		`{{ range . }}*{{ .Name }}* {{ .Path }}   ` +
+			`{{ if .Known }}💾*{{ .Free }}* free{{ else }}💾 unknown{{ end }}
+{{ end }}`,
+	))
+
+	moveTemplate = template.Must(template.New("move").Parse(
+		`{{ if .Path }}Moving the following torrents to *{{ .Path }}*:` +
+			`{{ else }}Where should I move the following torrents?{{ end }}
+
+{{ range .Torrents -}}
+\<*{{ .ID }}*\> *{{ .Name }}*
+{{ end }}`,
 	))
 
 	removeTemplate = template.Must(template.New("remove").Parse(
@@ -43,14 +77,92 @@ Should I remove their data files as well?`,
 	))
 )
 
-func (b *Bot) addTorrent(ctx context.Context, m *tgbotapi.Message,
-	req *transmission.AddTorrentReq) (tgbotapi.Chattable, error) {
-	if len(b.locations) == 0 {
-		torrent, err := b.trans.AddTorrent(ctx, req)
+// torrentSource describes where to get a torrent from. Unlike
+// transmission.AddTorrentReq, it can be saved as a part of the callback state.
+type torrentSource struct {
+	URL  string `json:"url,omitempty"`
+	Meta []byte `json:"meta,omitempty"`
+	// Info hash of the torrent, if known
+	Hash transmission.Hash `json:"hash,omitempty"`
+}
+
+func (s *torrentSource) request() *transmission.AddTorrentReq {
+	if s.Meta != nil {
+		return &transmission.AddTorrentReq{Meta: bytes.NewReader(s.Meta)}
+	}
+	return &transmission.AddTorrentReq{URL: transmission.OptString(s.URL)}
+}
+
+type addTorrentState struct {
+	Source torrentSource `json:"source"`
+	Owner  *Owner        `json:"owner,omitempty"`
+	// Add the torrent paused and let the user pick the files to download
+	PickFiles bool `json:"pick_files,omitempty"`
+	// Total size of the torrent, if known
+	Size int64 `json:"size,omitempty"`
+	// Short description of the torrent, if known
+	Summary string `json:"summary,omitempty"`
+	// Several torrents to be added at once. Source is ignored if set
+	Batch []torrentSource `json:"batch,omitempty"`
+}
+
+func (b *Bot) addTorrent(ctx context.Context, m *tgbotapi.Message, src *torrentSource) (tgbotapi.Chattable, error) {
+	state := &addTorrentState{
+		Source: *src,
+		Owner:  newOwner(m),
+	}
+	mi := magnetInfo(src.URL)
+	if src.Meta != nil {
+		var err error
+		mi, err = parseMetainfo(src.Meta)
+		if err != nil {
+			return reply(m,
+				withText(fmt.Sprintf("This doesn't look like a torrent file (%v)", err)),
+				withQuoteMessage(),
+			), nil
+		}
+		if state.Summary, err = mi.summary(); err != nil {
+			return nil, err
+		}
+		state.Size = mi.Size
+		state.Source.Hash = mi.InfoHash
+	} else {
+		state.Source.Hash = magnetHash(src.URL)
+	}
+
+	rule := b.matchRule(mi)
+	if rule != nil && state.Size > 0 {
+		// Let the user decide where to put the torrent that doesn't fit
+		if free, ok := b.freeSpace(ctx, b.locations[rule.Location]); ok && state.Size > free {
+			b.log.Debugf("ignoring rule %q: %s doesn't fit into %q", rule.Name, mi.Name, rule.Location)
+			rule = nil
+		}
+	}
+	if len(b.locations) == 0 || rule != nil {
+		req := state.Source.request()
+		if rule != nil {
+			req.DownloadDirectory = transmission.OptString(b.locations[rule.Location])
+		}
+		torrent, dup, err := b.addNew(ctx, &state.Source, req)
 		if err != nil {
 			return nil, err
 		}
+		if dup != nil {
+			opts, err := b.renderDuplicate(dup, m.From)
+			if err != nil {
+				return nil, err
+			}
+			return reply(m, append(opts, withQuoteMessage())...), nil
+		}
+		b.trackTorrent(state.Owner, torrent)
 
+		if rule != nil {
+			opts, err := b.ruleAdded(torrent, rule, ownerID(state.Owner))
+			if err != nil {
+				return nil, err
+			}
+			return reply(m, append(opts, withQuoteMessage())...), nil
+		}
 		return reply(m,
 			withText(fmt.Sprintf("👌 \\<*%d*\\> %s", torrent.ID, escapeMarkdownV2(torrent.Name))),
 			withMarkdownV2(),
@@ -58,51 +170,340 @@ func (b *Bot) addTorrent(ctx context.Context, m *tgbotapi.Message,
 		), nil
 	}
 
-	id := b.addCallbackHandler(func(ctx context.Context, q *tgbotapi.CallbackQuery) (tgbotapi.Chattable, error) {
-		var path string
-		switch q.Data {
-		case "cancel":
-			return edit(q.Message, withText("Ok, not gonna download it")), nil
-		case "other":
-		default:
-			var ok bool
-			path, ok = b.locations[q.Data]
-			if !ok {
-				return nil, errors.New("I don't know this location") //nolint:stylecheck
+	// Don't bother asking where to download the torrent if it's already there
+	if state.Source.Hash != "" {
+		dup, err := b.findTorrent(ctx, state.Source.Hash)
+		if err != nil {
+			return nil, err
+		}
+		if dup != nil {
+			opts, err := b.renderDuplicate(dup, m.From)
+			if err != nil {
+				return nil, err
 			}
+			return reply(m, append(opts, withQuoteMessage())...), nil
+		}
+	}
 
-			req.DownloadDirectory = transmission.OptString(path)
+	opts, err := b.askLocation(ctx, state)
+	if err != nil {
+		return nil, err
+	}
+
+	return reply(m, append(opts, withQuoteMessage())...), nil
+}
+
+type ruleOverrideState struct {
+	Hash transmission.Hash `json:"hash"`
+	// ID of the user who has added the torrent
+	UserID int `json:"user_id,omitempty"`
+}
+
+// ruleAdded tells the user which rule has picked the location of the torrent
+// and offers the user with the owner ID to move it elsewhere or to pick the
+// files to download.
+func (b *Bot) ruleAdded(t *transmission.NewTorrent, r *rule, owner int) ([]replyOption, error) {
+	id, err := b.addCallback(callbackRuleOverride, RoleAdder, &ruleOverrideState{Hash: t.Hash, UserID: owner})
+	if err != nil {
+		return nil, err
+	}
+
+	return []replyOption{
+		withText(fmt.Sprintf("👌 \\<*%d*\\> %s\n\nWill be downloaded to *%s* as told by rule *%s*",
+			t.ID, escapeMarkdownV2(t.Name), escapeMarkdownV2(b.locations[r.Location]), escapeMarkdownV2(r.Name))),
+		withMarkdownV2(),
+		withInlineKeyboard(tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("Pick files", id+"pick"),
+			tgbotapi.NewInlineKeyboardButtonData("Choose another location", id+"override"),
+		)),
+	}, nil
+}
+
+// ruleOverrideGuard lets only admins and the user who has added the torrent
+// touch it.
+func ruleOverrideGuard(q *tgbotapi.CallbackQuery, data json.RawMessage, role Role) bool {
+	var state ruleOverrideState
+	if err := json.Unmarshal(data, &state); err != nil {
+		// Let ruleOverrideCallback report the error
+		return true
+	}
+	return isOwnerOrAdmin(q.From, role, state.UserID)
+}
+
+func (b *Bot) ruleOverrideCallback(ctx context.Context, q *tgbotapi.CallbackQuery,
+	data json.RawMessage) (tgbotapi.Chattable, error) {
+	var state ruleOverrideState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, err
+	}
+
+	ids := transmission.IDs(state.Hash)
+	switch q.Data {
+	case "pick":
+		// The torrent is already being downloaded, so stop it until the user
+		// is done picking the files
+		if err := b.trans.StopTorrents(ctx, ids); err != nil {
+			return nil, err
+		}
+		opts, err := b.renderFiles(ctx, state.Hash, 0, true, state.UserID)
+		if err != nil {
+			return nil, err
 		}
-		torrent, err := b.trans.AddTorrent(ctx, req)
+		return edit(q.Message, opts...), nil
+	case "override":
+	default:
+		return nil, errors.New("I don't know this action") //nolint:stylecheck
+	}
+
+	torrents, err := b.trans.GetTorrents(ctx, ids,
+		transmission.TorrentFieldID,
+		transmission.TorrentFieldHash,
+		transmission.TorrentFieldName,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if len(torrents) == 0 {
+		return edit(q.Message, withText("Don't have this torrent anymore")), nil
+	}
+
+	opts, err := b.askMove(torrents, state.UserID)
+	if err != nil {
+		return nil, err
+	}
+	return edit(q.Message, opts...), nil
+}
+
+// addTorrents adds several torrents at once. Unlike addTorrent, the user can't
+// pick the files to download, and there is a single summary reply for all
+// the torrents.
+func (b *Bot) addTorrents(ctx context.Context, m *tgbotapi.Message, links []string) (tgbotapi.Chattable, error) {
+	state := &addTorrentState{
+		Owner: newOwner(m),
+		Batch: make([]torrentSource, 0, len(links)),
+	}
+	for _, l := range links {
+		state.Batch = append(state.Batch, torrentSource{URL: l, Hash: magnetHash(l)})
+	}
+
+	if len(b.locations) == 0 {
+		text, err := b.addBatch(ctx, state, "")
 		if err != nil {
 			return nil, err
 		}
+		return reply(m, withText(text), withMarkdownV2(), withQuoteMessage()), nil
+	}
+
+	opts, err := b.askLocation(ctx, state)
+	if err != nil {
+		return nil, err
+	}
+
+	return reply(m, append(opts, withQuoteMessage())...), nil
+}
 
+// addBatch adds all the torrents of the batch to path and renders a summary
+// of the results.
+func (b *Bot) addBatch(ctx context.Context, state *addTorrentState, path string) (string, error) {
+	type failure struct {
+		Name  string
+		Error string
+	}
+	var res struct {
+		Added      []*transmission.NewTorrent
+		Duplicates []string
+		Failed     []failure
+		Path       string
+	}
+	for i := range state.Batch {
+		src := &state.Batch[i]
+		req := src.request()
 		if path != "" {
-			path = fmt.Sprintf("\n\nWill be downloaded to *%s*", escapeMarkdownV2(path))
+			req.DownloadDirectory = transmission.OptString(path)
+		}
+		torrent, dup, err := b.addNew(ctx, src, req)
+		if dup != nil {
+			res.Duplicates = append(res.Duplicates, duplicateText(dup))
+			continue
+		}
+		if err != nil {
+			res.Failed = append(res.Failed, failure{
+				Name:  escapeMarkdownV2(linkName(src.URL)),
+				Error: escapeMarkdownV2(err.Error()),
+			})
+			continue
+		}
+		b.trackTorrent(state.Owner, torrent)
+		res.Added = append(res.Added, &transmission.NewTorrent{
+			ID:   torrent.ID,
+			Name: escapeMarkdownV2(torrent.Name),
+		})
+	}
+	if len(res.Added) > 0 {
+		res.Path = escapeMarkdownV2(path)
+	}
+
+	buf := new(strings.Builder)
+	if err := batchTemplate.Execute(buf, &res); err != nil {
+		return "", err
+	}
+
+	return buf.String(), nil
+}
+
+// askLocation renders a question where the torrent should be downloaded to.
+// Every location is labelled with the amount of free space it has, and the
+// user is warned if the torrent is known not to fit into the location.
+func (b *Bot) askLocation(ctx context.Context, state *addTorrentState) ([]replyOption, error) {
+	id, err := b.addCallback(callbackAddTorrent, RoleAdder, state)
+	if err != nil {
+		return nil, err
+	}
+
+	var noSpace []string
+	button := func(name, path, data string) tgbotapi.InlineKeyboardButton {
+		free, ok := b.freeSpace(ctx, path)
+		if !ok {
+			return tgbotapi.NewInlineKeyboardButtonData(name, id+data)
 		}
-		return edit(
-			q.Message,
-			withText(fmt.Sprintf("👌 \\<*%d*\\> %s%s",
-				torrent.ID, escapeMarkdownV2(torrent.Name), path)),
-			withMarkdownV2()), nil
-	})
+		label := fmt.Sprintf("%s (%s)", name, humanize.IBytes(uint64(free)))
+		if state.Size > free {
+			noSpace = append(noSpace, name)
+			label = "⚠️ " + label
+		}
+		return tgbotapi.NewInlineKeyboardButtonData(label, id+data)
+	}
 
 	row := make([]tgbotapi.InlineKeyboardButton, 0, len(b.locations)+1)
 	for _, n := range b.locationsOrder {
-		row = append(row, tgbotapi.NewInlineKeyboardButtonData(n, id+n))
+		row = append(row, button(n, b.locations[n], n))
+	}
+	row = append(row, button("Other", b.defaultDownloadDir(ctx), "other"))
+
+	text := "Ok, gonna queue it for download. But first tell me what is it?"
+	if len(state.Batch) > 0 {
+		text = fmt.Sprintf("Ok, gonna queue %d torrents for download. But first tell me what are they?",
+			len(state.Batch))
+		if len(b.rules) > 0 {
+			text += "\n\nDownload rules only apply to torrents sent one at a time."
+		}
 	}
-	row = append(row, tgbotapi.NewInlineKeyboardButtonData("Other", id+"other"))
-	return reply(
-		m,
-		withText("Ok, gonna queue it for download. But first tell me what is it?"),
-		withInlineKeyboard(
-			row,
-			tgbotapi.NewInlineKeyboardRow(
-				tgbotapi.NewInlineKeyboardButtonData("Cancel", id+"cancel"),
-			)),
-		withQuoteMessage(),
-	), nil
+	if state.Summary != "" {
+		text += "\n\n" + state.Summary
+	}
+	if len(noSpace) > 0 {
+		text += fmt.Sprintf("\n\n⚠️ It needs %s, which is more than there is free in %s.",
+			humanize.IBytes(uint64(state.Size)), strings.Join(noSpace, ", "))
+	}
+	controls := tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData("Cancel", id+"cancel"))
+	if len(state.Batch) == 0 {
+		pick := tgbotapi.NewInlineKeyboardButtonData("Pick files", id+"pick")
+		if state.PickFiles {
+			text += "\n\nYou'll be able to pick the files to download before it starts."
+			pick = tgbotapi.NewInlineKeyboardButtonData("All files", id+"all")
+		}
+		controls = append([]tgbotapi.InlineKeyboardButton{pick}, controls...)
+	}
+
+	return []replyOption{
+		withText(text),
+		withInlineKeyboard(row, controls),
+	}, nil
+}
+
+// freeSpace returns the amount of free space at path. It's not a fatal error
+// if Transmission can't tell it, so the error is only logged.
+func (b *Bot) freeSpace(ctx context.Context, path string) (int64, bool) {
+	if path == "" {
+		return 0, false
+	}
+	free, err := b.trans.GetFreeSpace(ctx, path)
+	if err != nil {
+		b.log.Debugf("failed to get free space at %q: %v", path, err)
+		return 0, false
+	}
+	return free, true
+}
+
+// defaultDownloadDir returns the session default download directory, or an
+// empty string if it's unknown.
+func (b *Bot) defaultDownloadDir(ctx context.Context) string {
+	session, err := b.trans.GetSession(ctx, transmission.SessionFieldDownloadDirectory)
+	if err != nil {
+		b.log.Debugf("failed to get default download directory: %v", err)
+		return ""
+	}
+	return session.DownloadDirectory
+}
+
+func (b *Bot) addTorrentCallback(ctx context.Context, q *tgbotapi.CallbackQuery,
+	data json.RawMessage) (tgbotapi.Chattable, error) {
+	var state addTorrentState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, err
+	}
+
+	req := state.Source.request()
+	var path string
+	switch q.Data {
+	case "cancel":
+		return edit(q.Message, withText("Ok, not gonna download it")), nil
+	case "pick", "all":
+		state.PickFiles = q.Data == "pick"
+		opts, err := b.askLocation(ctx, &state)
+		if err != nil {
+			return nil, err
+		}
+		return edit(q.Message, opts...), nil
+	case "other":
+	default:
+		var ok bool
+		path, ok = b.locations[q.Data]
+		if !ok {
+			return nil, errors.New("I don't know this location") //nolint:stylecheck
+		}
+
+		req.DownloadDirectory = transmission.OptString(path)
+	}
+	if len(state.Batch) > 0 {
+		text, err := b.addBatch(ctx, &state, path)
+		if err != nil {
+			return nil, err
+		}
+		return edit(q.Message, withText(text), withMarkdownV2()), nil
+	}
+	if state.PickFiles {
+		req.Paused = transmission.OptBool(true)
+	}
+	torrent, dup, err := b.addNew(ctx, &state.Source, req)
+	if err != nil {
+		return nil, err
+	}
+	if dup != nil {
+		opts, err := b.renderDuplicate(dup, q.From)
+		if err != nil {
+			return nil, err
+		}
+		return edit(q.Message, opts...), nil
+	}
+	b.trackTorrent(state.Owner, torrent)
+
+	if state.PickFiles {
+		opts, err := b.renderFiles(ctx, torrent.Hash, 0, true, ownerID(state.Owner))
+		if err != nil {
+			return nil, err
+		}
+		return edit(q.Message, opts...), nil
+	}
+
+	return edit(q.Message, addedText(torrent, path), withMarkdownV2()), nil
+}
+
+func addedText(t *transmission.NewTorrent, path string) replyOption {
+	if path != "" {
+		path = fmt.Sprintf("\n\nWill be downloaded to *%s*", escapeMarkdownV2(path))
+	}
+	return withText(fmt.Sprintf("👌 \\<*%d*\\> %s%s", t.ID, escapeMarkdownV2(t.Name), path))
 }
 
 func (b *Bot) checkPort(ctx context.Context, m *tgbotapi.Message) (tgbotapi.Chattable, error) {
@@ -124,7 +525,13 @@ func (b *Bot) stats(ctx context.Context, m *tgbotapi.Message) (tgbotapi.Chattabl
 	if err != nil {
 		return nil, err
 	}
-	session, err := b.trans.GetSession(ctx, transmission.SessionFieldTurtleEnabled)
+	session, err := b.trans.GetSession(ctx,
+		transmission.SessionFieldTurtleEnabled,
+		transmission.SessionFieldTurtleScheduleEnabled,
+		transmission.SessionFieldTurtleScheduleOnDays,
+		transmission.SessionFieldTurtleScheduleStartsAt,
+		transmission.SessionFieldTurtleScheduleStopsAt,
+	)
 	if err != nil {
 		return nil, err
 	}
@@ -134,6 +541,7 @@ func (b *Bot) stats(ctx context.Context, m *tgbotapi.Message) (tgbotapi.Chattabl
 		DownloadRate    string
 		UploadRate      string
 		TurtleMode      bool
+		Scheduled       bool
 		ActiveTorrents  int
 		PausedTorrents  int
 		DownloadedTotal string
@@ -143,6 +551,7 @@ func (b *Bot) stats(ctx context.Context, m *tgbotapi.Message) (tgbotapi.Chattabl
 		DownloadRate:    escapeMarkdownV2(humanize.IBytes(uint64(stats.DownloadRate))),
 		UploadRate:      escapeMarkdownV2(humanize.IBytes(uint64(stats.UploadRate))),
 		TurtleMode:      session.TurtleEnabled,
+		Scheduled:       session.TurtleEnabled && turtleScheduled(session, b.now()),
 		ActiveTorrents:  stats.ActiveTorrents,
 		PausedTorrents:  stats.PausedTorrents,
 		DownloadedTotal: escapeMarkdownV2(humanize.IBytes(uint64(stats.AllSessions.Downloaded))),
@@ -156,6 +565,41 @@ func (b *Bot) stats(ctx context.Context, m *tgbotapi.Message) (tgbotapi.Chattabl
 	return reply(m, withText(buf.String()), withMarkdownV2()), nil
 }
 
+func (b *Bot) space(ctx context.Context, m *tgbotapi.Message) (tgbotapi.Chattable, error) {
+	session, err := b.trans.GetSession(ctx, transmission.SessionFieldDownloadDirectory)
+	if err != nil {
+		return nil, err
+	}
+
+	type location struct {
+		Name  string
+		Path  string
+		Known bool
+		Free  string
+	}
+	locations := make([]location, 0, len(b.locations)+1)
+	add := func(name, path string) {
+		free, ok := b.freeSpace(ctx, path)
+		locations = append(locations, location{
+			Name:  escapeMarkdownV2(name),
+			Path:  escapeMarkdownV2(path),
+			Known: ok,
+			Free:  escapeMarkdownV2(humanize.IBytes(uint64(free))),
+		})
+	}
+	add("Default", session.DownloadDirectory)
+	for _, n := range b.locationsOrder {
+		add(n, b.locations[n])
+	}
+
+	buf := new(strings.Builder)
+	if err := spaceTemplate.Execute(buf, locations); err != nil {
+		return nil, err
+	}
+
+	return reply(m, withText(buf.String()), withMarkdownV2()), nil
+}
+
 func (b *Bot) setTurtle(ctx context.Context, m *tgbotapi.Message, on bool) (tgbotapi.Chattable, error) {
 	if err := b.trans.SetSession(ctx, &transmission.SetSessionReq{
 		TurtleEnabled: transmission.OptBool(on),
@@ -220,8 +664,63 @@ func (b *Bot) stopTorrents(ctx context.Context, m *tgbotapi.Message, args string
 	return reply(m, withText("Done 😎")), nil
 }
 
+const (
+	// maxMessageLen is the maximum length of a text message Telegram accepts
+	maxMessageLen = 4096
+	// listPageSize is the maximum number of torrents on a single page of the
+	// list
+	listPageSize = 10
+	// listReservedLen is the number of characters reserved for the list
+	// header and the page indicator
+	listReservedLen = 64
+	// maxListNameLen is the maximum number of characters of the torrent name
+	// displayed in the list
+	maxListNameLen = 256
+)
+
+type listState struct {
+	Query string `json:"query"`
+	Page  int    `json:"page"`
+}
+
 func (b *Bot) listTorrents(ctx context.Context, m *tgbotapi.Message, args string) (tgbotapi.Chattable, error) {
-	torrents, err := b.trans.GetTorrents(ctx, transmission.All(),
+	opts, err := b.renderList(ctx, &listState{Query: args})
+	if err != nil {
+		return nil, err
+	}
+
+	return reply(m, opts...), nil
+}
+
+func (b *Bot) listPageCallback(ctx context.Context, q *tgbotapi.CallbackQuery,
+	data json.RawMessage) (tgbotapi.Chattable, error) {
+	var state listState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, err
+	}
+	page, err := strconv.Atoi(q.Data)
+	if err != nil {
+		return nil, err
+	}
+	state.Page = page
+
+	opts, err := b.renderList(ctx, &state)
+	if err != nil {
+		return nil, err
+	}
+
+	return edit(q.Message, opts...), nil
+}
+
+// renderList renders the requested page of the list of torrents along with
+// the navigation buttons. The torrents are split into pages, so that every
+// page fits into a single message.
+func (b *Bot) renderList(ctx context.Context, state *listState) ([]replyOption, error) {
+	filter, err := parseFilter(state.Query)
+	if err != nil {
+		return nil, err
+	}
+	torrents, err := b.trans.GetTorrents(ctx, transmission.All(), filter.requiredFields(
 		transmission.TorrentFieldID,
 		transmission.TorrentFieldName,
 		transmission.TorrentFieldStatus,
@@ -231,12 +730,83 @@ func (b *Bot) listTorrents(ctx context.Context, m *tgbotapi.Message, args string
 		transmission.TorrentFieldUploadRate,
 		transmission.TorrentFieldUploadRatio,
 		transmission.TorrentFieldETA,
-	)
+		transmission.TorrentFieldIsFinished,
+		transmission.TorrentFieldDownloadRateLimit,
+		transmission.TorrentFieldDownloadRateLimitEnabled,
+		transmission.TorrentFieldUploadRateLimit,
+		transmission.TorrentFieldUploadRateLimited,
+		transmission.TorrentFieldPriority,
+	)...)
 	if err != nil {
 		return nil, err
 	}
 
-	type torrent struct {
+	var entries []string
+	for _, t := range filter.apply(torrents) {
+		entry, err := renderListEntry(t)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+
+	pages := paginate(entries, listPageSize, maxMessageLen-listReservedLen)
+	page := state.Page
+	if page >= len(pages) {
+		page = len(pages) - 1
+	}
+	if page < 0 {
+		page = 0
+	}
+
+	res := struct {
+		Torrents []string
+		Page     int
+		Pages    int
+	}{
+		Page:  page + 1,
+		Pages: len(pages),
+	}
+	if len(pages) > 0 {
+		res.Torrents = pages[page]
+	}
+	buf := new(strings.Builder)
+	if err := listTemplate.Execute(buf, &res); err != nil {
+		return nil, err
+	}
+
+	opts := []replyOption{withText(buf.String()), withMarkdownV2()}
+	if len(pages) < 2 {
+		return opts, nil
+	}
+
+	id, err := b.addCallback(callbackListPage, RoleViewer, &listState{Query: state.Query})
+	if err != nil {
+		return nil, err
+	}
+	var row []tgbotapi.InlineKeyboardButton
+	if page > 0 {
+		row = append(row, tgbotapi.NewInlineKeyboardButtonData("◀️", id+strconv.Itoa(page-1)))
+	}
+	if page < len(pages)-1 {
+		row = append(row, tgbotapi.NewInlineKeyboardButtonData("▶️", id+strconv.Itoa(page+1)))
+	}
+
+	return append(opts, withInlineKeyboard(row)), nil
+}
+
+func renderListEntry(t *transmission.Torrent) (string, error) {
+	var eta string
+	if t.ETA > 0 {
+		eta = t.ETA.String()
+	}
+	var ratio string
+	if t.UploadRatio > 0 {
+		ratio = escapeMarkdownV2(fmt.Sprintf("%.2f", t.UploadRatio))
+	}
+
+	buf := new(strings.Builder)
+	if err := listEntryTemplate.Execute(buf, struct {
 		ID           transmission.ID
 		Name         string
 		Status       string
@@ -247,46 +817,61 @@ func (b *Bot) listTorrents(ctx context.Context, m *tgbotapi.Message, args string
 		UploadRate   string
 		Ratio        string
 		ETA          string
-	}
-	var res struct {
-		Torrents []torrent
+		Limits       string
+	}{
+		ID:           t.ID,
+		Name:         escapeMarkdownV2(truncate(t.Name, maxListNameLen)),
+		Status:       torrentStatus(t),
+		Valid:        escapeMarkdownV2(humanize.IBytes(uint64(t.ValidSize))),
+		Wanted:       escapeMarkdownV2(humanize.IBytes(uint64(t.WantedSize))),
+		Perc:         escapeMarkdownV2(fmt.Sprintf("%.1f", float64(t.ValidSize)/float64(t.WantedSize)*100)),
+		DownloadRate: escapeMarkdownV2(humanize.IBytes(uint64(t.DownloadRate))),
+		UploadRate:   escapeMarkdownV2(humanize.IBytes(uint64(t.UploadRate))),
+		Ratio:        ratio,
+		ETA:          eta,
+		Limits:       renderLimits(t),
+	}); err != nil {
+		return "", err
 	}
 
-	args = strings.ToLower(args)
-	for _, t := range torrents {
-		if args != "" && !strings.Contains(strings.ToLower(t.Name), args) {
-			continue
-		}
+	return buf.String(), nil
+}
 
-		status := t.Status.String()
-		st, stSize := utf8.DecodeRuneInString(status)
-		var eta string
-		if t.ETA > 0 {
-			eta = t.ETA.String()
-		}
-		var ratio string
-		if t.UploadRatio > 0 {
-			ratio = escapeMarkdownV2(fmt.Sprintf("%.2f", t.UploadRatio))
+// torrentStatus returns the capitalized torrent status. Stopped torrents
+// that have reached their seeding limit are told apart from the ones stopped
+// by the user.
+func torrentStatus(t *transmission.Torrent) string {
+	if t.Status == transmission.StatusStopped && t.IsFinished {
+		return "Done seeding"
+	}
+	status := t.Status.String()
+	st, stSize := utf8.DecodeRuneInString(status)
+	return string(unicode.ToTitle(st)) + status[stSize:]
+}
+
+// paginate splits entries into pages, so that every page has at most size
+// entries and its total length doesn't exceed maxLen characters. The length is
+// measured in UTF-16 code units, the same way Telegram does it.
+func paginate(entries []string, size, maxLen int) [][]string {
+	var (
+		pages   [][]string
+		page    []string
+		pageLen int
+	)
+	for _, e := range entries {
+		l := len(utf16.Encode([]rune(e)))
+		if len(page) > 0 && (len(page) == size || pageLen+l > maxLen) {
+			pages = append(pages, page)
+			page, pageLen = nil, 0
 		}
-		res.Torrents = append(res.Torrents, torrent{
-			ID:           t.ID,
-			Name:         escapeMarkdownV2(t.Name),
-			Status:       string(unicode.ToTitle(st)) + status[stSize:],
-			Valid:        escapeMarkdownV2(humanize.IBytes(uint64(t.ValidSize))),
-			Wanted:       escapeMarkdownV2(humanize.IBytes(uint64(t.WantedSize))),
-			Perc:         escapeMarkdownV2(fmt.Sprintf("%.1f", float64(t.ValidSize)/float64(t.WantedSize)*100)),
-			DownloadRate: escapeMarkdownV2(humanize.IBytes(uint64(t.DownloadRate))),
-			UploadRate:   escapeMarkdownV2(humanize.IBytes(uint64(t.UploadRate))),
-			Ratio:        ratio,
-			ETA:          eta,
-		})
+		page = append(page, e)
+		pageLen += l
 	}
-	buf := new(strings.Builder)
-	if err := listTemplate.Execute(buf, &res); err != nil {
-		return nil, err
+	if len(page) > 0 {
+		pages = append(pages, page)
 	}
 
-	return reply(m, withText(buf.String()), withMarkdownV2()), nil
+	return pages
 }
 
 func (b *Bot) removeTorrents(ctx context.Context, m *tgbotapi.Message, args string) (tgbotapi.Chattable, error) {
@@ -307,12 +892,23 @@ func (b *Bot) removeTorrents(ctx context.Context, m *tgbotapi.Message, args stri
 		return reply(m, withText("Don't have any matching torrents")), nil
 	}
 
+	opts, err := b.confirmRemoval(torrents)
+	if err != nil {
+		return nil, err
+	}
+
+	return reply(m, opts...), nil
+}
+
+// confirmRemoval renders a question whether the torrents should be removed
+// along with their data files.
+func (b *Bot) confirmRemoval(torrents []*transmission.Torrent) ([]replyOption, error) {
 	type torrent struct {
 		ID   transmission.ID
 		Name string
 	}
 	tors := make([]torrent, 0, len(torrents))
-	hashes := make([]transmission.SingularIdentifier, 0, len(torrents))
+	hashes := make([]transmission.Hash, 0, len(torrents))
 	for _, t := range torrents {
 		tors = append(tors, torrent{ID: t.ID, Name: escapeMarkdownV2(t.Name)})
 		hashes = append(hashes, t.Hash)
@@ -323,25 +919,187 @@ func (b *Bot) removeTorrents(ctx context.Context, m *tgbotapi.Message, args stri
 		return nil, err
 	}
 
-	id := b.addCallbackHandler(func(ctx context.Context, q *tgbotapi.CallbackQuery) (tgbotapi.Chattable, error) {
-		var withData bool
-		switch q.Data {
-		case "yes":
-			withData = true
-		case "no":
-		default:
-			return edit(q.Message, withText("Ok, not gonna remove any torrents")), nil
-		}
-		if err := b.trans.RemoveTorrents(ctx, transmission.IDs(hashes...), withData); err != nil {
-			return nil, err
-		}
+	id, err := b.addCallback(callbackRemoveTorrents, RoleAdmin, &removeTorrentsState{Hashes: hashes})
+	if err != nil {
+		return nil, err
+	}
 
-		return edit(q.Message, withText("Done 😎")), nil
-	})
+	return []replyOption{
+		withText(buf.String()),
+		withMarkdownV2(),
+		withInlineKeyboard(tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("Yes", id+"yes"),
+			tgbotapi.NewInlineKeyboardButtonData("No", id+"no"),
+			tgbotapi.NewInlineKeyboardButtonData("Cancel", id+"cancel"),
+		)),
+	}, nil
+}
 
-	return reply(m, withText(buf.String()), withMarkdownV2(), withInlineKeyboard(tgbotapi.NewInlineKeyboardRow(
-		tgbotapi.NewInlineKeyboardButtonData("Yes", id+"yes"),
-		tgbotapi.NewInlineKeyboardButtonData("No", id+"no"),
-		tgbotapi.NewInlineKeyboardButtonData("Cancel", id+"cancel"),
-	))), nil
+type removeTorrentsState struct {
+	Hashes []transmission.Hash `json:"hashes"`
+}
+
+func (b *Bot) removeTorrentsCallback(ctx context.Context, q *tgbotapi.CallbackQuery,
+	data json.RawMessage) (tgbotapi.Chattable, error) {
+	var state removeTorrentsState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, err
+	}
+
+	var withData bool
+	switch q.Data {
+	case "yes":
+		withData = true
+	case "no":
+	default:
+		return edit(q.Message, withText("Ok, not gonna remove any torrents")), nil
+	}
+	ids := make([]transmission.SingularIdentifier, 0, len(state.Hashes))
+	for _, h := range state.Hashes {
+		ids = append(ids, h)
+	}
+	if err := b.trans.RemoveTorrents(ctx, transmission.IDs(ids...), withData); err != nil {
+		return nil, err
+	}
+
+	return edit(q.Message, withText("Done 😎")), nil
+}
+
+type moveTorrentsState struct {
+	Hashes []transmission.Hash `json:"hashes"`
+	// ID of the user who may move the torrents besides admins
+	UserID int `json:"user_id,omitempty"`
+}
+
+func (b *Bot) moveTorrents(ctx context.Context, m *tgbotapi.Message, args string) (tgbotapi.Chattable, error) {
+	if len(b.locations) == 0 {
+		return reply(m, withText("I don't know any locations to move torrents to")), nil
+	}
+	if strings.TrimSpace(args) == "" {
+		return reply(m, withText("Tell me which torrents to move, e.g. /move 1 2")), nil
+	}
+	ids, err := getTorrentIDs(args)
+	if err != nil {
+		return nil, err
+	}
+
+	torrents, err := b.trans.GetTorrents(ctx, ids,
+		transmission.TorrentFieldID,
+		transmission.TorrentFieldHash,
+		transmission.TorrentFieldName,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if len(torrents) == 0 {
+		return reply(m, withText("Don't have any matching torrents")), nil
+	}
+
+	opts, err := b.askMove(torrents, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	return reply(m, opts...), nil
+}
+
+// askMove renders a question where the torrents should be moved to. The
+// answer is accepted from admins and the user with the owner ID, if set.
+func (b *Bot) askMove(torrents []*transmission.Torrent, owner int) ([]replyOption, error) {
+	hashes := make([]transmission.Hash, 0, len(torrents))
+	for _, t := range torrents {
+		hashes = append(hashes, t.Hash)
+	}
+	text, err := renderMove(torrents, "")
+	if err != nil {
+		return nil, err
+	}
+
+	role := RoleAdmin
+	if owner != 0 {
+		role = RoleAdder
+	}
+	id, err := b.addCallback(callbackMoveTorrents, role, &moveTorrentsState{Hashes: hashes, UserID: owner})
+	if err != nil {
+		return nil, err
+	}
+	row := make([]tgbotapi.InlineKeyboardButton, 0, len(b.locations))
+	for _, n := range b.locationsOrder {
+		row = append(row, tgbotapi.NewInlineKeyboardButtonData(n, id+n))
+	}
+
+	return []replyOption{withText(text), withMarkdownV2(), withInlineKeyboard(
+		row,
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("Cancel", id+"cancel"),
+		),
+	)}, nil
+}
+
+// moveTorrentsGuard lets the owner of the torrents move them besides admins.
+func moveTorrentsGuard(q *tgbotapi.CallbackQuery, data json.RawMessage, role Role) bool {
+	var state moveTorrentsState
+	if err := json.Unmarshal(data, &state); err != nil {
+		// Let moveTorrentsCallback report the error
+		return true
+	}
+	return isOwnerOrAdmin(q.From, role, state.UserID)
+}
+
+func (b *Bot) moveTorrentsCallback(ctx context.Context, q *tgbotapi.CallbackQuery,
+	data json.RawMessage) (tgbotapi.Chattable, error) {
+	var state moveTorrentsState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, err
+	}
+	if q.Data == "cancel" {
+		return edit(q.Message, withText("Ok, not gonna move any torrents")), nil
+	}
+	path, ok := b.locations[q.Data]
+	if !ok {
+		return nil, errors.New("I don't know this location") //nolint:stylecheck
+	}
+
+	ids := make([]transmission.SingularIdentifier, 0, len(state.Hashes))
+	for _, h := range state.Hashes {
+		ids = append(ids, h)
+	}
+	if err := b.trans.SetTorrentsLocation(ctx, transmission.IDs(ids...), path, true); err != nil {
+		return nil, err
+	}
+	torrents, err := b.trans.GetTorrents(ctx, transmission.IDs(ids...),
+		transmission.TorrentFieldID,
+		transmission.TorrentFieldName,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	text, err := renderMove(torrents, path)
+	if err != nil {
+		return nil, err
+	}
+	return edit(q.Message, withText(text), withMarkdownV2()), nil
+}
+
+func renderMove(torrents []*transmission.Torrent, path string) (string, error) {
+	type torrent struct {
+		ID   transmission.ID
+		Name string
+	}
+	res := struct {
+		Path     string
+		Torrents []torrent
+	}{
+		Path: escapeMarkdownV2(path),
+	}
+	for _, t := range torrents {
+		res.Torrents = append(res.Torrents, torrent{ID: t.ID, Name: escapeMarkdownV2(t.Name)})
+	}
+
+	buf := new(strings.Builder)
+	if err := moveTemplate.Execute(buf, &res); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
 }
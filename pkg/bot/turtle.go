@@ -0,0 +1,321 @@
+package bot
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+	"github.com/pborzenkov/go-transmission/transmission"
+)
+
+const (
+	// turtleTimeStep is how much the schedule start and end times are moved
+	// by a single button press
+	turtleTimeStep = 30
+	// minTurtleRate is the minimum turtle mode speed the editor goes down to
+	minTurtleRate = 1 << 10
+
+	minutesPerDay = 24 * 60
+
+	turtleUsage = "Tell me the turtle mode speeds, e.g. /turtle down=3M up=500K, or use the buttons"
+)
+
+var (
+	// turtleFields are the session fields required to render the turtle mode
+	// settings
+	turtleFields = []transmission.SessionField{
+		transmission.SessionFieldTurtleEnabled,
+		transmission.SessionFieldTurtleDownloadRateLimit,
+		transmission.SessionFieldTurtleUploadRateLimit,
+		transmission.SessionFieldTurtleScheduleEnabled,
+		transmission.SessionFieldTurtleScheduleOnDays,
+		transmission.SessionFieldTurtleScheduleStartsAt,
+		transmission.SessionFieldTurtleScheduleStopsAt,
+	}
+
+	// turtleDays are the days of the week in the order they are shown in
+	// the editor
+	turtleDays = []struct {
+		Name string
+		Day  transmission.Weekday
+	}{
+		{"Mo", transmission.Monday},
+		{"Tu", transmission.Tuesday},
+		{"We", transmission.Wednesday},
+		{"Th", transmission.Thursday},
+		{"Fr", transmission.Friday},
+		{"Sa", transmission.Saturday},
+		{"Su", transmission.Sunday},
+	}
+
+	turtleTemplate = template.Must(template.New("turtle").Parse(
+		`{{ if .Enabled }}🐢 Turtle mode is *on*{{ if .Scheduled }} by schedule{{ end }}` +
+			`{{ else }}🚀 Turtle mode is *off*{{ end }}
+Turtle speeds: ↓*{{ .Down }}/s* ↑*{{ .Up }}/s*
+Schedule: *{{ .Start }}*–*{{ .End }}* on *{{ .Days }}*{{ if not .Schedule }} \(disabled\){{ end }}`,
+	))
+)
+
+// turtleState is the state of the turtle mode editor. The editor always
+// works with the current session settings, so there is nothing to keep.
+type turtleState struct{}
+
+func (b *Bot) turtle(ctx context.Context, m *tgbotapi.Message, args string) (tgbotapi.Chattable, error) {
+	if settings := joinUnits(strings.Fields(args)); len(settings) > 0 {
+		req, err := parseTurtleRates(settings)
+		if err != nil {
+			return reply(m, withText(fmt.Sprintf("%v. %s", err, turtleUsage))), nil
+		}
+		if err := b.trans.SetSession(ctx, req); err != nil {
+			return nil, err
+		}
+	}
+
+	opts, err := b.renderTurtle(ctx, true)
+	if err != nil {
+		return nil, err
+	}
+
+	return reply(m, opts...), nil
+}
+
+func (b *Bot) turtleCallback(ctx context.Context, q *tgbotapi.CallbackQuery,
+	data json.RawMessage) (tgbotapi.Chattable, error) {
+	var state turtleState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, err
+	}
+	if q.Data == "done" {
+		opts, err := b.renderTurtle(ctx, false)
+		if err != nil {
+			return nil, err
+		}
+		return edit(q.Message, opts...), nil
+	}
+
+	session, err := b.trans.GetSession(ctx, turtleFields...)
+	if err != nil {
+		return nil, err
+	}
+	req, err := turtleRequest(session, q.Data)
+	if err != nil {
+		return nil, err
+	}
+	if err := b.trans.SetSession(ctx, req); err != nil {
+		return nil, err
+	}
+
+	opts, err := b.renderTurtle(ctx, true)
+	if err != nil {
+		return nil, err
+	}
+
+	return edit(q.Message, opts...), nil
+}
+
+// turtleRequest returns the request that changes the session as the editor
+// action tells.
+func turtleRequest(s *transmission.Session, action string) (*transmission.SetSessionReq, error) {
+	switch action {
+	case "toggle":
+		return &transmission.SetSessionReq{TurtleEnabled: transmission.OptBool(!s.TurtleEnabled)}, nil
+	case "schedule":
+		return &transmission.SetSessionReq{
+			TurtleScheduleEnabled: transmission.OptBool(!s.TurtleScheduleEnabled),
+		}, nil
+	case "start-", "start+":
+		return &transmission.SetSessionReq{
+			TurtleScheduleStartsAt: transmission.OptInt(moveTime(s.TurtleScheduleStartsAt, action[len(action)-1])),
+		}, nil
+	case "end-", "end+":
+		return &transmission.SetSessionReq{
+			TurtleScheduleStopsAt: transmission.OptInt(moveTime(s.TurtleScheduleStopsAt, action[len(action)-1])),
+		}, nil
+	case "down-", "down+":
+		return &transmission.SetSessionReq{
+			TurtleDownloadRateLimit: transmission.OptInt64(scaleRate(s.TurtleDownloadRateLimit, action[len(action)-1])),
+		}, nil
+	case "up-", "up+":
+		return &transmission.SetSessionReq{
+			TurtleUploadRateLimit: transmission.OptInt64(scaleRate(s.TurtleUploadRateLimit, action[len(action)-1])),
+		}, nil
+	}
+
+	if strings.HasPrefix(action, "day") {
+		day, err := strconv.Atoi(action[len("day"):])
+		if err == nil && day >= 0 && day < len(turtleDays) {
+			return &transmission.SetSessionReq{
+				TurtleScheduleOnDays: transmission.OptWeekday(s.TurtleScheduleOnDays ^ turtleDays[day].Day),
+			}, nil
+		}
+	}
+
+	return nil, errors.New("I don't know this action") //nolint:stylecheck
+}
+
+// parseTurtleRates parses turtle mode speed settings. Unlike the regular
+// speed limits, turtle mode speeds can't be unlimited.
+func parseTurtleRates(settings []string) (*transmission.SetSessionReq, error) {
+	down, up, err := parseRateLimits(settings)
+	if err != nil {
+		return nil, err
+	}
+	if (down != nil && !down.Enabled) || (up != nil && !up.Enabled) {
+		return nil, errors.New("turtle mode speeds can't be unlimited")
+	}
+
+	req := new(transmission.SetSessionReq)
+	if down != nil {
+		req.TurtleDownloadRateLimit = transmission.OptInt64(down.Rate)
+	}
+	if up != nil {
+		req.TurtleUploadRateLimit = transmission.OptInt64(up.Rate)
+	}
+	return req, nil
+}
+
+// moveTime moves the time of the day given in minutes after midnight one
+// step forward or backward.
+func moveTime(minutes int, dir byte) int {
+	if dir == '-' {
+		minutes -= turtleTimeStep
+	} else {
+		minutes += turtleTimeStep
+	}
+	return (minutes%minutesPerDay + minutesPerDay) % minutesPerDay
+}
+
+// scaleRate halves or doubles the rate. It's a shortcut for the editor,
+// arbitrary rates are set with /turtle down=RATE up=RATE.
+func scaleRate(rate int64, dir byte) int64 {
+	if dir == '-' {
+		rate /= 2
+	} else {
+		rate *= 2
+	}
+	if rate < minTurtleRate {
+		rate = minTurtleRate
+	}
+	return rate
+}
+
+// renderTurtle renders the turtle mode settings along with the editor
+// buttons if withEditor is set.
+func (b *Bot) renderTurtle(ctx context.Context, withEditor bool) ([]replyOption, error) {
+	s, err := b.trans.GetSession(ctx, turtleFields...)
+	if err != nil {
+		return nil, err
+	}
+
+	days := "no days"
+	if s.TurtleScheduleOnDays != 0 {
+		days = s.TurtleScheduleOnDays.String()
+	}
+	buf := new(strings.Builder)
+	if err := turtleTemplate.Execute(buf, struct {
+		Enabled   bool
+		Scheduled bool
+		Down      string
+		Up        string
+		Schedule  bool
+		Start     string
+		End       string
+		Days      string
+	}{
+		Enabled:   s.TurtleEnabled,
+		Scheduled: s.TurtleEnabled && turtleScheduled(s, b.now()),
+		Down:      escapeMarkdownV2(humanize.IBytes(uint64(s.TurtleDownloadRateLimit))),
+		Up:        escapeMarkdownV2(humanize.IBytes(uint64(s.TurtleUploadRateLimit))),
+		Schedule:  s.TurtleScheduleEnabled,
+		Start:     formatMinutes(s.TurtleScheduleStartsAt),
+		End:       formatMinutes(s.TurtleScheduleStopsAt),
+		Days:      escapeMarkdownV2(days),
+	}); err != nil {
+		return nil, err
+	}
+
+	opts := []replyOption{withText(buf.String()), withMarkdownV2()}
+	if !withEditor {
+		return opts, nil
+	}
+
+	id, err := b.addCallback(callbackTurtle, RoleAdmin, &turtleState{})
+	if err != nil {
+		return nil, err
+	}
+	toggle, schedule := "Turn on", "Enable schedule"
+	if s.TurtleEnabled {
+		toggle = "Turn off"
+	}
+	if s.TurtleScheduleEnabled {
+		schedule = "Disable schedule"
+	}
+	dayRow := make([]tgbotapi.InlineKeyboardButton, 0, len(turtleDays))
+	for i, d := range turtleDays {
+		mark := "⬜"
+		if s.TurtleScheduleOnDays&d.Day != 0 {
+			mark = "✅"
+		}
+		dayRow = append(dayRow, tgbotapi.NewInlineKeyboardButtonData(mark+d.Name, fmt.Sprintf("%sday%d", id, i)))
+	}
+	step := fmt.Sprintf("%dm", turtleTimeStep)
+
+	return append(opts, withInlineKeyboard(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(toggle, id+"toggle"),
+			tgbotapi.NewInlineKeyboardButtonData(schedule, id+"schedule"),
+		),
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("Start −"+step, id+"start-"),
+			tgbotapi.NewInlineKeyboardButtonData("Start +"+step, id+"start+"),
+			tgbotapi.NewInlineKeyboardButtonData("End −"+step, id+"end-"),
+			tgbotapi.NewInlineKeyboardButtonData("End +"+step, id+"end+"),
+		),
+		dayRow,
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("↓ ÷2", id+"down-"),
+			tgbotapi.NewInlineKeyboardButtonData("↓ ×2", id+"down+"),
+			tgbotapi.NewInlineKeyboardButtonData("↑ ÷2", id+"up-"),
+			tgbotapi.NewInlineKeyboardButtonData("↑ ×2", id+"up+"),
+		),
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("Done", id+"done"),
+		),
+	)), nil
+}
+
+// turtleScheduled checks whether the turtle mode schedule is active at the
+// given time. Transmission uses its local time for the schedule, so it's
+// assumed to be the same as the bot's one. A schedule crossing midnight
+// belongs to the day it starts on.
+func turtleScheduled(s *transmission.Session, now time.Time) bool {
+	if !s.TurtleScheduleEnabled {
+		return false
+	}
+	minutes := now.Hour()*60 + now.Minute()
+	day := now.Weekday()
+	begin, end := s.TurtleScheduleStartsAt, s.TurtleScheduleStopsAt
+
+	switch {
+	case begin <= end && (minutes < begin || minutes >= end):
+		return false
+	case begin > end && minutes < begin && minutes >= end:
+		return false
+	case begin > end && minutes < end:
+		day = (day + 6) % 7
+	}
+
+	return s.TurtleScheduleOnDays&(1<<day) != 0
+}
+
+// formatMinutes formats the time of the day given in minutes after midnight.
+func formatMinutes(minutes int) string {
+	return fmt.Sprintf("%02d:%02d", minutes/60, minutes%60)
+}